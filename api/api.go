@@ -1,9 +1,6 @@
 package api
 
 import (
-	"errors"
-	"net/http"
-
 	"github.com/gin-gonic/gin"
 
 	swaggerFiles "github.com/swaggo/files"
@@ -12,78 +9,77 @@ import (
 	_ "crud/api/docs"
 	"crud/api/handler"
 	"crud/config"
-	"crud/pkg/helper"
+	"crud/pkg/keys"
+	"crud/pkg/password"
+	"crud/pkg/policy"
+	"crud/pkg/revocation"
 	"crud/storage"
 )
 
-func SetUpApi(cfg *config.Config, r *gin.Engine, storage storage.StorageI) {
+func SetUpApi(cfg *config.Config, r *gin.Engine, storage storage.StorageI, accessPolicy *policy.Policy, hasher *password.Hasher, revoked *revocation.Store, keySet *keys.Set) {
 
-	handlerV1 := handler.NewHandlerV1(cfg, storage)
+	permissions := policy.NewPermissionCache(storage.Role().HasPermission, cfg.PermissionCacheTTL)
 
-	r.Use(customCORSMiddleware())
+	handlerV1 := handler.NewHandlerV1(cfg, storage, hasher, revoked, keySet, permissions)
 
-	v1 := r.Group("/v1")
-	v2 := r.Group("/v2")
+	r.Use(customCORSMiddleware())
+	r.Use(authenticate(cfg, keySet, revoked, accessPolicy))
+	r.Use(checkAccess(permissions, accessPolicy))
 
 	r.POST("/login", handlerV1.Login)
 	r.POST("/loginsuper", handlerV1.LoginSuper)
+	r.POST("/token/refresh", handlerV1.RefreshToken)
+	r.POST("/logout", handlerV1.Logout)
+	r.POST("/logout-all", handlerV1.LogoutAll)
+	r.GET("/.well-known/jwks.json", handlerV1.JWKS)
 
-	
-
-	v1.Use(checkTokenSuper())
-	v2.Use(checkTokenClient())
 	r.POST("/book", handlerV1.CreateBook)
 	r.GET("/book/:id", handlerV1.GetBookById)
 	r.GET("/book", handlerV1.GetBookList)
 	r.PUT("/book/:id", handlerV1.UpdateBook)
+	r.PATCH("/book/:id", handlerV1.PatchBook)
 	r.DELETE("/book/:id", handlerV1.DeleteBook)
+	r.POST("/book/:id/restore", handlerV1.RestoreBook)
 
 	r.POST("/user", handlerV1.CreateUser)
 	r.GET("/user/:id", handlerV1.GetUserById)
-	v2.GET("/user", handlerV1.GetUserList)
+	r.GET("/user", handlerV1.GetUserList)
 	r.PUT("/user/:id", handlerV1.UpdateUser)
+	r.PATCH("/user/:id", handlerV1.PatchUser)
 	r.DELETE("/user/:id", handlerV1.DeleteUser)
-
-	v2.POST("/order", handlerV1.CreateOrder)
-	v1.GET("/order/:id", handlerV1.GetOrderById)
-	v1.GET("/order", handlerV1.GetOrderList)
-	v2.PUT("/order/:id", handlerV1.UpdateOrder)
-	v2.DELETE("/order/:id", handlerV1.DeleteOrder)
+	r.POST("/user/:id/restore", handlerV1.RestoreUser)
+	r.POST("/user/:id/role", handlerV1.AssignUserRole)
+	r.DELETE("/user/:id/role/:role", handlerV1.RevokeUserRole)
+	r.GET("/user/:id/wallet", handlerV1.GetWallet)
+	r.POST("/user/:id/wallet/top-up", handlerV1.TopUpWallet)
+	r.POST("/user/:id/wallet/withdraw", handlerV1.WithdrawWallet)
+	r.GET("/user/:id/wallet/ledger", handlerV1.GetWalletLedger)
+	r.POST("/wallet/reconcile", handlerV1.ReconcileWallets)
+
+	r.POST("/order", handlerV1.CreateOrder)
+	r.GET("/order/:id", handlerV1.GetOrderById)
+	r.GET("/order", handlerV1.GetOrderList)
+	r.PUT("/order/:id", handlerV1.UpdateOrder)
+	r.PATCH("/order/:id", handlerV1.PatchOrder)
+	r.DELETE("/order/:id", handlerV1.DeleteOrder)
+	r.POST("/order/:id/restore", handlerV1.RestoreOrder)
+	r.POST("/order/:id/pay", handlerV1.PayOrder)
+	r.POST("/order/:id/ship", handlerV1.ShipOrder)
+	r.POST("/order/:id/deliver", handlerV1.DeliverOrder)
+	r.POST("/order/:id/cancel", handlerV1.CancelOrder)
+	r.POST("/order/:id/refund", handlerV1.RefundOrder)
+	r.GET("/order/:id/history", handlerV1.GetOrderHistory)
+
+	r.POST("/role", handlerV1.CreateRole)
+	r.GET("/role/:id", handlerV1.GetRoleById)
+	r.GET("/role", handlerV1.GetRoleList)
+	r.PUT("/role/:id", handlerV1.UpdateRole)
+	r.DELETE("/role/:id", handlerV1.DeleteRole)
 
 	url := ginSwagger.URL("swagger/doc.json") // The url pointing to API definition
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
 }
 
-func checkTokenSuper() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		if _, ok := ctx.Request.Header["Authorization"]; ok {
-			_, err := helper.ExtractClaims(ctx.Request.Header["Authorization"][0], config.Load().AuthSecretKey)
-			_, err2 := helper.ExtractClaims(ctx.Request.Header["Authorization"][0], config.Load().SuperAdmin)
-			if err != nil && err2 != nil {
-				ctx.AbortWithError(http.StatusForbidden, errors.New("not found password"))
-				return
-			} else {
-				ctx.Next()
-			}
-		}
-	}
-}
-
-func checkTokenClient() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		if _, ok := ctx.Request.Header["Authorization"]; ok {
-			_, err := helper.ExtractClaims(ctx.Request.Header["Authorization"][0], config.Load().AuthSecretKey)
-			_, err2 := helper.ExtractClaims(ctx.Request.Header["Authorization"][0], config.Load().Client)
-			if err != nil && err2 != nil {
-				ctx.AbortWithError(http.StatusForbidden, errors.New("not found password"))
-				return
-			} else {
-				ctx.Next()
-			}
-		}
-	}
-}
-
 func customCORSMiddleware() gin.HandlerFunc {
 
 	return func(c *gin.Context) {
@@ -0,0 +1,455 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"crud/config"
+	"crud/models"
+	"crud/pkg/keys"
+	"crud/pkg/password"
+	"crud/pkg/policy"
+	"crud/pkg/revocation"
+	"crud/storage/memory"
+)
+
+// testApi serves whole api on memory storage with policy.txt of repository, user root is SUPER
+type testApi struct {
+	t *testing.T
+	r *gin.Engine
+}
+
+func newTestApi(t *testing.T) *testApi {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default()
+	cfg.StorageDriver = "memory"
+	cfg.AuthSecretKey = "0123456789abcdef0123"
+	cfg.PasswordHashCost = 4
+	cfg.PolicyPath = "../policy.txt"
+
+	store := memory.NewMemory()
+
+	accessPolicy, err := policy.Load(cfg.PolicyPath)
+	if err != nil {
+		t.Fatalf("policy.Load: %v", err)
+	}
+
+	hasher, err := password.NewHasher(cfg.PasswordHashAlgorithm, cfg.PasswordHashCost, false)
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+
+	hash, err := hasher.Hash("password1")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	superId, err := store.User().Create(context.Background(), &models.CreateUser{Login: "root", Password: hash})
+	if err != nil {
+		t.Fatalf("create super: %v", err)
+	}
+
+	err = store.Role().AssignToUser(context.Background(), &models.UserRole{UserId: superId, Role: policy.Super})
+	if err != nil {
+		t.Fatalf("assign SUPER: %v", err)
+	}
+
+	r := gin.New()
+	SetUpApi(&cfg, r, store, accessPolicy, hasher, revocation.NewStore(store.Revocation()), keys.NewHMAC(cfg.AuthSecretKey))
+
+	return &testApi{t: t, r: r}
+}
+
+// do sends body as JSON with bearer token when it is set, headers come as name, value pairs
+func (a *testApi) do(method, path, token string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	a.t.Helper()
+
+	var data string
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		data = string(b)
+	}
+
+	req := httptest.NewRequest(method, path, strings.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+
+	return w
+}
+
+// expect checks status of response and decodes its body into resp unless it is nil
+func (a *testApi) expect(w *httptest.ResponseRecorder, status int, resp interface{}) {
+	a.t.Helper()
+
+	if w.Code != status {
+		a.t.Fatalf("status %d %s, want %d", w.Code, w.Body.String(), status)
+	}
+
+	if resp != nil {
+		err := json.Unmarshal(w.Body.Bytes(), resp)
+		if err != nil {
+			a.t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+	}
+}
+
+func (a *testApi) login(path, login string) models.LoginResponse {
+	a.t.Helper()
+
+	var tokens models.LoginResponse
+	a.expect(a.do("POST", path, "", models.Login{Login: login, Password: "password1"}), http.StatusCreated, &tokens)
+
+	return tokens
+}
+
+// signUp creates user with password1 and returns its id and access token
+func (a *testApi) signUp(login string) (string, string) {
+	a.t.Helper()
+
+	var user models.User
+	a.expect(a.do("POST", "/user", "", models.CreateUser{FirstName: login, Login: login, Password: "password1"}), http.StatusCreated, &user)
+
+	return user.Id, a.login("/login", login).AccessToken
+}
+
+func (a *testApi) createBook(token string, book models.CreateBook) models.Book {
+	a.t.Helper()
+
+	var resp models.Book
+	a.expect(a.do("POST", "/book", token, book), http.StatusCreated, &resp)
+
+	return resp
+}
+
+func TestApiAuth(t *testing.T) {
+
+	a := newTestApi(t)
+
+	userId, _ := a.signUp("alice")
+
+	a.expect(a.do("POST", "/user", "", models.CreateUser{Login: "alice", Password: "password1"}), http.StatusConflict, nil)
+
+	a.expect(a.do("POST", "/login", "", models.Login{Login: "alice", Password: "wrong password"}), http.StatusUnauthorized, nil)
+	a.expect(a.do("POST", "/login", "", models.Login{Login: "nobody", Password: "password1"}), http.StatusUnauthorized, nil)
+	a.expect(a.do("POST", "/login", "", models.Login{}), http.StatusUnauthorized, nil)
+
+	// SUPER session comes only from /loginsuper
+	a.expect(a.do("POST", "/loginsuper", "", models.Login{Login: "alice", Password: "password1"}), http.StatusForbidden, nil)
+	super := a.login("/loginsuper", "root")
+	a.expect(a.do("GET", "/user", super.AccessToken, nil), http.StatusOK, nil)
+
+	first := a.login("/login", "alice")
+	a.expect(a.do("GET", "/user/"+userId, first.AccessToken, nil), http.StatusOK, nil)
+
+	// refresh rotates the token, presenting a rotated one again revokes the whole family
+	var second models.LoginResponse
+	a.expect(a.do("POST", "/token/refresh", "", models.RefreshTokenRequest{RefreshToken: first.RefreshToken}), http.StatusCreated, &second)
+
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == "" {
+		t.Fatalf("refresh returned %+v", second)
+	}
+
+	a.expect(a.do("POST", "/token/refresh", "", models.RefreshTokenRequest{RefreshToken: first.RefreshToken}), http.StatusUnauthorized, nil)
+	a.expect(a.do("POST", "/token/refresh", "", models.RefreshTokenRequest{RefreshToken: second.RefreshToken}), http.StatusUnauthorized, nil)
+	a.expect(a.do("POST", "/token/refresh", "", models.RefreshTokenRequest{RefreshToken: "unknown"}), http.StatusUnauthorized, nil)
+
+	// logout revokes access token at once, other sessions go on until logout-all
+	third := a.login("/login", "alice")
+
+	a.expect(a.do("POST", "/logout", second.AccessToken, nil), http.StatusNoContent, nil)
+	a.expect(a.do("GET", "/user/"+userId, second.AccessToken, nil), http.StatusUnauthorized, nil)
+	a.expect(a.do("GET", "/user/"+userId, third.AccessToken, nil), http.StatusOK, nil)
+
+	a.expect(a.do("POST", "/logout-all", third.AccessToken, nil), http.StatusNoContent, nil)
+	a.expect(a.do("GET", "/user/"+userId, third.AccessToken, nil), http.StatusUnauthorized, nil)
+	a.expect(a.do("POST", "/token/refresh", "", models.RefreshTokenRequest{RefreshToken: third.RefreshToken}), http.StatusUnauthorized, nil)
+}
+
+func TestApiOrders(t *testing.T) {
+
+	a := newTestApi(t)
+
+	var (
+		super        = a.login("/loginsuper", "root").AccessToken
+		alice, tokA  = a.signUp("alice")
+		bob, tokB    = a.signUp("bob")
+		book         = a.createBook(super, models.CreateBook{Name: "Dune", AuthorName: "Frank Herbert", Price: usd(100), Stock: 5})
+		order, other models.Order
+	)
+
+	// customer orders for themselves whatever user_id says
+	a.expect(a.do("POST", "/order", tokA, models.CreateOrder{UserId: bob, BookId: book.Id}), http.StatusCreated, &order)
+	if order.UserId != alice || order.Status != models.OrderPending {
+		t.Fatalf("created order %+v, want pending order of %s", order, alice)
+	}
+
+	a.expect(a.do("POST", "/order", super, models.CreateOrder{UserId: bob, BookId: book.Id}), http.StatusCreated, &other)
+	if other.UserId != bob {
+		t.Fatalf("SUPER created order of %s, want %s", other.UserId, bob)
+	}
+
+	for _, c := range []struct {
+		name, token string
+		want        int
+	}{
+		{"owner", tokA, http.StatusOK},
+		{"other customer", tokB, http.StatusForbidden},
+		{"SUPER", super, http.StatusOK},
+		{"anonymous", "", http.StatusUnauthorized},
+	} {
+		if w := a.do("GET", "/order/"+order.Id, c.token, nil); w.Code != c.want {
+			t.Errorf("GET order as %s = %d, want %d", c.name, w.Code, c.want)
+		}
+
+		if w := a.do("GET", "/order/"+order.Id+"/history", c.token, nil); w.Code != c.want {
+			t.Errorf("GET history as %s = %d, want %d", c.name, w.Code, c.want)
+		}
+	}
+
+	// list of customer holds only their orders, user_id of someone else is ignored
+	listOf := func(token, query string) []string {
+		t.Helper()
+
+		var list models.GetListOrderResponse
+		a.expect(a.do("GET", "/order"+query, token, nil), http.StatusOK, &list)
+
+		var ids []string
+		for _, o := range list.Orders {
+			ids = append(ids, o.Id)
+		}
+		return ids
+	}
+
+	if ids := listOf(tokA, "?user_id="+bob); len(ids) != 1 || ids[0] != order.Id {
+		t.Fatalf("alice lists %v, want only %s", ids, order.Id)
+	}
+
+	if ids := listOf(super, ""); len(ids) != 2 {
+		t.Fatalf("SUPER lists %v, want both orders", ids)
+	}
+
+	if ids := listOf(super, "?user_id="+bob); len(ids) != 1 || ids[0] != other.Id {
+		t.Fatalf("SUPER lists %v for bob, want only %s", ids, other.Id)
+	}
+
+	status := func(token, action string, want int) {
+		t.Helper()
+
+		var resp models.Order
+		w := a.do("POST", "/order/"+order.Id+"/"+action, token, nil)
+
+		if w.Code != want {
+			t.Fatalf("%s = %d %s, want %d", action, w.Code, w.Body.String(), want)
+		}
+
+		if want == http.StatusOK {
+			a.expect(w, want, &resp)
+			order = resp
+		}
+	}
+
+	status(tokB, "cancel", http.StatusForbidden)
+	status(tokB, "pay", http.StatusForbidden)
+	status(tokA, "ship", http.StatusForbidden)
+
+	// wallet of alice is empty until SUPER tops it up
+	status(tokA, "pay", http.StatusConflict)
+
+	a.expect(a.do("POST", "/user/"+alice+"/wallet/top-up", tokA, models.WalletOperation{Amount: usd(1000)}), http.StatusForbidden, nil)
+	a.expect(a.do("POST", "/user/"+alice+"/wallet/top-up", super, models.WalletOperation{Amount: usd(1000)}), http.StatusOK, nil)
+
+	status(tokA, "pay", http.StatusOK)
+	if order.Status != models.OrderPaid {
+		t.Fatalf("paid order is %s", order.Status)
+	}
+
+	status(tokA, "pay", http.StatusConflict)
+	status(super, "ship", http.StatusOK)
+	status(tokA, "cancel", http.StatusConflict)
+
+	if order.Status != models.OrderShipped {
+		t.Fatalf("shipped order is %s", order.Status)
+	}
+
+	var wallet models.Wallet
+	a.expect(a.do("GET", "/user/"+alice+"/wallet", tokA, nil), http.StatusOK, &wallet)
+
+	if wallet.Balance != usd(900) {
+		t.Fatalf("balance after paying is %+v, want 900", wallet.Balance)
+	}
+
+	a.expect(a.do("GET", "/user/"+alice+"/wallet", tokB, nil), http.StatusForbidden, nil)
+
+	var history []*models.OrderStatusChange
+	a.expect(a.do("GET", "/order/"+order.Id+"/history", tokA, nil), http.StatusOK, &history)
+
+	if len(history) != 3 {
+		t.Fatalf("history has %d changes, want created, paid and shipped", len(history))
+	}
+}
+
+func TestApiIfMatch(t *testing.T) {
+
+	a := newTestApi(t)
+
+	super := a.login("/loginsuper", "root").AccessToken
+	book := a.createBook(super, models.CreateBook{Name: "Dune", Price: models.Money{Amount: 100, Currency: "EUR"}, Stock: 1})
+	path := "/book/" + book.Id
+
+	w := a.do("GET", path, "", nil)
+	a.expect(w, http.StatusOK, nil)
+
+	tag := w.Header().Get("ETag")
+	if tag != `"1"` {
+		t.Fatalf("ETag of new book is %s", tag)
+	}
+
+	a.expect(a.do("GET", path, "", nil, "If-None-Match", tag), http.StatusNotModified, nil)
+
+	w = a.do("PATCH", path, super, map[string]interface{}{"price": map[string]interface{}{"amount": 150}}, "If-Match", tag)
+	a.expect(w, http.StatusOK, &book)
+
+	if w.Header().Get("ETag") != `"2"` || book.Price != (models.Money{Amount: 150, Currency: "EUR"}) {
+		t.Fatalf("PATCH returned %+v with ETag %s", book, w.Header().Get("ETag"))
+	}
+
+	for _, c := range []struct {
+		name, ifMatch string
+		want          int
+	}{
+		{"stale", `"1"`, http.StatusPreconditionFailed},
+		{"weak", `W/"2"`, http.StatusPreconditionFailed},
+		{"unquoted", `2`, http.StatusPreconditionFailed},
+		{"list", `"1", "2"`, http.StatusUnprocessableEntity},
+		{"current", `"2"`, http.StatusOK},
+		{"any", `*`, http.StatusOK},
+	} {
+		if w := a.do("PATCH", path, super, map[string]interface{}{"name": c.name}, "If-Match", c.ifMatch); w.Code != c.want {
+			t.Errorf("PATCH with If-Match %s = %d %s, want %d", c.ifMatch, w.Code, w.Body.String(), c.want)
+		}
+	}
+
+	a.expect(a.do("GET", path, "", nil), http.StatusOK, &book)
+	if book.Name != "any" || book.Version != 4 {
+		t.Fatalf("book after PATCHes is %+v", book)
+	}
+
+	a.expect(a.do("PUT", path, super, map[string]interface{}{"name": "Dune", "price": 1}, "If-Match", `"3"`), http.StatusPreconditionFailed, nil)
+	a.expect(a.do("DELETE", path, super, nil, "If-Match", `"3"`), http.StatusPreconditionFailed, nil)
+}
+
+func TestApiList(t *testing.T) {
+
+	a := newTestApi(t)
+
+	super := a.login("/loginsuper", "root").AccessToken
+
+	for i, name := range []string{"Emma", "Dune", "Carrie", "Beloved", "Atonement"} {
+		author := "Frank Herbert"
+		if i%2 == 0 {
+			author = "Jane Austen"
+		}
+		a.createBook(super, models.CreateBook{Name: name, AuthorName: author, Price: usd(int64(100 * (i + 1))), Stock: 1})
+	}
+
+	names := func(query string) ([]string, models.GetListBookResponse) {
+		t.Helper()
+
+		var list models.GetListBookResponse
+		a.expect(a.do("GET", "/book"+query, "", nil), http.StatusOK, &list)
+
+		var names []string
+		for _, book := range list.Books {
+			names = append(names, book.Name)
+		}
+		return names, list
+	}
+
+	for _, c := range []struct {
+		query string
+		want  string
+	}{
+		{"?sort=name", "Atonement Beloved Carrie Dune Emma"},
+		{"?sort=-price", "Atonement Beloved Carrie Dune Emma"},
+		{"?sort=author_name,-name", "Dune Beloved Emma Carrie Atonement"},
+		{"?sort=name&limit=2&offset=1", "Beloved Carrie"},
+		{"?author_name=jane%20austen&sort=name", "Atonement Carrie Emma"},
+		{"?price_min=200&price_max=400&sort=price", "Dune Carrie Beloved"},
+		{"?q=dun", "Dune"},
+		{"?currency=EUR", ""},
+	} {
+		if got, _ := names(c.query); strings.Join(got, " ") != c.want {
+			t.Errorf("GET /book%s = %v, want %s", c.query, got, c.want)
+		}
+	}
+
+	// cursor pages follow order of unsorted list and never repeat or skip a book
+	var (
+		all, _ = names("")
+		seen   []string
+		query  = "?limit=2"
+	)
+
+	for page := 0; page < 5; page++ {
+		got, list := names(query)
+		seen = append(seen, got...)
+
+		if list.NextCursor == "" {
+			break
+		}
+		query = "?limit=2&after=" + list.NextCursor
+	}
+
+	if len(all) != 5 || strings.Join(seen, " ") != strings.Join(all, " ") {
+		t.Fatalf("cursor pages returned %v, want %v", seen, all)
+	}
+
+	_, list := names("?limit=2")
+
+	for _, c := range []struct {
+		query string
+		want  int
+	}{
+		{"?sort=unknown", http.StatusUnprocessableEntity},
+		{"?sort=-", http.StatusBadRequest},
+		{"?price_min=cheap", http.StatusBadRequest},
+		{"?currency=dollar", http.StatusBadRequest},
+		{"?after=garbage", http.StatusBadRequest},
+		{"?after=" + list.NextCursor + "&offset=2", http.StatusBadRequest},
+		{"?after=" + list.NextCursor + "&sort=name", http.StatusUnprocessableEntity},
+		{"?low_stock=true", http.StatusForbidden},
+	} {
+		if w := a.do("GET", "/book"+c.query, "", nil); w.Code != c.want {
+			t.Errorf("GET /book%s = %d %s, want %d", c.query, w.Code, w.Body.String(), c.want)
+		}
+	}
+
+	// cursor of one list is refused by another
+	a.expect(a.do("GET", "/order?after="+list.NextCursor, super, nil), http.StatusBadRequest, nil)
+}
+
+func usd(amount int64) models.Money {
+	return models.Money{Amount: amount, Currency: "USD"}
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"crud/models"
+	"crud/pkg/policy"
+)
+
+// isSuper reports whether caller logged in as SUPER
+func isSuper(c *gin.Context) bool {
+	info, ok := tokenInfo(c)
+	return ok && info.HasRole(policy.Super)
+}
+
+// hasPermission reports whether any role of caller was granted permission
+func (h *HandlerV1) hasPermission(c *gin.Context, permission string) bool {
+
+	info, ok := tokenInfo(c)
+	if !ok {
+		return false
+	}
+
+	has, err := h.permissions.Has(c.Request.Context(), info.Roles, permission)
+	if err != nil {
+		log.Printf("error whiling HasPermission: %v\n", err)
+		return false
+	}
+
+	return has
+}
+
+// authorizeUser lets caller act on user id when it is that user, SUPER or holds user:write.
+// Otherwise it responds with 403 and returns false
+func (h *HandlerV1) authorizeUser(c *gin.Context, id string) bool {
+
+	if info, ok := tokenInfo(c); ok && info.UserID == id || isSuper(c) || h.hasPermission(c, "user:write") {
+		return true
+	}
+
+	forbid(c, errors.New("only the user itself may do this"))
+
+	return false
+}
+
+// authorizeRole lets only SUPER create, change, delete, assign or revoke role named SUPER, in any case since
+// tokens match it that way. Everyone else may grant only permissions it holds itself.
+// Otherwise it responds with 403 and returns false
+func (h *HandlerV1) authorizeRole(c *gin.Context, name string, permissions []string) bool {
+
+	if isSuper(c) {
+		return true
+	}
+
+	if strings.EqualFold(name, policy.Super) {
+		forbid(c, errors.New("only SUPER may grant or change SUPER role"))
+		return false
+	}
+
+	for _, permission := range permissions {
+		if !h.hasPermission(c, permission) {
+			forbid(c, fmt.Errorf("cannot grant permission %s that caller does not hold", permission))
+			return false
+		}
+	}
+
+	return true
+}
+
+// authorizePasswordChange lets SUPER set password of any user, everyone else must give current password of user.
+// Otherwise it responds with 403 and returns false
+func (h *HandlerV1) authorizePasswordChange(c *gin.Context, id, current string) bool {
+
+	if isSuper(c) {
+		return true
+	}
+
+	user, err := h.storage.User().GetByPKey(c.Request.Context(), &models.UserPrimarKey{Id: id})
+	if err != nil {
+		handleError(c, err, "error whiling GetByPKey")
+		return false
+	}
+
+	ok, err := h.checkPassword(c.Request.Context(), user, current)
+	if err != nil {
+		handleError(c, err, "error whiling checkPassword")
+		return false
+	}
+
+	if !ok {
+		forbid(c, errors.New("current_password is not correct"))
+		return false
+	}
+
+	return true
+}
+
+// authorizeWallet lets caller see wallet of user id when it is that user, SUPER or holds user:read.
+// Otherwise it responds with 403 and returns false
+func (h *HandlerV1) authorizeWallet(c *gin.Context, id string) bool {
+
+	if info, ok := tokenInfo(c); ok && info.UserID == id || isSuper(c) || h.hasPermission(c, "user:read") {
+		return true
+	}
+
+	forbid(c, errors.New("only the user itself may see their wallet"))
+
+	return false
+}
+
+var errNotOrderOwner = errors.New("only the user who placed the order may do this")
+
+// readsAllOrders reports whether caller may read orders of every user, SUPER and order:read may
+func (h *HandlerV1) readsAllOrders(c *gin.Context) bool {
+	return isSuper(c) || h.hasPermission(c, "order:read")
+}
+
+// ownsOrder reports whether caller placed order or is SUPER
+func ownsOrder(c *gin.Context, order *models.Order) bool {
+	info, ok := tokenInfo(c)
+	return ok && info.UserID == order.UserId || isSuper(c)
+}
+
+// authorizeOrder lets caller act on order id when it placed the order or is SUPER.
+// Otherwise it responds with 403, or 404 when there is no such order, and returns false
+func (h *HandlerV1) authorizeOrder(c *gin.Context, id string) bool {
+
+	if isSuper(c) {
+		return true
+	}
+
+	order, err := h.storage.Order().GetByPKey(c.Request.Context(), &models.OrderPrimarKey{Id: id})
+	if err != nil {
+		handleError(c, err, "error whiling GetByPKey")
+		return false
+	}
+
+	if !ownsOrder(c, order) {
+		forbid(c, errNotOrderOwner)
+		return false
+	}
+
+	return true
+}
+
+func forbid(c *gin.Context, err error) {
+	log.Printf("error whiling authorize: %v\n", err)
+	c.JSON(http.StatusForbidden, err.Error())
+}
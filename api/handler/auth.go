@@ -2,9 +2,9 @@ package handler
 
 import (
 	"context"
-	"crud/config"
 	"crud/models"
-	"crud/pkg/helper"
+	"crud/pkg/policy"
+	"crud/storage"
 	"errors"
 	"log"
 	"net/http"
@@ -23,6 +23,7 @@ import (
 // @Param Login body models.Login true "LoginRequestBody"
 // @Success 201 {object} models.LoginResponse "GetLoginBody"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 401 {object} string "Wrong Password"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) Login(c *gin.Context) {
 	var login models.Login
@@ -39,27 +40,98 @@ func (h *HandlerV1) Login(c *gin.Context) {
 		&models.UserPrimarKey{Login: login.Login},
 	)
 
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidInput) {
+		// same answer after same hashing work as wrong password, so logins cannot be probed
+		h.hasher.Burn(login.Password)
+		c.JSON(http.StatusUnauthorized, errors.New("error password is not correct").Error())
+		return
+	}
+
 	if err != nil {
 		log.Printf("error whiling GetByPKey: %v\n", err)
 		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
 		return
 	}
 
-	if login.Password != resp.Password {
-		c.JSON(http.StatusInternalServerError, errors.New("error password is not correct").Error())
+	ok, err := h.checkPassword(context.Background(), resp, login.Password)
+	if err != nil {
+		log.Printf("error whiling checkPassword: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling checkPassword").Error())
+		return
+	}
+
+	if !ok {
+		c.JSON(http.StatusUnauthorized, errors.New("error password is not correct").Error())
 		return
 	}
 
-	data := map[string]interface{}{
-		"user_id": resp.Id,
+	roles, err := h.storage.Role().GetUserRoles(context.Background(), resp.Id)
+	if err != nil {
+		log.Printf("error whiling GetUserRoles: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetUserRoles").Error())
+		return
 	}
 
-	token, err := helper.GenerateJWT(data, config.TimeExpiredAt, h.cfg.AuthSecretKey, h.cfg.Client)
+	tokens, err := h.issueTokens(context.Background(), resp.Id, clientRoles(roles), "")
 	if err != nil {
-		log.Printf("error whiling GenerateJWT: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling GenerateJWT").Error())
+		log.Printf("error whiling issueTokens: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling issueTokens").Error())
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.LoginResponse{AccessToken: token})
+	c.JSON(http.StatusCreated, tokens)
+}
+
+// clientRoles returns roles of user for token of /login, SUPER is only granted through /loginsuper.
+// User without other roles is CLIENT
+func clientRoles(roles []string) []string {
+
+	var client []string
+
+	for _, r := range roles {
+		if r != policy.Super {
+			client = append(client, r)
+		}
+	}
+
+	if len(client) == 0 {
+		client = []string{policy.Client}
+	}
+
+	return client
+}
+
+// checkPassword verifies password of user, legacy plaintext and outdated hashes are replaced on success.
+// User flagged for password reset never matches, though it costs as much as for any other user
+func (h *HandlerV1) checkPassword(ctx context.Context, user *models.User, password string) (bool, error) {
+
+	if user.PasswordResetRequired {
+		h.hasher.Burn(password)
+		return false, nil
+	}
+
+	ok, rehash, err := h.hasher.Verify(user.Password, password)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if !rehash {
+		return true, nil
+	}
+
+	hash, err := h.hasher.Hash(password)
+	if err != nil {
+		log.Printf("error whiling Hash: %v\n", err)
+		return true, nil
+	}
+
+	_, err = h.storage.User().UpdatePassword(ctx, &models.UpdateUserPassword{
+		Id:       user.Id,
+		Password: hash,
+	})
+	if err != nil {
+		log.Printf("error whiling UpdatePassword: %v\n", err)
+	}
+
+	return true, nil
 }
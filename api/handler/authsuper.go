@@ -2,9 +2,8 @@ package handler
 
 import (
 	"context"
-	"crud/config"
 	"crud/models"
-	"crud/pkg/helper"
+	"crud/storage"
 	"errors"
 	"log"
 	"net/http"
@@ -23,6 +22,8 @@ import (
 // @Param LoginSuper body models.Login true "LoginSuperRequestBody"
 // @Success 201 {object} models.LoginResponse "GetLoginSuperBody"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 401 {object} string "Wrong Password"
+// @Response 403 {object} string "Forbidden"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) LoginSuper(c *gin.Context) {
 	var login models.Login
@@ -39,27 +40,49 @@ func (h *HandlerV1) LoginSuper(c *gin.Context) {
 		&models.UserPrimarKey{Login: login.Login},
 	)
 
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidInput) {
+		// same answer after same hashing work as wrong password, so logins cannot be probed
+		h.hasher.Burn(login.Password)
+		c.JSON(http.StatusUnauthorized, errors.New("error password is not correct").Error())
+		return
+	}
+
 	if err != nil {
 		log.Printf("error whiling GetByPKey: %v\n", err)
 		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
 		return
 	}
 
-	if login.Password != resp.Password {
-		c.JSON(http.StatusInternalServerError, errors.New("error password is not correct").Error())
+	ok, err := h.checkPassword(context.Background(), resp, login.Password)
+	if err != nil {
+		log.Printf("error whiling checkPassword: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling checkPassword").Error())
+		return
+	}
+
+	if !ok {
+		c.JSON(http.StatusUnauthorized, errors.New("error password is not correct").Error())
+		return
+	}
+
+	roles, err := h.storage.Role().GetUserRoles(context.Background(), resp.Id)
+	if err != nil {
+		log.Printf("error whiling GetUserRoles: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetUserRoles").Error())
 		return
 	}
 
-	data := map[string]interface{}{
-		"user_id": resp.Id,
+	if !hasSuper(roles) {
+		c.JSON(http.StatusForbidden, errors.New("user is not superadmin").Error())
+		return
 	}
 
-	token, err := helper.GenerateJWT(data, config.SuperTimeExpiredAt, h.cfg.AuthSecretKey, h.cfg.SuperAdmin)
+	tokens, err := h.issueTokens(context.Background(), resp.Id, roles, "")
 	if err != nil {
-		log.Printf("error whiling GenerateJWT: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling GenerateJWT").Error())
+		log.Printf("error whiling issueTokens: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling issueTokens").Error())
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.LoginResponse{AccessToken: token})
+	c.JSON(http.StatusCreated, tokens)
 }
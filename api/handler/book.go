@@ -3,11 +3,13 @@ package handler
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 
 	"crud/models"
+	"crud/storage"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,6 +25,8 @@ import (
 // @Param book body models.CreateBook true "CreateBookRequestBody"
 // @Success 201 {object} models.Book "GetBookBody"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 409 {object} string "Conflict"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) CreateBook(c *gin.Context) {
 	var book models.CreateBook
@@ -36,8 +40,7 @@ func (h *HandlerV1) CreateBook(c *gin.Context) {
 
 	id, err := h.storage.Book().Create(context.Background(), &book)
 	if err != nil {
-		log.Printf("error whiling Create: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling Create").Error())
+		handleError(c, err, "error whiling Create")
 		return
 	}
 
@@ -47,8 +50,7 @@ func (h *HandlerV1) CreateBook(c *gin.Context) {
 	)
 
 	if err != nil {
-		log.Printf("error whiling GetByPKey: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
+		handleError(c, err, "error whiling GetByPKey")
 		return
 	}
 
@@ -64,21 +66,39 @@ func (h *HandlerV1) CreateBook(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "id"
+// @Param If-None-Match header string false "ETag of cached book, 304 when it is still current"
+// @Param include_deleted query bool false "find deleted book too, SUPER only"
 // @Success 200 {object} models.Book "GetBookBody"
+// @Header 200 {string} ETag "version of book"
+// @Response 304 {object} string "Not Modified"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) GetBookById(c *gin.Context) {
 
 	id := c.Param("id")
 
+	deleted, ok := includeDeleted(c)
+	if !ok {
+		return
+	}
+
 	resp, err := h.storage.Book().GetByPKey(
 		context.Background(),
-		&models.BookPrimarKey{Id: id},
+		&models.BookPrimarKey{Id: id, IncludeDeleted: deleted},
 	)
 
 	if err != nil {
-		log.Printf("error whiling GetByPKey: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
+		handleError(c, err, "error whiling GetByPKey")
+		return
+	}
+
+	c.Header("ETag", etag(resp.Version))
+
+	if notModified(c, resp.Version) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
@@ -95,8 +115,21 @@ func (h *HandlerV1) GetBookById(c *gin.Context) {
 // @Produce json
 // @Param offset query string false "offset"
 // @Param limit query string false "limit"
+// @Param q query string false "search in name and author_name"
+// @Param author_name query string false "author name, case insensitive"
+// @Param currency query string false "ISO 4217 currency of price"
+// @Param price_min query integer false "minimal price in minor units"
+// @Param price_max query integer false "maximal price in minor units"
+// @Param created_from query string false "created at or after, RFC 3339 or 2006-01-02"
+// @Param created_to query string false "created before, RFC 3339 or 2006-01-02"
+// @Param sort query string false "comma separated name, author_name, price, date, stock, created_at, updated_at, '-' prefix sorts descending"
+// @Param after query string false "next_cursor of previous page, cannot be combined with offset or sort"
+// @Param count query bool false "include total count in cursor mode"
+// @Param include_deleted query bool false "list deleted books too, SUPER only"
+// @Param low_stock query bool false "only books with stock at or below their low_stock_threshold, SUPER only"
 // @Success 200 {object} models.GetListBookResponse "GetBookBody"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) GetBookList(c *gin.Context) {
 	var (
@@ -125,20 +158,72 @@ func (h *HandlerV1) GetBookList(c *gin.Context) {
 		}
 	}
 
+	query, err := h.parseListQuery(c, "book")
+	if err != nil {
+		log.Printf("error whiling list query: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	currency := c.Query("currency")
+	if currency != "" && !models.ValidCurrency(currency) {
+		err = fmt.Errorf("invalid currency %q", currency)
+		log.Printf("error whiling currency: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	priceMin, err := queryInt32(c, "price_min")
+	if err != nil {
+		log.Printf("error whiling price_min: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	priceMax, err := queryInt32(c, "price_max")
+	if err != nil {
+		log.Printf("error whiling price_max: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deleted, ok := includeDeleted(c)
+	if !ok {
+		return
+	}
+
+	lowStock, ok := superFlag(c, "low_stock")
+	if !ok {
+		return
+	}
+
 	resp, err := h.storage.Book().GetList(
 		context.Background(),
 		&models.GetListBookRequest{
-			Limit:  int32(limit),
-			Offset: int32(offset),
+			Limit:          int32(limit),
+			Offset:         int32(offset),
+			Search:         query.Search,
+			AuthorName:     c.Query("author_name"),
+			Currency:       currency,
+			PriceMin:       priceMin,
+			PriceMax:       priceMax,
+			CreatedFrom:    query.CreatedFrom,
+			CreatedTo:      query.CreatedTo,
+			Sort:           query.Sort,
+			After:          query.After,
+			WithCount:      query.WithCount,
+			IncludeDeleted: deleted,
+			LowStock:       lowStock,
 		},
 	)
 
 	if err != nil {
-		log.Printf("error whiling get list: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling get list").Error())
+		handleError(c, err, "error whiling get list")
 		return
 	}
 
+	resp.NextCursor = h.nextCursor("book", resp.Next)
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -151,14 +236,21 @@ func (h *HandlerV1) GetBookList(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read book, 412 when it changed since"
 // @Param book body models.UpdateBook true "CreateBookRequestBody"
 // @Success 200 {object} models.Book "GetBooksBody"
+// @Header 200 {string} ETag "version of book"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) UpdateBook(c *gin.Context) {
 
 	var (
 		book models.UpdateBook
+		err  error
 	)
 
 	book.Id = c.Param("id")
@@ -169,7 +261,13 @@ func (h *HandlerV1) UpdateBook(c *gin.Context) {
 		return
 	}
 
-	err := c.ShouldBindJSON(&book)
+	book.Version, err = ifMatch(c)
+	if err != nil {
+		handleError(c, err, "error whiling update")
+		return
+	}
+
+	err = c.ShouldBindJSON(&book)
 	if err != nil {
 		log.Printf("error whiling update: %v\n", err)
 		c.JSON(http.StatusBadRequest, err.Error())
@@ -182,14 +280,12 @@ func (h *HandlerV1) UpdateBook(c *gin.Context) {
 	)
 
 	if err != nil {
-		log.Printf("error whiling update: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling update").Error())
+		handleError(c, err, "error whiling update")
 		return
 	}
 
 	if rowsAffected == 0 {
-		log.Printf("error whiling update rows affected: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling update rows affected").Error())
+		handleError(c, storage.ErrNotFound, "error whiling update")
 		return
 	}
 
@@ -199,11 +295,93 @@ func (h *HandlerV1) UpdateBook(c *gin.Context) {
 	)
 
 	if err != nil {
-		log.Printf("error whiling GetByPKey: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
+		handleError(c, err, "error whiling GetByPKey")
+		return
+	}
+
+	c.Header("ETag", etag(resp.Version))
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// PatchBook godoc
+// @ID patch_book
+// @Router /book/{id} [PATCH]
+// @Summary Patch Book
+// @Description Change only given fields of Book, body is JSON Merge Patch or, with fields mask, whole Book of which only masked fields change
+// @Description Members of price merge into price of Book, so {"price":{"amount":500}} keeps its currency
+// @Tags Book
+// @Accept json,application/merge-patch+json
+// @Produce json
+// @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read book, 412 when it changed since"
+// @Param fields query string false "comma separated mask of fields to change"
+// @Param book body models.PatchBook true "PatchBookRequestBody"
+// @Success 200 {object} models.Book "GetBookBody"
+// @Header 200 {string} ETag "version of book"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) PatchBook(c *gin.Context) {
+
+	var (
+		book models.PatchBook
+		err  error
+	)
+
+	book.Id = c.Param("id")
+
+	if book.Id == "" {
+		log.Printf("error whiling patch: %v\n", errors.New("required book id").Error())
+		c.JSON(http.StatusBadRequest, errors.New("required book id").Error())
+		return
+	}
+
+	book.Version, err = ifMatch(c)
+	if err != nil {
+		handleError(c, err, "error whiling patch")
+		return
+	}
+
+	// price merges into price of book as it is now
+	current, err := h.storage.Book().GetByPKey(
+		context.Background(),
+		&models.BookPrimarKey{Id: book.Id},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling GetByPKey")
 		return
 	}
 
+	err = bindPatch(c, &book, current, "name", "author_name", "price", "date", "stock", "low_stock_threshold")
+	if err != nil {
+		log.Printf("error whiling patch: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// merged price must not land on book that changed since it was read
+	if book.Version == 0 && book.Price != nil {
+		book.Version = current.Version
+	}
+
+	resp, err := h.storage.Book().Patch(
+		context.Background(),
+		&book,
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling patch")
+		return
+	}
+
+	c.Header("ETag", etag(resp.Version))
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -211,13 +389,17 @@ func (h *HandlerV1) UpdateBook(c *gin.Context) {
 // @ID delete_by_id_book
 // @Router /book/{id} [DELETE]
 // @Summary Delete By Id Book
-// @Description Delete By Id Book
+// @Description Mark Book deleted, it can be restored until purge removes it
 // @Tags Book
 // @Accept json
 // @Produce json
 // @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read book, 412 when it changed since"
 // @Success 200 {object} models.Book "GetBookBody"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 404 {object} string "Not Found"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) DeleteBook(c *gin.Context) {
 
@@ -228,18 +410,63 @@ func (h *HandlerV1) DeleteBook(c *gin.Context) {
 		return
 	}
 
-	err := h.storage.Book().Delete(
+	version, err := ifMatch(c)
+	if err != nil {
+		handleError(c, err, "error whiling delete")
+		return
+	}
+
+	err = h.storage.Book().Delete(
 		context.Background(),
 		&models.BookPrimarKey{
-			Id: id,
+			Id:      id,
+			Version: version,
 		},
 	)
 
 	if err != nil {
-		log.Printf("error whiling delete: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling delete").Error())
+		handleError(c, err, "error whiling delete")
 		return
 	}
 
 	c.JSON(http.StatusNoContent, nil)
 }
+
+// RestoreBook godoc
+// @ID restore_book
+// @Router /book/{id}/restore [POST]
+// @Summary Restore Book
+// @Description Bring deleted Book back, Book that is not deleted is returned as is
+// @Tags Book
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Success 200 {object} models.Book "GetBookBody"
+// @Header 200 {string} ETag "version of book"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) RestoreBook(c *gin.Context) {
+
+	id := c.Param("id")
+	if id == "" {
+		log.Printf("error whiling restore: %v\n", errors.New("required book id").Error())
+		c.JSON(http.StatusBadRequest, errors.New("required book id").Error())
+		return
+	}
+
+	resp, err := h.storage.Book().Restore(
+		context.Background(),
+		&models.BookPrimarKey{Id: id},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling restore")
+		return
+	}
+
+	c.Header("ETag", etag(resp.Version))
+
+	c.JSON(http.StatusOK, resp)
+}
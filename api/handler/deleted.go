@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// includeDeleted reads include_deleted query parameter, only SUPER may see deleted rows.
+// When request may not have it, it responds with 400 or 403 and returns false ok
+func includeDeleted(c *gin.Context) (include bool, ok bool) {
+	return superFlag(c, "include_deleted")
+}
+
+// superFlag reads boolean query parameter only SUPER may set. When request may not have it,
+// it responds with 400 or 403 and returns false ok
+func superFlag(c *gin.Context, name string) (set bool, ok bool) {
+
+	value := c.Query(name)
+	if value == "" {
+		return false, true
+	}
+
+	set, err := strconv.ParseBool(value)
+	if err != nil {
+		err = fmt.Errorf("%s: invalid boolean %q", name, value)
+		log.Printf("error whiling %s: %v\n", name, err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return false, false
+	}
+
+	if set && !isSuper(c) {
+		log.Printf("error whiling %s: %v\n", name, errors.New("role is not SUPER"))
+		c.JSON(http.StatusForbidden, fmt.Errorf("%s requires SUPER role", name).Error())
+		return false, false
+	}
+
+	return set, true
+}
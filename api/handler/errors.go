@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"crud/storage"
+)
+
+// handleError logs err and responds with status matching its storage error kind.
+// Unexpected errors answer 500 with message only, so database details do not leak
+func handleError(c *gin.Context, err error, message string) {
+
+	log.Printf("%s: %v\n", message, err)
+
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, storage.ErrNotFound.Error())
+	case errors.Is(err, storage.ErrConflict):
+		c.JSON(http.StatusConflict, err.Error())
+	case errors.Is(err, storage.ErrVersionMismatch):
+		c.JSON(http.StatusPreconditionFailed, storage.ErrVersionMismatch.Error())
+	case errors.Is(err, storage.ErrForeignKey), errors.Is(err, storage.ErrInvalidInput):
+		c.JSON(http.StatusUnprocessableEntity, err.Error())
+	default:
+		c.JSON(http.StatusInternalServerError, message)
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"crud/storage"
+)
+
+// etag is strong entity tag of row version
+func etag(version int32) string {
+	return `"` + strconv.FormatInt(int64(version), 10) + `"`
+}
+
+// ifMatch reads If-Match as version row must still have, zero when header is absent or * so any will do.
+// Weak or foreign tags can never match and fail right away
+func ifMatch(c *gin.Context) (int32, error) {
+
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	if strings.Contains(header, ",") {
+		return 0, fmt.Errorf("%w: If-Match must be * or one entity tag", storage.ErrInvalidInput)
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(header, `"`), 10, 32)
+	if err != nil || version <= 0 || header != etag(int32(version)) {
+		return 0, fmt.Errorf("%w: If-Match %s", storage.ErrVersionMismatch, header)
+	}
+
+	return int32(version), nil
+}
+
+// notModified reports whether If-None-Match has tag of version, compared weakly as RFC 9110 says for GET
+func notModified(c *gin.Context, version int32) bool {
+
+	header := strings.TrimSpace(c.GetHeader("If-None-Match"))
+
+	if header == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag(version) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,17 +2,31 @@ package handler
 
 import (
 	"crud/config"
+	"crud/pkg/keys"
+	"crud/pkg/password"
+	"crud/pkg/policy"
+	"crud/pkg/revocation"
 	"crud/storage"
 )
 
 type HandlerV1 struct {
 	cfg     *config.Config
 	storage storage.StorageI
+	hasher  *password.Hasher
+	revoked *revocation.Store
+	keys    *keys.Set
+
+	// permissions caches role grants for access checks, role handlers reset it when grants change
+	permissions *policy.PermissionCache
 }
 
-func NewHandlerV1(cfg *config.Config, storage storage.StorageI) *HandlerV1 {
+func NewHandlerV1(cfg *config.Config, storage storage.StorageI, hasher *password.Hasher, revoked *revocation.Store, keySet *keys.Set, permissions *policy.PermissionCache) *HandlerV1 {
 	return &HandlerV1{
-		cfg:     cfg,
-		storage: storage,
+		cfg:         cfg,
+		storage:     storage,
+		hasher:      hasher,
+		revoked:     revoked,
+		keys:        keySet,
+		permissions: permissions,
 	}
 }
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"crud/models"
+	"crud/pkg/helper"
+)
+
+// listQuery holds query parameters shared by list endpoints: q, created_from, created_to, sort,
+// after and count
+type listQuery struct {
+	Search      string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Sort        []models.SortField
+	After       *models.Cursor
+	WithCount   bool
+}
+
+// parseListQuery reads shared parameters of list, like "book", whose cursors it accepts
+func (h *HandlerV1) parseListQuery(c *gin.Context, list string) (listQuery, error) {
+
+	var (
+		query = listQuery{Search: c.Query("q")}
+		err   error
+	)
+
+	query.CreatedFrom, err = queryTime(c, "created_from")
+	if err != nil {
+		return query, err
+	}
+
+	query.CreatedTo, err = queryTime(c, "created_to")
+	if err != nil {
+		return query, err
+	}
+
+	query.Sort, err = helper.ParseSort(c.Query("sort"))
+	if err != nil {
+		return query, err
+	}
+
+	if after := c.Query("after"); after != "" {
+		if c.Query("offset") != "" {
+			return query, errors.New("after cannot be combined with offset")
+		}
+
+		query.After, err = helper.DecodeCursor(h.cursorKey(), list, after)
+		if err != nil {
+			return query, fmt.Errorf("after: %w", err)
+		}
+	}
+
+	if count := c.Query("count"); count != "" {
+		query.WithCount, err = strconv.ParseBool(count)
+		if err != nil {
+			return query, fmt.Errorf("count: invalid boolean %q", count)
+		}
+	}
+
+	return query, nil
+}
+
+// nextCursor signs cursor of next page of list, empty when there is no next page
+func (h *HandlerV1) nextCursor(list string, next *models.Cursor) string {
+
+	if next == nil {
+		return ""
+	}
+
+	return helper.EncodeCursor(h.cursorKey(), list, next)
+}
+
+// cursorKey signs list cursors, AUTH_SECRET_KEY is used when CURSOR_SECRET_KEY is not set
+func (h *HandlerV1) cursorKey() string {
+
+	if h.cfg.CursorSecretKey != "" {
+		return h.cfg.CursorSecretKey
+	}
+
+	return h.cfg.AuthSecretKey
+}
+
+// queryTime reads optional time query parameter, zero time when it is absent
+func queryTime(c *gin.Context, name string) (time.Time, error) {
+
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := helper.ParseTime(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return t, nil
+}
+
+// queryInt32 reads optional integer query parameter, nil when it is absent
+func queryInt32(c *gin.Context, name string) (*int32, error) {
+
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid integer %q", name, value)
+	}
+
+	v := int32(n)
+
+	return &v, nil
+}
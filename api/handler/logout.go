@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"crud/pkg/helper"
+)
+
+// Logout godoc
+// @ID logout
+// @Router /logout [POST]
+// @Summary Logout
+// @Description Revoke access token of request and refresh tokens of its session
+// @Tags Login
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "access token"
+// @Success 204
+// @Response 401 {object} string "Unauthorized"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) Logout(c *gin.Context) {
+
+	info, ok := tokenInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, errors.New("authorization required").Error())
+		return
+	}
+
+	err := h.revoked.Revoke(context.Background(), info)
+	if err != nil {
+		log.Printf("error whiling Revoke: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling Revoke").Error())
+		return
+	}
+
+	if info.SessionID != "" {
+		err = h.storage.RefreshToken().RevokeFamily(context.Background(), info.SessionID)
+		if err != nil {
+			log.Printf("error whiling RevokeFamily: %v\n", err)
+			c.JSON(http.StatusInternalServerError, errors.New("error whiling RevokeFamily").Error())
+			return
+		}
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// LogoutAll godoc
+// @ID logout_all
+// @Router /logout-all [POST]
+// @Summary Logout All
+// @Description Revoke every access and refresh token of the user
+// @Tags Login
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "access token"
+// @Success 204
+// @Response 401 {object} string "Unauthorized"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) LogoutAll(c *gin.Context) {
+
+	info, ok := tokenInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, errors.New("authorization required").Error())
+		return
+	}
+
+	err := h.revoked.RevokeUser(context.Background(), info.UserID)
+	if err != nil {
+		log.Printf("error whiling RevokeUser: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling RevokeUser").Error())
+		return
+	}
+
+	err = h.storage.RefreshToken().RevokeUser(context.Background(), info.UserID)
+	if err != nil {
+		log.Printf("error whiling RevokeUser: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling RevokeUser").Error())
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// tokenInfo returns token of authenticated request put by access middleware
+func tokenInfo(c *gin.Context) (helper.TokenInfo, bool) {
+	value, ok := c.Get(helper.TokenInfoKey)
+	if !ok {
+		return helper.TokenInfo{}, false
+	}
+
+	info, ok := value.(helper.TokenInfo)
+	return info, ok
+}
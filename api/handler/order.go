@@ -3,25 +3,34 @@ package handler
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
 	"crud/models"
+	"crud/storage"
 )
 
 // CreateOrder godoc
 // @ID create_order
 // @Router /order [POST]
 // @Summary Create Order
-// @Description Create Order
+// @Description Create Order of items, each keeps price its book has now. book_id alone orders one copy of the book.
+// @Description Order holds stock of its books, 409 when there is not enough, and is cancelled unless paid before reserved_until
+// @Description Books of one Order must share currency of their price, 422 otherwise. Order of caller other than SUPER
+// @Description is always their own, user_id is ignored
 // @Tags Order
 // @Accept json
 // @Produce json
 // @Param order body models.CreateOrder true "CreateOrderRequestBody"
 // @Success 201 {object} models.Order "GetOrderBody"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 409 {object} string "Conflict"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) CreateOrder(c *gin.Context) {
 	var order models.CreateOrder
@@ -33,10 +42,20 @@ func (h *HandlerV1) CreateOrder(c *gin.Context) {
 		return
 	}
 
+	// only SUPER may order for someone else
+	if info, ok := tokenInfo(c); ok {
+		order.CreatedBy = info.UserID
+
+		if !isSuper(c) {
+			order.UserId = info.UserID
+		}
+	}
+
+	order.ReservedUntil = time.Now().Add(h.cfg.ReservationTTL)
+
 	id, err := h.storage.Order().Create(context.Background(), &order)
 	if err != nil {
-		log.Printf("error whiling Create: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling Create").Error())
+		handleError(c, err, "error whiling Create")
 		return
 	}
 
@@ -46,8 +65,7 @@ func (h *HandlerV1) CreateOrder(c *gin.Context) {
 	)
 
 	if err != nil {
-		log.Printf("error whiling GetByPKey: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
+		handleError(c, err, "error whiling GetByPKey")
 		return
 	}
 
@@ -58,26 +76,49 @@ func (h *HandlerV1) CreateOrder(c *gin.Context) {
 // @ID get_by_id_order
 // @Router /order/{id} [GET]
 // @Summary Get By Id Order
-// @Description Get By Id Order
+// @Description Get By Id Order, caller other than SUPER or order:read gets only their own Order
 // @Tags Order
 // @Accept json
 // @Produce json
 // @Param id path string true "id"
+// @Param If-None-Match header string false "ETag of cached order, 304 when it is still current"
+// @Param include_deleted query bool false "find deleted order too, SUPER only"
 // @Success 200 {object} models.Order "GetOrderBody"
+// @Header 200 {string} ETag "version of order"
+// @Response 304 {object} string "Not Modified"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) GetOrderById(c *gin.Context) {
 
 	id := c.Param("id")
 
+	deleted, ok := includeDeleted(c)
+	if !ok {
+		return
+	}
+
 	resp, err := h.storage.Order().GetByPKey(
 		context.Background(),
-		&models.OrderPrimarKey{Id: id},
+		&models.OrderPrimarKey{Id: id, IncludeDeleted: deleted},
 	)
 
 	if err != nil {
-		log.Printf("error whiling GetByPKey: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
+		handleError(c, err, "error whiling GetByPKey")
+		return
+	}
+
+	if !ownsOrder(c, resp) && !h.readsAllOrders(c) {
+		forbid(c, errNotOrderOwner)
+		return
+	}
+
+	c.Header("ETag", etag(resp.Version))
+
+	if notModified(c, resp.Version) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
@@ -88,14 +129,24 @@ func (h *HandlerV1) GetOrderById(c *gin.Context) {
 // @ID get_list_order
 // @Router /order [GET]
 // @Summary Get List Order
-// @Description Get List Order
+// @Description Get List Order, caller other than SUPER or order:read gets only their own Orders whatever user_id says
 // @Tags Order
 // @Accept json
 // @Produce json
 // @Param offset query string false "offset"
 // @Param limit query string false "limit"
+// @Param book_id query string false "orders with item of the book"
+// @Param user_id query string false "user id"
+// @Param status query string false "pending, paid, shipped, delivered, cancelled or refunded"
+// @Param created_from query string false "created at or after, RFC 3339 or 2006-01-02"
+// @Param created_to query string false "created before, RFC 3339 or 2006-01-02"
+// @Param sort query string false "comma separated created_at, updated_at, '-' prefix sorts descending"
+// @Param after query string false "next_cursor of previous page, cannot be combined with offset or sort"
+// @Param count query bool false "include total count in cursor mode"
+// @Param include_deleted query bool false "list deleted orders too, SUPER only"
 // @Success 200 {object} models.GetListOrderResponse "GetOrderBody"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) GetOrderList(c *gin.Context) {
 	var (
@@ -124,20 +175,57 @@ func (h *HandlerV1) GetOrderList(c *gin.Context) {
 		}
 	}
 
+	query, err := h.parseListQuery(c, "order")
+	if err != nil {
+		log.Printf("error whiling list query: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	status := c.Query("status")
+	if status != "" && !models.ValidOrderStatus(status) {
+		err = fmt.Errorf("unknown order status %q", status)
+		log.Printf("error whiling status: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deleted, ok := includeDeleted(c)
+	if !ok {
+		return
+	}
+
+	userId := c.Query("user_id")
+
+	// everyone else lists only their own orders
+	if info, ok := tokenInfo(c); ok && !h.readsAllOrders(c) {
+		userId = info.UserID
+	}
+
 	resp, err := h.storage.Order().GetList(
 		context.Background(),
 		&models.GetListOrderRequest{
-			Limit:  int32(limit),
-			Offset: int32(offset),
+			Limit:          int32(limit),
+			Offset:         int32(offset),
+			BookId:         c.Query("book_id"),
+			UserId:         userId,
+			Status:         status,
+			CreatedFrom:    query.CreatedFrom,
+			CreatedTo:      query.CreatedTo,
+			Sort:           query.Sort,
+			After:          query.After,
+			WithCount:      query.WithCount,
+			IncludeDeleted: deleted,
 		},
 	)
 
 	if err != nil {
-		log.Printf("error whiling get list: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling get list").Error())
+		handleError(c, err, "error whiling get list")
 		return
 	}
 
+	resp.NextCursor = h.nextCursor("order", resp.Next)
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -145,19 +233,28 @@ func (h *HandlerV1) GetOrderList(c *gin.Context) {
 // @ID update_order
 // @Router /order/{id} [PUT]
 // @Summary Update Order
-// @Description Update Order
+// @Description Update Order header while it is pending, 409 after, items cannot change once order is created
+// @Description Caller other than SUPER may update only their own Order and cannot move it to other user
 // @Tags Order
 // @Accept json
 // @Produce json
 // @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read order, 412 when it changed since"
 // @Param order body models.UpdateOrder true "CreateOrderRequestBody"
 // @Success 200 {object} models.Order "GetOrdersBody"
+// @Header 200 {string} ETag "version of order"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) UpdateOrder(c *gin.Context) {
 
 	var (
 		order models.UpdateOrder
+		err   error
 	)
 
 	order.Id = c.Param("id")
@@ -168,27 +265,39 @@ func (h *HandlerV1) UpdateOrder(c *gin.Context) {
 		return
 	}
 
-	err := c.ShouldBindJSON(&order)
+	order.Version, err = ifMatch(c)
+	if err != nil {
+		handleError(c, err, "error whiling update")
+		return
+	}
+
+	err = c.ShouldBindJSON(&order)
 	if err != nil {
 		log.Printf("error whiling update: %v\n", err)
 		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
 
+	if !h.authorizeOrder(c, order.Id) {
+		return
+	}
+
+	if info, ok := tokenInfo(c); ok && !isSuper(c) {
+		order.UserId = info.UserID
+	}
+
 	rowsAffected, err := h.storage.Order().Update(
 		context.Background(),
 		&order,
 	)
 
 	if err != nil {
-		log.Printf("error whiling update: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling update").Error())
+		handleError(c, err, "error whiling update")
 		return
 	}
 
 	if rowsAffected == 0 {
-		log.Printf("error whiling update rows affected: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling update rows affected").Error())
+		handleError(c, storage.ErrNotFound, "error whiling update")
 		return
 	}
 
@@ -198,11 +307,86 @@ func (h *HandlerV1) UpdateOrder(c *gin.Context) {
 	)
 
 	if err != nil {
-		log.Printf("error whiling GetByPKey: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
+		handleError(c, err, "error whiling GetByPKey")
 		return
 	}
 
+	c.Header("ETag", etag(resp.Version))
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// PatchOrder godoc
+// @ID patch_order
+// @Router /order/{id} [PATCH]
+// @Summary Patch Order
+// @Description Change only given fields of pending Order, 409 after, body is JSON Merge Patch or, with fields mask, whole Order of which only masked fields change.
+// @Description Only SUPER may move order to other user
+// @Tags Order
+// @Accept json,application/merge-patch+json
+// @Produce json
+// @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read order, 412 when it changed since"
+// @Param fields query string false "comma separated mask of fields to change"
+// @Param order body models.PatchOrder true "PatchOrderRequestBody"
+// @Success 200 {object} models.Order "GetOrderBody"
+// @Header 200 {string} ETag "version of order"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) PatchOrder(c *gin.Context) {
+
+	var (
+		order models.PatchOrder
+		err   error
+	)
+
+	order.Id = c.Param("id")
+
+	if order.Id == "" {
+		log.Printf("error whiling patch: %v\n", errors.New("required order id").Error())
+		c.JSON(http.StatusBadRequest, errors.New("required order id").Error())
+		return
+	}
+
+	order.Version, err = ifMatch(c)
+	if err != nil {
+		handleError(c, err, "error whiling patch")
+		return
+	}
+
+	err = bindPatch(c, &order, nil, "user_id")
+	if err != nil {
+		log.Printf("error whiling patch: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if order.UserId != nil && !isSuper(c) {
+		forbid(c, errors.New("only SUPER may move order to other user"))
+		return
+	}
+
+	if !h.authorizeOrder(c, order.Id) {
+		return
+	}
+
+	resp, err := h.storage.Order().Patch(
+		context.Background(),
+		&order,
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling patch")
+		return
+	}
+
+	c.Header("ETag", etag(resp.Version))
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -210,13 +394,18 @@ func (h *HandlerV1) UpdateOrder(c *gin.Context) {
 // @ID delete_by_id_order
 // @Router /order/{id} [DELETE]
 // @Summary Delete By Id Order
-// @Description Delete By Id Order
+// @Description Mark Order deleted, it can be restored until purge removes it
 // @Tags Order
 // @Accept json
 // @Produce json
 // @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read order, 412 when it changed since"
 // @Success 200 {object} models.Order "GetOrderBody"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) DeleteOrder(c *gin.Context) {
 
@@ -227,18 +416,67 @@ func (h *HandlerV1) DeleteOrder(c *gin.Context) {
 		return
 	}
 
-	err := h.storage.Order().Delete(
+	version, err := ifMatch(c)
+	if err != nil {
+		handleError(c, err, "error whiling delete")
+		return
+	}
+
+	if !h.authorizeOrder(c, id) {
+		return
+	}
+
+	err = h.storage.Order().Delete(
 		context.Background(),
 		&models.OrderPrimarKey{
-			Id: id,
+			Id:      id,
+			Version: version,
 		},
 	)
 
 	if err != nil {
-		log.Printf("error whiling delete: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling delete").Error())
+		handleError(c, err, "error whiling delete")
 		return
 	}
 
 	c.JSON(http.StatusNoContent, nil)
 }
+
+// RestoreOrder godoc
+// @ID restore_order
+// @Router /order/{id}/restore [POST]
+// @Summary Restore Order
+// @Description Bring deleted Order back, 422 when its user or book of any item is deleted
+// @Tags Order
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Success 200 {object} models.Order "GetOrderBody"
+// @Header 200 {string} ETag "version of order"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) RestoreOrder(c *gin.Context) {
+
+	id := c.Param("id")
+	if id == "" {
+		log.Printf("error whiling restore: %v\n", errors.New("required order id").Error())
+		c.JSON(http.StatusBadRequest, errors.New("required order id").Error())
+		return
+	}
+
+	resp, err := h.storage.Order().Restore(
+		context.Background(),
+		&models.OrderPrimarKey{Id: id},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling restore")
+		return
+	}
+
+	c.Header("ETag", etag(resp.Version))
+
+	c.JSON(http.StatusOK, resp)
+}
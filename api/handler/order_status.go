@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"crud/models"
+	"crud/storage"
+)
+
+// PayOrder godoc
+// @ID pay_order
+// @Router /order/{id}/pay [POST]
+// @Summary Pay Order
+// @Description Move pending Order to paid debiting Wallet of its User, it keeps its stock for good. 409 from any other status, when balance is too low or when Order is priced in other currency than wallets hold
+// @Description Caller other than SUPER may do it only to their own Order
+// @Tags Order
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read order, 412 when it changed since"
+// @Success 200 {object} models.Order "GetOrderBody"
+// @Header 200 {string} ETag "version of order"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) PayOrder(c *gin.Context) {
+	h.transitionOrder(c, models.OrderPaid)
+}
+
+// ShipOrder godoc
+// @ID ship_order
+// @Router /order/{id}/ship [POST]
+// @Summary Ship Order
+// @Description Move paid Order to shipped, 409 from any other status
+// @Tags Order
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read order, 412 when it changed since"
+// @Success 200 {object} models.Order "GetOrderBody"
+// @Header 200 {string} ETag "version of order"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) ShipOrder(c *gin.Context) {
+	h.transitionOrder(c, models.OrderShipped)
+}
+
+// DeliverOrder godoc
+// @ID deliver_order
+// @Router /order/{id}/deliver [POST]
+// @Summary Deliver Order
+// @Description Move shipped Order to delivered, 409 from any other status
+// @Tags Order
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read order, 412 when it changed since"
+// @Success 200 {object} models.Order "GetOrderBody"
+// @Header 200 {string} ETag "version of order"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) DeliverOrder(c *gin.Context) {
+	h.transitionOrder(c, models.OrderDelivered)
+}
+
+// CancelOrder godoc
+// @ID cancel_order
+// @Router /order/{id}/cancel [POST]
+// @Summary Cancel Order
+// @Description Move pending Order to cancelled giving its stock back, 409 from any other status
+// @Description Caller other than SUPER may do it only to their own Order
+// @Tags Order
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read order, 412 when it changed since"
+// @Success 200 {object} models.Order "GetOrderBody"
+// @Header 200 {string} ETag "version of order"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) CancelOrder(c *gin.Context) {
+	h.transitionOrder(c, models.OrderCancelled)
+}
+
+// RefundOrder godoc
+// @ID refund_order
+// @Router /order/{id}/refund [POST]
+// @Summary Refund Order
+// @Description Move paid or delivered Order to refunded crediting back what it took from Wallet, 409 from any other status
+// @Tags Order
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read order, 412 when it changed since"
+// @Success 200 {object} models.Order "GetOrderBody"
+// @Header 200 {string} ETag "version of order"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) RefundOrder(c *gin.Context) {
+	h.transitionOrder(c, models.OrderRefunded)
+}
+
+// GetOrderHistory godoc
+// @ID get_order_history
+// @Router /order/{id}/history [GET]
+// @Summary Get Order History
+// @Description Status changes of Order oldest first, with who made them and when. Caller other than SUPER or order:read
+// @Description gets them only for their own Order
+// @Tags Order
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Param include_deleted query bool false "find deleted order too, SUPER only"
+// @Success 200 {object} []models.OrderStatusChange "OrderHistoryBody"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) GetOrderHistory(c *gin.Context) {
+
+	id := c.Param("id")
+
+	deleted, ok := includeDeleted(c)
+	if !ok {
+		return
+	}
+
+	if !h.readsAllOrders(c) && !h.authorizeOrder(c, id) {
+		return
+	}
+
+	resp, err := h.storage.Order().GetStatusHistory(
+		context.Background(),
+		&models.OrderPrimarKey{Id: id, IncludeDeleted: deleted},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling GetStatusHistory")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// transitionOrder moves order of request to status as caller
+func (h *HandlerV1) transitionOrder(c *gin.Context, status string) {
+
+	var (
+		req = models.OrderTransition{Id: c.Param("id"), Status: status}
+		err error
+	)
+
+	if req.Id == "" {
+		log.Printf("error whiling transition: %v\n", errors.New("required order id").Error())
+		c.JSON(http.StatusBadRequest, errors.New("required order id").Error())
+		return
+	}
+
+	req.Version, err = ifMatch(c)
+	if err != nil {
+		handleError(c, err, "error whiling transition")
+		return
+	}
+
+	if info, ok := tokenInfo(c); ok {
+		req.ChangedBy = info.UserID
+	}
+
+	var resp *models.Order
+
+	// paying writes ledger entries, they commit or roll back with the transition
+	err = h.storage.WithTx(context.Background(), func(tx storage.StorageI) error {
+
+		order, err := tx.Order().GetByPKey(context.Background(), &models.OrderPrimarKey{Id: req.Id})
+		if err != nil {
+			return err
+		}
+
+		if !ownsOrder(c, order) {
+			return errNotOrderOwner
+		}
+
+		resp, err = tx.Order().Transition(
+			context.Background(),
+			&req,
+		)
+		return err
+	})
+
+	if errors.Is(err, errNotOrderOwner) {
+		forbid(c, err)
+		return
+	}
+
+	if err != nil {
+		handleError(c, err, "error whiling transition")
+		return
+	}
+
+	c.Header("ETag", etag(resp.Version))
+
+	c.JSON(http.StatusOK, resp)
+}
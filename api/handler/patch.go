@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindPatch reads PATCH body into patch, struct of pointers named by json tags of fields.
+// Body is JSON Merge Patch (RFC 7396): members present change, absent ones stay and unknown ones are rejected.
+// Object members merge into same member of current, resource as read by GET, so {"price":{"amount":5}} keeps
+// currency. Current may be nil when no field is object.
+// With ?fields=a,b mask body is whole resource, as read by GET with id, version and the like, and only masked
+// fields of it change while other members are ignored. Null is rejected since none of the fields can be removed
+func bindPatch(c *gin.Context, patch interface{}, current interface{}, fields ...string) error {
+
+	var (
+		body    map[string]json.RawMessage
+		allowed = map[string]bool{}
+	)
+
+	for _, field := range fields {
+		allowed[field] = true
+	}
+
+	err := json.NewDecoder(c.Request.Body).Decode(&body)
+	if err != nil || body == nil {
+		return errors.New("patch must be JSON object")
+	}
+
+	if mask := c.Query("fields"); mask != "" {
+		masked := map[string]json.RawMessage{}
+
+		for _, field := range strings.Split(mask, ",") {
+			field = strings.TrimSpace(field)
+
+			if !allowed[field] {
+				return fmt.Errorf("fields: unknown field %q", field)
+			}
+
+			value, ok := body[field]
+			if !ok {
+				return fmt.Errorf("fields: %q is missing from body", field)
+			}
+
+			masked[field] = value
+		}
+
+		body = masked
+	} else {
+		for field := range body {
+			if !allowed[field] {
+				return fmt.Errorf("unknown field %q", field)
+			}
+		}
+
+		err = mergeObjects(body, current)
+		if err != nil {
+			return err
+		}
+	}
+
+	for field, value := range body {
+		if isNull(value) {
+			return fmt.Errorf("%s cannot be null", field)
+		}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, patch)
+}
+
+// mergeObjects replaces object members of body with them merged into same members of current
+func mergeObjects(body map[string]json.RawMessage, current interface{}) error {
+
+	var members map[string]json.RawMessage
+
+	if current != nil {
+		data, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(data, &members)
+		if err != nil {
+			return err
+		}
+	}
+
+	for field, value := range body {
+		if isNull(value) {
+			continue
+		}
+
+		merged, err := mergePatch(members[field], value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", field, err)
+		}
+
+		body[field] = merged
+	}
+
+	return nil
+}
+
+// mergePatch applies patch to target like RFC 7396 does, object merges member by member and null member
+// removes it. Anything else replaces target
+func mergePatch(target, patch json.RawMessage) (json.RawMessage, error) {
+
+	var patchMembers map[string]json.RawMessage
+
+	if json.Unmarshal(patch, &patchMembers) != nil || patchMembers == nil {
+		return patch, nil
+	}
+
+	var targetMembers map[string]json.RawMessage
+
+	if json.Unmarshal(target, &targetMembers) != nil || targetMembers == nil {
+		targetMembers = map[string]json.RawMessage{}
+	}
+
+	for member, value := range patchMembers {
+		if isNull(value) {
+			delete(targetMembers, member)
+			continue
+		}
+
+		merged, err := mergePatch(targetMembers[member], value)
+		if err != nil {
+			return nil, err
+		}
+
+		targetMembers[member] = merged
+	}
+
+	return json.Marshal(targetMembers)
+}
+
+func isNull(value json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"crud/models"
+)
+
+func patchContext(target, body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("PATCH", target, strings.NewReader(body))
+	return c
+}
+
+func TestBindPatch(t *testing.T) {
+
+	current := &models.Book{Name: "Dune", Price: models.Money{Amount: 1250, Currency: "EUR"}, Stock: 3}
+	fields := []string{"name", "price", "stock"}
+
+	for _, c := range []struct {
+		name, target, body string
+		want               models.Money
+		wantErr            bool
+	}{
+		{name: "amount only keeps currency", target: "/book/1", body: `{"price":{"amount":500}}`, want: models.Money{Amount: 500, Currency: "EUR"}},
+		{name: "currency only keeps amount", target: "/book/1", body: `{"price":{"currency":"USD"}}`, want: models.Money{Amount: 1250, Currency: "USD"}},
+		{name: "whole price", target: "/book/1", body: `{"price":{"amount":7,"currency":"GBP"}}`, want: models.Money{Amount: 7, Currency: "GBP"}},
+		{name: "bare number replaces", target: "/book/1", body: `{"price":500}`, want: models.Money{Amount: 500, Currency: models.DefaultCurrency}},
+		{name: "null member removes it", target: "/book/1", body: `{"price":{"currency":null}}`, want: models.Money{Amount: 1250}},
+		{name: "mask replaces whole price", target: "/book/1?fields=price", body: `{"name":"x","price":{"amount":9}}`, want: models.Money{Amount: 9}},
+		{name: "unknown field", target: "/book/1", body: `{"version":2}`, wantErr: true},
+		{name: "null field", target: "/book/1", body: `{"price":null}`, wantErr: true},
+		{name: "not object", target: "/book/1", body: `[1]`, wantErr: true},
+	} {
+		var patch models.PatchBook
+
+		err := bindPatch(patchContext(c.target, c.body), &patch, current, fields...)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: bindPatch error = %v, want error %v", c.name, err, c.wantErr)
+			continue
+		}
+
+		if c.wantErr {
+			continue
+		}
+
+		if patch.Price == nil || *patch.Price != c.want {
+			t.Errorf("%s: bindPatch price = %v, want %v", c.name, patch.Price, c.want)
+		}
+
+		if patch.Name != nil || patch.Stock != nil {
+			t.Errorf("%s: bindPatch set fields missing from patch", c.name)
+		}
+	}
+
+	if current.Price != (models.Money{Amount: 1250, Currency: "EUR"}) {
+		t.Errorf("bindPatch changed current to %v", current.Price)
+	}
+}
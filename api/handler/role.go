@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"crud/models"
+	"crud/storage"
+)
+
+// CreateRole godoc
+// @ID create_role
+// @Router /role [POST]
+// @Summary Create Role
+// @Description Create Role, caller other than SUPER may give it only permissions it holds and cannot name it SUPER
+// @Tags Role
+// @Accept json
+// @Produce json
+// @Param role body models.CreateRole true "CreateRoleRequestBody"
+// @Success 201 {object} models.Role "GetRoleBody"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 409 {object} string "Conflict"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) CreateRole(c *gin.Context) {
+	var role models.CreateRole
+
+	err := c.ShouldBindJSON(&role)
+	if err != nil {
+		log.Printf("error whiling create: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !h.authorizeRole(c, role.Name, role.Permissions) {
+		return
+	}
+
+	id, err := h.storage.Role().Create(context.Background(), &role)
+	if err != nil {
+		handleError(c, err, "error whiling Create")
+		return
+	}
+
+	h.permissions.Reset()
+
+	resp, err := h.storage.Role().GetByPKey(
+		context.Background(),
+		&models.RolePrimarKey{Id: id},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling GetByPKey")
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GetByIdRole godoc
+// @ID get_by_id_role
+// @Router /role/{id} [GET]
+// @Summary Get By Id Role
+// @Description Get By Id Role
+// @Tags Role
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Success 200 {object} models.Role "GetRoleBody"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) GetRoleById(c *gin.Context) {
+
+	id := c.Param("id")
+
+	resp, err := h.storage.Role().GetByPKey(
+		context.Background(),
+		&models.RolePrimarKey{Id: id},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling GetByPKey")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetListRole godoc
+// @ID get_list_role
+// @Router /role [GET]
+// @Summary Get List Role
+// @Description Get List Role
+// @Tags Role
+// @Accept json
+// @Produce json
+// @Param offset query string false "offset"
+// @Param limit query string false "limit"
+// @Success 200 {object} models.GetListRoleResponse "GetRoleBody"
+// @Response 400 {object} string "Invalid Argument"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) GetRoleList(c *gin.Context) {
+	var (
+		limit  int
+		offset int
+		err    error
+	)
+
+	limitStr := c.Query("limit")
+	if limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			log.Printf("error whiling limit: %v\n", err)
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	offsetStr := c.Query("offset")
+	if offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil {
+			log.Printf("error whiling limit: %v\n", err)
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	resp, err := h.storage.Role().GetList(
+		context.Background(),
+		&models.GetListRoleRequest{
+			Limit:  int32(limit),
+			Offset: int32(offset),
+		},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling get list")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateRole godoc
+// @ID update_role
+// @Router /role/{id} [PUT]
+// @Summary Update Role
+// @Description Update Role, permissions are replaced by the given list. Caller other than SUPER may add only
+// @Description permissions it holds and cannot change SUPER role
+// @Tags Role
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Param role body models.UpdateRole true "UpdateRoleRequestBody"
+// @Success 200 {object} models.Role "GetRoleBody"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) UpdateRole(c *gin.Context) {
+
+	var (
+		role models.UpdateRole
+	)
+
+	role.Id = c.Param("id")
+
+	if role.Id == "" {
+		log.Printf("error whiling update: %v\n", errors.New("required role id").Error())
+		c.JSON(http.StatusBadRequest, errors.New("required role id").Error())
+		return
+	}
+
+	err := c.ShouldBindJSON(&role)
+	if err != nil {
+		log.Printf("error whiling update: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	current, err := h.storage.Role().GetByPKey(
+		context.Background(),
+		&models.RolePrimarKey{Id: role.Id},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling GetByPKey")
+		return
+	}
+
+	// permissions role keeps were granted already, only added ones are checked
+	if !h.authorizeRole(c, current.Name, nil) || !h.authorizeRole(c, role.Name, addedPermissions(current.Permissions, role.Permissions)) {
+		return
+	}
+
+	rowsAffected, err := h.storage.Role().Update(
+		context.Background(),
+		&role,
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling update")
+		return
+	}
+
+	if rowsAffected == 0 {
+		handleError(c, storage.ErrNotFound, "error whiling update")
+		return
+	}
+
+	h.permissions.Reset()
+
+	resp, err := h.storage.Role().GetByPKey(
+		context.Background(),
+		&models.RolePrimarKey{Id: role.Id},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling GetByPKey")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteByIdRole godoc
+// @ID delete_by_id_role
+// @Router /role/{id} [DELETE]
+// @Summary Delete By Id Role
+// @Description Delete By Id Role, only SUPER may delete SUPER role
+// @Tags Role
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Success 204
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) DeleteRole(c *gin.Context) {
+
+	id := c.Param("id")
+	if id == "" {
+		log.Printf("error whiling delete: %v\n", errors.New("required role id").Error())
+		c.JSON(http.StatusBadRequest, errors.New("required role id").Error())
+		return
+	}
+
+	current, err := h.storage.Role().GetByPKey(
+		context.Background(),
+		&models.RolePrimarKey{Id: id},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling GetByPKey")
+		return
+	}
+
+	if !h.authorizeRole(c, current.Name, nil) {
+		return
+	}
+
+	err = h.storage.Role().Delete(
+		context.Background(),
+		&models.RolePrimarKey{
+			Id: id,
+		},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling delete")
+		return
+	}
+
+	h.permissions.Reset()
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// AssignUserRole godoc
+// @ID assign_user_role
+// @Router /user/{id}/role [POST]
+// @Summary Assign Role To User
+// @Description Assign Role To User, caller other than SUPER must hold every permission of the role and cannot assign SUPER
+// @Tags Role
+// @Accept json
+// @Produce json
+// @Param id path string true "user id"
+// @Param role body models.UserRole true "UserRoleRequestBody"
+// @Success 204
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) AssignUserRole(c *gin.Context) {
+	var userRole models.UserRole
+
+	err := c.ShouldBindJSON(&userRole)
+	if err != nil {
+		log.Printf("error whiling assign role: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userRole.UserId = c.Param("id")
+
+	// user gets every permission of role, caller must hold them all
+	role, err := h.storage.Role().GetByPKey(
+		context.Background(),
+		&models.RolePrimarKey{Name: userRole.Role},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling GetByPKey")
+		return
+	}
+
+	if !h.authorizeRole(c, role.Name, role.Permissions) {
+		return
+	}
+
+	err = h.storage.Role().AssignToUser(context.Background(), &userRole)
+	if err != nil {
+		handleError(c, err, "error whiling AssignToUser")
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// RevokeUserRole godoc
+// @ID revoke_user_role
+// @Router /user/{id}/role/{role} [DELETE]
+// @Summary Revoke Role From User
+// @Description Revoke Role From User, only SUPER may revoke SUPER
+// @Tags Role
+// @Accept json
+// @Produce json
+// @Param id path string true "user id"
+// @Param role path string true "role name"
+// @Success 204
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) RevokeUserRole(c *gin.Context) {
+
+	if !h.authorizeRole(c, c.Param("role"), nil) {
+		return
+	}
+
+	err := h.storage.Role().RevokeFromUser(
+		context.Background(),
+		&models.UserRole{
+			UserId: c.Param("id"),
+			Role:   c.Param("role"),
+		},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling RevokeFromUser")
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// addedPermissions returns permissions of next that are not in current
+func addedPermissions(current, next []string) []string {
+
+	held := make(map[string]bool, len(current))
+	for _, permission := range current {
+		held[permission] = true
+	}
+
+	var added []string
+	for _, permission := range next {
+		if !held[permission] {
+			added = append(added, permission)
+		}
+	}
+
+	return added
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"crud/models"
+	"crud/pkg/helper"
+	"crud/pkg/policy"
+	"crud/storage"
+)
+
+// RefreshToken godoc
+// @ID refresh_token
+// @Router /token/refresh [POST]
+// @Summary Refresh Token
+// @Description Exchange refresh token for new access and refresh tokens with current roles of user, reused refresh token
+// @Description or refresh token of deleted user revokes whole token family
+// @Tags Login
+// @Accept json
+// @Produce json
+// @Param token body models.RefreshTokenRequest true "RefreshTokenRequestBody"
+// @Success 201 {object} models.LoginResponse "GetLoginBody"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 401 {object} string "Invalid Refresh Token"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		log.Printf("error whiling refresh: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkey := &models.RefreshTokenPrimarKey{TokenHash: helper.HashRefreshToken(req.RefreshToken)}
+
+	token, err := h.storage.RefreshToken().GetByPKey(context.Background(), pkey)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, errors.New("invalid refresh token").Error())
+		return
+	}
+
+	if err != nil {
+		log.Printf("error whiling GetByPKey: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
+		return
+	}
+
+	if token.UsedAt != nil || token.RevokedAt != nil {
+		h.revokeTokenFamily(token)
+		c.JSON(http.StatusUnauthorized, errors.New("refresh token reuse detected").Error())
+		return
+	}
+
+	if time.Now().UTC().After(token.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, errors.New("refresh token expired").Error())
+		return
+	}
+
+	rowsAffected, err := h.storage.RefreshToken().Use(context.Background(), pkey)
+	if err != nil {
+		log.Printf("error whiling Use: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling Use").Error())
+		return
+	}
+
+	// token was used concurrently by someone else
+	if rowsAffected == 0 {
+		h.revokeTokenFamily(token)
+		c.JSON(http.StatusUnauthorized, errors.New("refresh token reuse detected").Error())
+		return
+	}
+
+	_, err = h.storage.User().GetByPKey(context.Background(), &models.UserPrimarKey{Id: token.UserId})
+	if errors.Is(err, storage.ErrNotFound) {
+		h.revokeTokenFamily(token)
+		c.JSON(http.StatusUnauthorized, errors.New("user no longer exists").Error())
+		return
+	}
+	if err != nil {
+		log.Printf("error whiling GetByPKey: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
+		return
+	}
+
+	roles, err := h.storage.Role().GetUserRoles(context.Background(), token.UserId)
+	if err != nil {
+		log.Printf("error whiling GetUserRoles: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetUserRoles").Error())
+		return
+	}
+
+	// roles granted or revoked since login apply now, SUPER stays only in sessions of /loginsuper
+	if !hasSuper(strings.Split(token.Role, ",")) || !hasSuper(roles) {
+		roles = clientRoles(roles)
+	}
+
+	resp, err := h.issueTokens(context.Background(), token.UserId, roles, token.FamilyId)
+	if err != nil {
+		log.Printf("error whiling issueTokens: %v\n", err)
+		c.JSON(http.StatusInternalServerError, errors.New("error whiling issueTokens").Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// issueTokens creates access token with every role of roles and refresh token of given family, empty
+// familyId starts new family. Family id is put into access token as sid claim so logout can revoke
+// the refresh tokens
+func (h *HandlerV1) issueTokens(ctx context.Context, userId string, roles []string, familyId string) (*models.LoginResponse, error) {
+
+	var expiredAt = h.cfg.AccessTokenTTL
+
+	if hasSuper(roles) {
+		expiredAt = h.cfg.SuperAccessTokenTTL
+	}
+
+	if familyId == "" {
+		familyId = uuid.New().String()
+	}
+
+	data := map[string]interface{}{
+		"user_id": userId,
+		"roles":   roles,
+		"sid":     familyId,
+		"iss":     h.cfg.JWTIssuer,
+		"aud":     h.cfg.JWTAudience,
+	}
+
+	accessToken, err := helper.GenerateJWT(data, expiredAt, h.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := helper.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = h.storage.RefreshToken().Create(ctx, &models.CreateRefreshToken{
+		FamilyId:  familyId,
+		UserId:    userId,
+		TokenHash: hash,
+		Role:      strings.Join(roles, ","),
+		ExpiresAt: time.Now().UTC().Add(h.cfg.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+func hasSuper(roles []string) bool {
+
+	for _, role := range roles {
+		if role == policy.Super {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *HandlerV1) revokeTokenFamily(token *models.RefreshToken) {
+	err := h.storage.RefreshToken().RevokeFamily(context.Background(), token.FamilyId)
+	if err != nil {
+		log.Printf("error whiling RevokeFamily: %v\n", err)
+	}
+}
+
+// JWKS godoc
+// @ID jwks
+// @Router /.well-known/jwks.json [GET]
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens, selected by kid header of token
+// @Tags Login
+// @Produce json
+// @Success 200 {object} keys.JWKS "JWKS"
+func (h *HandlerV1) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
@@ -6,9 +6,13 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
 	"crud/models"
+	"crud/pkg/password"
+	"crud/storage"
 )
 
 // CreateUser godoc
@@ -22,6 +26,8 @@ import (
 // @Param user body models.CreateUser true "CreateUserRequestBody"
 // @Success 201 {object} models.User "GetUserBody"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 409 {object} string "Conflict"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) CreateUser(c *gin.Context) {
 	var user models.CreateUser
@@ -33,21 +39,38 @@ func (h *HandlerV1) CreateUser(c *gin.Context) {
 		return
 	}
 
-	id, err := h.storage.User().Create(context.Background(), &user)
+	err = password.Validate(user.Password)
 	if err != nil {
-		log.Printf("error whiling Create: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling Create").Error())
+		log.Printf("error whiling create: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
 
-	resp, err := h.storage.User().GetByPKey(
-		context.Background(),
-		&models.UserPrimarKey{Id: id},
-	)
+	user.Password, err = h.hasher.Hash(user.Password)
+	if err != nil {
+		handleError(c, err, "error whiling Hash")
+		return
+	}
+
+	var resp *models.User
+
+	err = h.storage.WithTx(context.Background(), func(tx storage.StorageI) error {
+
+		id, err := tx.User().Create(context.Background(), &user)
+		if err != nil {
+			return err
+		}
+
+		resp, err = tx.User().GetByPKey(
+			context.Background(),
+			&models.UserPrimarKey{Id: id},
+		)
+
+		return err
+	})
 
 	if err != nil {
-		log.Printf("error whiling GetByPKey: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
+		handleError(c, err, "error whiling Create")
 		return
 	}
 
@@ -58,26 +81,48 @@ func (h *HandlerV1) CreateUser(c *gin.Context) {
 // @ID get_by_id_user
 // @Router /user/{id} [GET]
 // @Summary Get By Id User
-// @Description Get By Id User
+// @Description Get By Id User, only the user itself, SUPER or user:write may read it
 // @Tags User
 // @Accept json
 // @Produce json
 // @Param id path string true "id"
+// @Param If-None-Match header string false "ETag of cached user, 304 when it is still current"
+// @Param include_deleted query bool false "find deleted user too, SUPER only"
 // @Success 200 {object} models.User "GetUserBody"
+// @Header 200 {string} ETag "version of user"
+// @Response 304 {object} string "Not Modified"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) GetUserById(c *gin.Context) {
 
 	id := c.Param("id")
 
+	if !h.authorizeUser(c, id) {
+		return
+	}
+
+	deleted, ok := includeDeleted(c)
+	if !ok {
+		return
+	}
+
 	resp, err := h.storage.User().GetByPKey(
 		context.Background(),
-		&models.UserPrimarKey{Id: id},
+		&models.UserPrimarKey{Id: id, IncludeDeleted: deleted},
 	)
 
 	if err != nil {
-		log.Printf("error whiling GetByPKey: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
+		handleError(c, err, "error whiling GetByPKey")
+		return
+	}
+
+	c.Header("ETag", etag(resp.Version))
+
+	if notModified(c, resp.Version) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
@@ -94,8 +139,17 @@ func (h *HandlerV1) GetUserById(c *gin.Context) {
 // @Produce json
 // @Param offset query string false "offset"
 // @Param limit query string false "limit"
+// @Param q query string false "search in first_name, last_name, login and phone_number"
+// @Param login query string false "exact login"
+// @Param created_from query string false "created at or after, RFC 3339 or 2006-01-02"
+// @Param created_to query string false "created before, RFC 3339 or 2006-01-02"
+// @Param sort query string false "comma separated first_name, last_name, login, created_at, updated_at, '-' prefix sorts descending"
+// @Param after query string false "next_cursor of previous page, cannot be combined with offset or sort"
+// @Param count query bool false "include total count in cursor mode"
+// @Param include_deleted query bool false "list deleted users too, SUPER only"
 // @Success 200 {object} models.GetListUserResponse "GetUserBody"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) GetUserList(c *gin.Context) {
 	var (
@@ -124,20 +178,41 @@ func (h *HandlerV1) GetUserList(c *gin.Context) {
 		}
 	}
 
+	query, err := h.parseListQuery(c, "user")
+	if err != nil {
+		log.Printf("error whiling list query: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deleted, ok := includeDeleted(c)
+	if !ok {
+		return
+	}
+
 	resp, err := h.storage.User().GetList(
 		context.Background(),
 		&models.GetListUserRequest{
-			Limit:  int32(limit),
-			Offset: int32(offset),
+			Limit:          int32(limit),
+			Offset:         int32(offset),
+			Search:         query.Search,
+			Login:          c.Query("login"),
+			CreatedFrom:    query.CreatedFrom,
+			CreatedTo:      query.CreatedTo,
+			Sort:           query.Sort,
+			After:          query.After,
+			WithCount:      query.WithCount,
+			IncludeDeleted: deleted,
 		},
 	)
 
 	if err != nil {
-		log.Printf("error whiling get list: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling get list").Error())
+		handleError(c, err, "error whiling get list")
 		return
 	}
 
+	resp.NextCursor = h.nextCursor("user", resp.Next)
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -145,19 +220,28 @@ func (h *HandlerV1) GetUserList(c *gin.Context) {
 // @ID update_user
 // @Router /user/{id} [PUT]
 // @Summary Update User
-// @Description Update User
+// @Description Update User, only the user itself, SUPER or user:write may change it. Callers other than SUPER
+// @Description must give current_password
 // @Tags User
 // @Accept json
 // @Produce json
 // @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read user, 412 when it changed since"
 // @Param user body models.UpdateUser true "CreateUserRequestBody"
 // @Success 200 {object} models.User "GetUsersBody"
+// @Header 200 {string} ETag "version of user"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) UpdateUser(c *gin.Context) {
 
 	var (
 		user models.UpdateUser
+		err  error
 	)
 
 	user.Id = c.Param("id")
@@ -168,27 +252,52 @@ func (h *HandlerV1) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	err := c.ShouldBindJSON(&user)
+	if !h.authorizeUser(c, user.Id) {
+		return
+	}
+
+	user.Version, err = ifMatch(c)
+	if err != nil {
+		handleError(c, err, "error whiling update")
+		return
+	}
+
+	err = c.ShouldBindJSON(&user)
+	if err != nil {
+		log.Printf("error whiling update: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = password.Validate(user.Password)
 	if err != nil {
 		log.Printf("error whiling update: %v\n", err)
 		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
 
+	if !h.authorizePasswordChange(c, user.Id, user.CurrentPassword) {
+		return
+	}
+
+	user.Password, err = h.hasher.Hash(user.Password)
+	if err != nil {
+		handleError(c, err, "error whiling Hash")
+		return
+	}
+
 	rowsAffected, err := h.storage.User().Update(
 		context.Background(),
 		&user,
 	)
 
 	if err != nil {
-		log.Printf("error whiling update: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling update").Error())
+		handleError(c, err, "error whiling update")
 		return
 	}
 
 	if rowsAffected == 0 {
-		log.Printf("error whiling update rows affected: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling update rows affected").Error())
+		handleError(c, storage.ErrNotFound, "error whiling update")
 		return
 	}
 
@@ -198,11 +307,107 @@ func (h *HandlerV1) UpdateUser(c *gin.Context) {
 	)
 
 	if err != nil {
-		log.Printf("error whiling GetByPKey: %v\n", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling GetByPKey").Error())
+		handleError(c, err, "error whiling GetByPKey")
 		return
 	}
 
+	c.Header("ETag", etag(resp.Version))
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// PatchUser godoc
+// @ID patch_user
+// @Router /user/{id} [PATCH]
+// @Summary Patch User
+// @Description Change only given fields of User, body is JSON Merge Patch or, with fields mask, whole User of which only masked fields change.
+// @Description Only the user itself, SUPER or user:write may change it, password changes need current_password unless caller is SUPER
+// @Tags User
+// @Accept json,application/merge-patch+json
+// @Produce json
+// @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read user, 412 when it changed since"
+// @Param fields query string false "comma separated mask of fields to change"
+// @Param user body models.PatchUser true "PatchUserRequestBody"
+// @Success 200 {object} models.User "GetUserBody"
+// @Header 200 {string} ETag "version of user"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) PatchUser(c *gin.Context) {
+
+	var (
+		user models.PatchUser
+		err  error
+	)
+
+	user.Id = c.Param("id")
+
+	if user.Id == "" {
+		log.Printf("error whiling patch: %v\n", errors.New("required user id").Error())
+		c.JSON(http.StatusBadRequest, errors.New("required user id").Error())
+		return
+	}
+
+	if !h.authorizeUser(c, user.Id) {
+		return
+	}
+
+	user.Version, err = ifMatch(c)
+	if err != nil {
+		handleError(c, err, "error whiling patch")
+		return
+	}
+
+	err = bindPatch(c, &user, nil, "first_name", "last_name", "login", "password", "phone_number", "current_password")
+	if err != nil {
+		log.Printf("error whiling patch: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if user.Password != nil {
+		err = password.Validate(*user.Password)
+		if err != nil {
+			log.Printf("error whiling patch: %v\n", err)
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var current string
+		if user.CurrentPassword != nil {
+			current = *user.CurrentPassword
+		}
+
+		if !h.authorizePasswordChange(c, user.Id, current) {
+			return
+		}
+
+		hash, err := h.hasher.Hash(*user.Password)
+		if err != nil {
+			handleError(c, err, "error whiling Hash")
+			return
+		}
+
+		user.Password = &hash
+	}
+
+	resp, err := h.storage.User().Patch(
+		context.Background(),
+		&user,
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling patch")
+		return
+	}
+
+	c.Header("ETag", etag(resp.Version))
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -210,13 +415,18 @@ func (h *HandlerV1) UpdateUser(c *gin.Context) {
 // @ID delete_by_id_user
 // @Router /user/{id} [DELETE]
 // @Summary Delete By Id User
-// @Description Delete By Id User
+// @Description Mark User deleted and revoke its sessions, it can be restored until purge removes it. Only the user itself, SUPER or user:write may delete it
 // @Tags User
 // @Accept json
 // @Produce json
 // @Param id path string true "id"
+// @Param If-Match header string false "ETag of last read user, 412 when it changed since"
 // @Success 200 {object} models.User "GetUserBody"
 // @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 412 {object} string "Precondition Failed"
+// @Response 422 {object} string "Invalid Input"
 // @Failure 500 {object} string "Server Error"
 func (h *HandlerV1) DeleteUser(c *gin.Context) {
 
@@ -227,18 +437,91 @@ func (h *HandlerV1) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	err := h.storage.User().Delete(
+	if !h.authorizeUser(c, id) {
+		return
+	}
+
+	version, err := ifMatch(c)
+	if err != nil {
+		handleError(c, err, "error whiling delete")
+		return
+	}
+
+	revokedBefore := time.Now().UTC()
+
+	// deleted user keeps its rows until purge, sessions must not outlive it
+	err = h.storage.WithTx(context.Background(), func(tx storage.StorageI) error {
+
+		err := tx.User().Delete(
+			context.Background(),
+			&models.UserPrimarKey{
+				Id:      id,
+				Version: version,
+			},
+		)
+
+		if err != nil {
+			return err
+		}
+
+		err = tx.Revocation().RevokeUser(context.Background(), &models.RevokeUserTokens{
+			UserId:        id,
+			RevokedBefore: revokedBefore,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return tx.RefreshToken().RevokeUser(context.Background(), id)
+	})
+
+	if err != nil {
+		handleError(c, err, "error whiling delete")
+		return
+	}
+
+	h.revoked.UserRevoked(id, revokedBefore)
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// RestoreUser godoc
+// @ID restore_user
+// @Router /user/{id}/restore [POST]
+// @Summary Restore User
+// @Description Bring deleted User back, 409 when its login was taken since
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Success 200 {object} models.User "GetUserBody"
+// @Header 200 {string} ETag "version of user"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) RestoreUser(c *gin.Context) {
+
+	id := c.Param("id")
+	if id == "" {
+		log.Printf("error whiling restore: %v\n", errors.New("required user id").Error())
+		c.JSON(http.StatusBadRequest, errors.New("required user id").Error())
+		return
+	}
+
+	resp, err := h.storage.User().Restore(
 		context.Background(),
-		&models.UserPrimarKey{
-			Id: id,
-		},
+		&models.UserPrimarKey{Id: id},
 	)
 
 	if err != nil {
-		log.Printf("error whiling delete: %v", err)
-		c.JSON(http.StatusInternalServerError, errors.New("error whiling delete").Error())
+		handleError(c, err, "error whiling restore")
 		return
 	}
 
-	c.JSON(http.StatusNoContent, nil)
+	c.Header("ETag", etag(resp.Version))
+
+	c.JSON(http.StatusOK, resp)
 }
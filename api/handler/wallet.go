@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"crud/models"
+)
+
+// GetWallet godoc
+// @ID get_wallet
+// @Router /user/{id}/wallet [GET]
+// @Summary Get Wallet
+// @Description Balance of User, sum of their ledger entries. Only the User itself, SUPER or user:read may see it
+// @Tags Wallet
+// @Accept json
+// @Produce json
+// @Param id path string true "user id"
+// @Param include_deleted query bool false "find deleted user too, SUPER only"
+// @Success 200 {object} models.Wallet "WalletBody"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) GetWallet(c *gin.Context) {
+
+	deleted, ok := includeDeleted(c)
+	if !ok {
+		return
+	}
+
+	if !h.authorizeWallet(c, c.Param("id")) {
+		return
+	}
+
+	resp, err := h.storage.Wallet().GetBalance(
+		context.Background(),
+		&models.UserPrimarKey{Id: c.Param("id"), IncludeDeleted: deleted},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling GetBalance")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// TopUpWallet godoc
+// @ID top_up_wallet
+// @Router /user/{id}/wallet/top-up [POST]
+// @Summary Top Up Wallet
+// @Description Put amount into Wallet of User from cash
+// @Tags Wallet
+// @Accept json
+// @Produce json
+// @Param id path string true "user id"
+// @Param operation body models.WalletOperation true "WalletOperationRequestBody"
+// @Success 200 {object} models.Wallet "WalletBody"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) TopUpWallet(c *gin.Context) {
+	h.moveWallet(c, h.storage.Wallet().TopUp)
+}
+
+// WithdrawWallet godoc
+// @ID withdraw_wallet
+// @Router /user/{id}/wallet/withdraw [POST]
+// @Summary Withdraw From Wallet
+// @Description Take amount out of Wallet of User as cash, 409 when balance is lower
+// @Tags Wallet
+// @Accept json
+// @Produce json
+// @Param id path string true "user id"
+// @Param operation body models.WalletOperation true "WalletOperationRequestBody"
+// @Success 200 {object} models.Wallet "WalletBody"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 404 {object} string "Not Found"
+// @Response 409 {object} string "Conflict"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) WithdrawWallet(c *gin.Context) {
+	h.moveWallet(c, h.storage.Wallet().Withdraw)
+}
+
+// GetWalletLedger godoc
+// @ID get_wallet_ledger
+// @Router /user/{id}/wallet/ledger [GET]
+// @Summary Get Wallet Ledger
+// @Description Wallet entries of User oldest first, positive amounts came in and negative went out.
+// @Description Only the User itself, SUPER or user:read may see them
+// @Tags Wallet
+// @Accept json
+// @Produce json
+// @Param id path string true "user id"
+// @Param offset query string false "offset"
+// @Param limit query string false "limit"
+// @Success 200 {object} models.GetLedgerResponse "LedgerBody"
+// @Response 400 {object} string "Invalid Argument"
+// @Response 403 {object} string "Forbidden"
+// @Response 404 {object} string "Not Found"
+// @Response 422 {object} string "Invalid Input"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) GetWalletLedger(c *gin.Context) {
+	var (
+		limit  int
+		offset int
+		err    error
+	)
+
+	if !h.authorizeWallet(c, c.Param("id")) {
+		return
+	}
+
+	limitStr := c.Query("limit")
+	if limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			log.Printf("error whiling limit: %v\n", err)
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	offsetStr := c.Query("offset")
+	if offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil {
+			log.Printf("error whiling offset: %v\n", err)
+			c.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	resp, err := h.storage.Wallet().GetLedger(
+		context.Background(),
+		&models.GetLedgerRequest{
+			UserId: c.Param("id"),
+			Limit:  int32(limit),
+			Offset: int32(offset),
+		},
+	)
+
+	if err != nil {
+		handleError(c, err, "error whiling GetLedger")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ReconcileWallets godoc
+// @ID reconcile_wallets
+// @Router /wallet/reconcile [POST]
+// @Summary Reconcile Wallets
+// @Description Set cached balance of every User to sum of their ledger entries, returns Users whose balance was off
+// @Tags Wallet
+// @Accept json
+// @Produce json
+// @Success 200 {object} []models.BalanceMismatch "BalanceMismatchBody"
+// @Failure 500 {object} string "Server Error"
+func (h *HandlerV1) ReconcileWallets(c *gin.Context) {
+
+	resp, err := h.storage.Wallet().Reconcile(context.Background())
+	if err != nil {
+		handleError(c, err, "error whiling Reconcile")
+		return
+	}
+
+	if len(resp) > 0 {
+		log.Printf("reconciled %d wallet balances\n", len(resp))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// moveWallet binds wallet operation of request and runs it as caller
+func (h *HandlerV1) moveWallet(c *gin.Context, move func(context.Context, *models.WalletOperation) (*models.Wallet, error)) {
+
+	var op models.WalletOperation
+
+	err := c.ShouldBindJSON(&op)
+	if err != nil {
+		log.Printf("error whiling wallet: %v\n", err)
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	op.UserId = c.Param("id")
+
+	if info, ok := tokenInfo(c); ok {
+		op.CreatedBy = info.UserID
+	}
+
+	resp, err := move(context.Background(), &op)
+	if err != nil {
+		handleError(c, err, "error whiling wallet")
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	apihttp "crud/api/http"
+	"crud/config"
+	"crud/pkg/helper"
+	"crud/pkg/keys"
+	"crud/pkg/policy"
+	"crud/pkg/revocation"
+)
+
+// authenticate validates "Authorization: Bearer <jwt>" header and puts helper.TokenInfo into context.
+// Requests without header continue as anonymous, checkAccess decides whether they may pass. So do requests
+// to PUBLIC routes with bad, expired or revoked token, client refreshing with stale access token still gets through
+func authenticate(cfg *config.Config, keySet *keys.Set, revoked *revocation.Store, accessPolicy *policy.Policy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		header := ctx.GetHeader("Authorization")
+		if header == "" {
+			ctx.Next()
+			return
+		}
+
+		reject := func(description string) {
+			if accessPolicy.Check(ctx.Request.Method, ctx.FullPath(), nil, nil) == policy.Allow {
+				ctx.Next()
+				return
+			}
+
+			abortUnauthorized(ctx, description)
+		}
+
+		token, err := helper.ExtractToken(header)
+		if err != nil {
+			reject("authorization header must be 'Bearer <token>'")
+			return
+		}
+
+		info, err := helper.ParseClaims(token, keySet, cfg.JWTIssuer, cfg.JWTAudience)
+		if err != nil {
+			log.Printf("error whiling ParseClaims: %v\n", err)
+
+			if errors.Is(err, helper.ErrTokenExpired) {
+				reject("token is expired")
+				return
+			}
+
+			reject("invalid token")
+			return
+		}
+
+		if revoked.IsRevoked(info) {
+			reject("token is revoked")
+			return
+		}
+
+		ctx.Set(helper.TokenInfoKey, info)
+		ctx.Next()
+	}
+}
+
+// checkAccess enforces the route policy, routes missing from the policy are denied.
+// Permission entries of the policy are checked against every role of the token
+func checkAccess(permissions *policy.PermissionCache, accessPolicy *policy.Policy) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+
+		var roles []string
+
+		if value, ok := ctx.Get(helper.TokenInfoKey); ok {
+			roles = value.(helper.TokenInfo).Roles
+		}
+
+		hasPermission := func(permission string) bool {
+			ok, err := permissions.Has(ctx.Request.Context(), roles, permission)
+			if err != nil {
+				log.Printf("error whiling HasPermission: %v\n", err)
+				return false
+			}
+			return ok
+		}
+
+		switch accessPolicy.Check(ctx.Request.Method, ctx.FullPath(), roles, hasPermission) {
+		case policy.Allow:
+			ctx.Next()
+		case policy.Unauthenticated:
+			abortUnauthorized(ctx, "authorization required")
+		default:
+			ctx.AbortWithStatusJSON(http.StatusForbidden, apihttp.Response{
+				Status:      "FORBIDDEN",
+				Description: "access denied",
+			})
+		}
+	}
+}
+
+func abortUnauthorized(ctx *gin.Context, description string) {
+	ctx.Header("WWW-Authenticate", `Bearer realm="api"`)
+	ctx.AbortWithStatusJSON(http.StatusUnauthorized, apihttp.Response{
+		Status:      "UNAUTHORIZED",
+		Description: description,
+	})
+}
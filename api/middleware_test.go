@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"crud/config"
+	"crud/models"
+	"crud/pkg/helper"
+	"crud/pkg/keys"
+	"crud/pkg/policy"
+	"crud/pkg/revocation"
+	"crud/storage/memory"
+)
+
+func TestAuthenticateAndCheckAccess(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	ctx := context.Background()
+
+	cfg := config.Default()
+	keySet := keys.NewHMAC("0123456789abcdef0123")
+	store := memory.NewMemory()
+	revoked := revocation.NewStore(store.Revocation())
+
+	_, err := store.Role().Create(ctx, &models.CreateRole{Name: "EDITOR", Permissions: []string{"book:write"}})
+	if err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+
+	accessPolicy, err := policy.Parse(strings.NewReader(`
+		GET   /public   PUBLIC
+		GET   /me       AUTHENTICATED
+		POST  /book     SUPER,book:write
+		GET   /admin    SUPER
+	`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(authenticate(&cfg, keySet, revoked, accessPolicy))
+	r.Use(checkAccess(policy.NewPermissionCache(store.Role().HasPermission, time.Minute), accessPolicy))
+
+	// handlers answer with user of token, so tests see whether request went through as anonymous
+	caller := func(c *gin.Context) {
+		if info, ok := c.Get(helper.TokenInfoKey); ok {
+			c.String(http.StatusOK, info.(helper.TokenInfo).UserID)
+			return
+		}
+		c.String(http.StatusOK, "anonymous")
+	}
+
+	r.GET("/public", caller)
+	r.GET("/me", caller)
+	r.POST("/book", caller)
+	r.GET("/admin", caller)
+	r.GET("/unlisted", caller)
+
+	token := func(userId string, roles []string, changes map[string]interface{}, ttl time.Duration) string {
+		t.Helper()
+
+		claims := map[string]interface{}{
+			"iss":     cfg.JWTIssuer,
+			"aud":     cfg.JWTAudience,
+			"user_id": userId,
+			"roles":   roles,
+		}
+		for key, value := range changes {
+			claims[key] = value
+		}
+
+		signed, err := helper.GenerateJWT(claims, ttl, keySet)
+		if err != nil {
+			t.Fatalf("GenerateJWT: %v", err)
+		}
+		return "Bearer " + signed
+	}
+
+	// revocations refer to users that exist
+	clientId, err := store.User().Create(ctx, &models.CreateUser{Login: "client", Password: "!"})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	var (
+		editorId = uuid.New().String()
+		superId  = uuid.New().String()
+		goneId   = uuid.New().String()
+		jti      = uuid.New().String()
+	)
+
+	var (
+		client      = token(clientId, []string{"CLIENT"}, nil, time.Hour)
+		editor      = token(editorId, []string{"EDITOR"}, nil, time.Hour)
+		super       = token(superId, []string{"SUPER"}, nil, time.Hour)
+		expired     = token(clientId, []string{"CLIENT"}, nil, -time.Minute)
+		wrongIssuer = token(clientId, []string{"CLIENT"}, map[string]interface{}{"iss": "other"}, time.Hour)
+		wrongAud    = token(clientId, []string{"CLIENT"}, map[string]interface{}{"aud": "other"}, time.Hour)
+		revokedJti  = token(clientId, []string{"CLIENT"}, map[string]interface{}{"jti": jti}, time.Hour)
+		loggedOut   = token(goneId, []string{"CLIENT"}, nil, time.Hour)
+	)
+
+	err = revoked.Revoke(ctx, helper.TokenInfo{UserID: clientId, JTI: jti, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	revoked.UserRevoked(goneId, time.Now().Add(time.Second))
+
+	for _, c := range []struct {
+		name, method, path, header string
+		want                       int
+		body                       string
+	}{
+		{"public anonymous", "GET", "/public", "", http.StatusOK, "anonymous"},
+		{"public with token", "GET", "/public", client, http.StatusOK, clientId},
+		{"public with garbage", "GET", "/public", "Bearer garbage", http.StatusOK, "anonymous"},
+		{"public with expired", "GET", "/public", expired, http.StatusOK, "anonymous"},
+		{"public with revoked", "GET", "/public", revokedJti, http.StatusOK, "anonymous"},
+		{"public with other scheme", "GET", "/public", "Basic abc", http.StatusOK, "anonymous"},
+
+		{"authenticated anonymous", "GET", "/me", "", http.StatusUnauthorized, ""},
+		{"authenticated", "GET", "/me", client, http.StatusOK, clientId},
+		{"garbage", "GET", "/me", "Bearer garbage", http.StatusUnauthorized, ""},
+		{"other scheme", "GET", "/me", "Basic abc", http.StatusUnauthorized, ""},
+		{"expired", "GET", "/me", expired, http.StatusUnauthorized, ""},
+		{"wrong issuer", "GET", "/me", wrongIssuer, http.StatusUnauthorized, ""},
+		{"wrong audience", "GET", "/me", wrongAud, http.StatusUnauthorized, ""},
+		{"revoked jti", "GET", "/me", revokedJti, http.StatusUnauthorized, ""},
+		{"revoked user", "GET", "/me", loggedOut, http.StatusUnauthorized, ""},
+
+		{"permission anonymous", "POST", "/book", "", http.StatusUnauthorized, ""},
+		{"permission missing", "POST", "/book", client, http.StatusForbidden, ""},
+		{"permission of role", "POST", "/book", editor, http.StatusOK, editorId},
+		{"permission of SUPER", "POST", "/book", super, http.StatusOK, superId},
+
+		{"SUPER only as client", "GET", "/admin", client, http.StatusForbidden, ""},
+		{"SUPER only with permission", "GET", "/admin", editor, http.StatusForbidden, ""},
+		{"SUPER only as SUPER", "GET", "/admin", super, http.StatusOK, superId},
+
+		{"unlisted route", "GET", "/unlisted", super, http.StatusForbidden, ""},
+	} {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != c.want || c.body != "" && w.Body.String() != c.body {
+			t.Errorf("%s: %s %s = %d %q, want %d %q", c.name, c.method, c.path, w.Code, w.Body.String(), c.want, c.body)
+		}
+
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: 401 without WWW-Authenticate", c.name)
+		}
+	}
+}
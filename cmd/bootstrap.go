@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"crud/config"
+	"crud/models"
+	"crud/pkg/password"
+	"crud/pkg/policy"
+	"crud/storage"
+)
+
+// ensureSuper creates user SUPER_LOGIN with SUPER_PASSWORD unless it exists and grants it SUPER,
+// so fresh database has someone who can manage roles
+func ensureSuper(cfg config.Config, store storage.StorageI, hasher *password.Hasher) error {
+
+	ctx := context.Background()
+
+	user, err := store.User().GetByPKey(ctx, &models.UserPrimarKey{Login: cfg.SuperLogin})
+	if errors.Is(err, storage.ErrNotFound) {
+
+		err = password.Validate(cfg.SuperPassword)
+		if err != nil {
+			return fmt.Errorf("SUPER_PASSWORD: %w", err)
+		}
+
+		hash, err := hasher.Hash(cfg.SuperPassword)
+		if err != nil {
+			return err
+		}
+
+		id, err := store.User().Create(ctx, &models.CreateUser{
+			FirstName: "Super",
+			Login:     cfg.SuperLogin,
+			Password:  hash,
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Printf("created super user %s\n", cfg.SuperLogin)
+
+		user = &models.User{Id: id}
+	} else if err != nil {
+		return err
+	}
+
+	// assigning role user already has is no-op
+	return store.Role().AssignToUser(ctx, &models.UserRole{UserId: user.Id, Role: policy.Super})
+}
@@ -1,36 +1,44 @@
 package main
 
 import (
-	"context"
+	"fmt"
 	"log"
+	"os"
 
-
-	"crud/api"
 	"crud/config"
-	"crud/storage/postgres"
-
-	"github.com/gin-gonic/gin"
 )
 
-func main() {
-
-	cfg := config.Load()
-
-	r := gin.New()
+const usage = `usage:
+  main serve                  start http server (default)
+  main migrate up             apply all pending migrations
+  main migrate down           roll back the last applied migration
+  main migrate to N           migrate up or down to version N, 0 rolls back everything
+  main migrate status         list migrations and whether they are applied
+`
 
-	r.Use(gin.Logger(), gin.Recovery())
+func main() {
 
-	storage, err := postgres.NewPostgres(context.Background(), cfg)
+	cfg, err := config.Load()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer storage.CloseDB()
 
-	api.SetUpApi(&cfg,r, storage)
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "serve":
+		err = serve(cfg)
+	case "migrate":
+		err = migrate(cfg, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
 
-	log.Printf("Listening port %v...\n", cfg.HTTPPort)
-	err = r.Run(cfg.HTTPPort)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"strconv"
+
+	"crud/config"
+	"crud/migrations"
+	"crud/storage/postgres"
+)
+
+func migrate(cfg config.Config, args []string) error {
+
+	if len(args) == 0 {
+		return errors.New("migrate: expected up, down, to N or status")
+	}
+
+	ctx := context.Background()
+
+	pool, err := postgres.Connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	files, err := fs.Sub(migrations.Postgres, "postgres")
+	if err != nil {
+		return err
+	}
+
+	migrator, err := postgres.NewMigrator(pool, files)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+
+	case "down":
+		err = migrator.Down(ctx)
+
+	case "to":
+		if len(args) != 2 {
+			return errors.New("migrate to: expected version")
+		}
+
+		var version int64
+
+		version, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("migrate to: %w", err)
+		}
+
+		err = migrator.To(ctx, version)
+
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range status {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-30s  %s\n", s.Version, s.Name, applied)
+		}
+
+		return nil
+
+	default:
+		return fmt.Errorf("migrate: unknown command %q", args[0])
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("migrate %s: done\n", args[0])
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"crud/api"
+	"crud/config"
+	"crud/pkg/keys"
+	"crud/pkg/password"
+	"crud/pkg/policy"
+	"crud/pkg/purge"
+	"crud/pkg/reservation"
+	"crud/pkg/revocation"
+	"crud/storage"
+	"crud/storage/memory"
+	"crud/storage/postgres"
+)
+
+func serve(cfg config.Config) error {
+
+	log.Printf("config: %s\n", cfg)
+
+	err := cfg.ValidateServe()
+	if err != nil {
+		return err
+	}
+
+	r := gin.New()
+
+	r.Use(gin.Logger(), gin.Recovery())
+
+	storage, err := newStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.CloseDB()
+
+	accessPolicy, err := policy.Load(cfg.PolicyPath)
+	if err != nil {
+		return err
+	}
+
+	hasher, err := password.NewHasher(cfg.PasswordHashAlgorithm, cfg.PasswordHashCost, cfg.PasswordAcceptPlaintext)
+	if err != nil {
+		return err
+	}
+
+	if cfg.SuperLogin != "" {
+		err = ensureSuper(cfg, storage, hasher)
+		if err != nil {
+			return err
+		}
+	}
+
+	revoked := revocation.NewStore(storage.Revocation())
+
+	err = revoked.Load(context.Background())
+	if err != nil {
+		return err
+	}
+
+	go revoked.Run(context.Background(), cfg.RevocationRefreshInterval)
+
+	go purge.NewPurger(storage, cfg.SoftDeleteRetention).Run(context.Background(), cfg.PurgeInterval)
+
+	go reservation.NewExpirer(storage).Run(context.Background(), cfg.ReservationExpiryInterval)
+
+	keySet := keys.NewHMAC(cfg.AuthSecretKey)
+	if cfg.JWTKeysDir != "" {
+		keySet, err = keys.Load(cfg.JWTKeysDir, cfg.JWTSigningKeyID)
+		if err != nil {
+			return err
+		}
+	}
+
+	api.SetUpApi(&cfg, r, storage, accessPolicy, hasher, revoked, keySet)
+
+	log.Printf("Listening port %v...\n", cfg.HTTPPort)
+	return r.Run(cfg.HTTPPort)
+}
+
+func newStorage(cfg config.Config) (storage.StorageI, error) {
+
+	if cfg.StorageDriver == "memory" {
+		log.Println("using in-memory storage, data is lost on exit")
+		return memory.NewMemory(), nil
+	}
+
+	if cfg.MigrateOnStart {
+		err := migrate(cfg, []string{"up"})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return postgres.NewPostgres(context.Background(), cfg)
+}
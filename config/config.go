@@ -1,36 +1,323 @@
 package config
 
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is loaded from defaults, then optional YAML file named by CONFIG_FILE, then environment variables.
+// Later sources override earlier ones. Fields tagged secret are redacted by String
 type Config struct {
-	HTTPPort string
+	HTTPPort string `yaml:"http_port" env:"HTTP_PORT"`
+
+	// StorageDriver selects storage backend: postgres, or memory which keeps data only while the process runs
+	StorageDriver string `yaml:"storage_driver" env:"STORAGE_DRIVER"`
+
+	PostgresHost           string `yaml:"postgres_host" env:"POSTGRES_HOST"`
+	PostgresUser           string `yaml:"postgres_user" env:"POSTGRES_USER"`
+	PostgresDatabase       string `yaml:"postgres_database" env:"POSTGRES_DATABASE"`
+	PostgresPassword       string `yaml:"postgres_password" env:"POSTGRES_PASSWORD" secret:"true"`
+	PostgresPort           string `yaml:"postgres_port" env:"POSTGRES_PORT"`
+	PostgresMaxConnections int32  `yaml:"postgres_max_connections" env:"POSTGRES_MAX_CONNECTIONS"`
+
+	// MigrateOnStart applies pending migrations before serve starts listening
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"MIGRATE_ON_START"`
+
+	AuthSecretKey   string `yaml:"auth_secret_key" env:"AUTH_SECRET_KEY" secret:"true"`
+	JWTIssuer       string `yaml:"jwt_issuer" env:"JWT_ISSUER"`
+	JWTAudience     string `yaml:"jwt_audience" env:"JWT_AUDIENCE"`
+	JWTKeysDir      string `yaml:"jwt_keys_dir" env:"JWT_KEYS_DIR"`
+	JWTSigningKeyID string `yaml:"jwt_signing_key_id" env:"JWT_SIGNING_KEY_ID"`
+
+	// CursorSecretKey signs list cursors, AuthSecretKey is used when it is empty
+	CursorSecretKey string `yaml:"cursor_secret_key" env:"CURSOR_SECRET_KEY" secret:"true"`
+
+	AccessTokenTTL            time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	SuperAccessTokenTTL       time.Duration `yaml:"super_access_token_ttl" env:"SUPER_ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL           time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+	RevocationRefreshInterval time.Duration `yaml:"revocation_refresh_interval" env:"REVOCATION_REFRESH_INTERVAL"`
+
+	// PermissionCacheTTL is how long access checks trust permissions of role they looked up
+	PermissionCacheTTL time.Duration `yaml:"permission_cache_ttl" env:"PERMISSION_CACHE_TTL"`
+
+	// SuperLogin and SuperPassword, when set, make serve create that user with SUPER role unless
+	// the login exists already, so fresh deployment has admin to assign other roles
+	SuperLogin    string `yaml:"super_login" env:"SUPER_LOGIN"`
+	SuperPassword string `yaml:"super_password" env:"SUPER_PASSWORD" secret:"true"`
 
-	PostgresHost           string
-	PostgresUser           string
-	PostgresDatabase       string
-	PostgresPassword       string
-	PostgresPort           string
-	PostgresMaxConnections int32
+	// SoftDeleteRetention is how long deleted rows can be restored before purge removes them
+	SoftDeleteRetention time.Duration `yaml:"soft_delete_retention" env:"SOFT_DELETE_RETENTION"`
+	PurgeInterval       time.Duration `yaml:"purge_interval" env:"PURGE_INTERVAL"`
 
-	AuthSecretKey string
-	SuperAdmin    string
-	Client        string
+	// ReservationTTL is how long new order holds its stock, unpaid order is cancelled after it
+	ReservationTTL            time.Duration `yaml:"reservation_ttl" env:"RESERVATION_TTL"`
+	ReservationExpiryInterval time.Duration `yaml:"reservation_expiry_interval" env:"RESERVATION_EXPIRY_INTERVAL"`
+
+	PolicyPath string `yaml:"policy_path" env:"POLICY_PATH"`
+
+	PasswordHashAlgorithm string `yaml:"password_hash_algorithm" env:"PASSWORD_HASH_ALGORITHM"`
+	PasswordHashCost      int    `yaml:"password_hash_cost" env:"PASSWORD_HASH_COST"`
+
+	// PasswordAcceptPlaintext lets login match legacy plaintext passwords and rehash them,
+	// turn it off once no plaintext rows remain
+	PasswordAcceptPlaintext bool `yaml:"password_accept_plaintext" env:"PASSWORD_ACCEPT_PLAINTEXT"`
 }
 
-func Load() Config {
+func Default() Config {
 
 	var cfg Config
 
 	cfg.HTTPPort = ":4000"
 
+	cfg.StorageDriver = "postgres"
+
 	cfg.PostgresHost = "localhost"
 	cfg.PostgresUser = "admin"
 	cfg.PostgresDatabase = "dvdrental"
-	cfg.PostgresPassword = "2711"
 	cfg.PostgresPort = "5432"
 	cfg.PostgresMaxConnections = 20
 
-	cfg.AuthSecretKey = "9K+WgNTglA44Hg=="
-	cfg.SuperAdmin = "Super"
-	cfg.Client = "Client"
+	cfg.MigrateOnStart = true
+
+	cfg.JWTIssuer = "crud"
+	cfg.JWTAudience = "crud-api"
+
+	cfg.AccessTokenTTL = time.Minute * 30
+	cfg.SuperAccessTokenTTL = time.Minute * 10
+	cfg.RefreshTokenTTL = time.Hour * 24 * 30
+	cfg.RevocationRefreshInterval = time.Second * 30
+	cfg.PermissionCacheTTL = time.Minute
+
+	cfg.SoftDeleteRetention = time.Hour * 24 * 30
+	cfg.PurgeInterval = time.Hour
+
+	cfg.ReservationTTL = time.Minute * 30
+	cfg.ReservationExpiryInterval = time.Minute
+
+	cfg.PolicyPath = "./policy.txt"
+
+	cfg.PasswordHashAlgorithm = "bcrypt"
+	cfg.PasswordHashCost = 12
 
 	return cfg
 }
+
+func Load() (Config, error) {
+
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("config file: %w", err)
+		}
+
+		err = yaml.UnmarshalStrict(data, &cfg)
+		if err != nil {
+			return cfg, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	err := loadEnv(&cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	// settings only serve needs are checked by ValidateServe, so migrate runs without auth secrets
+	return cfg, cfg.Validate()
+}
+
+// Validate reports every invalid setting that every command needs, storage settings, at once
+func (c Config) Validate() error {
+	return report(c.storageProblems())
+}
+
+// ValidateServe reports every invalid setting of serve at once, auth secrets and tokens included
+func (c Config) ValidateServe() error {
+
+	problems := c.storageProblems()
+
+	required := map[string]string{
+		"HTTP_PORT":    c.HTTPPort,
+		"JWT_ISSUER":   c.JWTIssuer,
+		"JWT_AUDIENCE": c.JWTAudience,
+		"POLICY_PATH":  c.PolicyPath,
+	}
+
+	for name, value := range required {
+		if value == "" {
+			problems = append(problems, name+" is required")
+		}
+	}
+
+	if c.JWTKeysDir == "" && len(c.AuthSecretKey) < 16 {
+		problems = append(problems, "AUTH_SECRET_KEY must be at least 16 characters when JWT_KEYS_DIR is not set")
+	}
+
+	cursorKey := c.CursorSecretKey
+	if cursorKey == "" {
+		cursorKey = c.AuthSecretKey
+	}
+
+	if len(cursorKey) < 16 {
+		problems = append(problems, "CURSOR_SECRET_KEY must be at least 16 characters, it falls back to AUTH_SECRET_KEY when not set")
+	}
+
+	if (c.SuperLogin == "") != (c.SuperPassword == "") {
+		problems = append(problems, "SUPER_LOGIN and SUPER_PASSWORD must be set together")
+	}
+
+	if c.JWTKeysDir != "" && c.JWTSigningKeyID == "" {
+		problems = append(problems, "JWT_SIGNING_KEY_ID is required when JWT_KEYS_DIR is set")
+	}
+
+	durations := map[string]time.Duration{
+		"ACCESS_TOKEN_TTL":            c.AccessTokenTTL,
+		"SUPER_ACCESS_TOKEN_TTL":      c.SuperAccessTokenTTL,
+		"REFRESH_TOKEN_TTL":           c.RefreshTokenTTL,
+		"REVOCATION_REFRESH_INTERVAL": c.RevocationRefreshInterval,
+		"PERMISSION_CACHE_TTL":        c.PermissionCacheTTL,
+		"SOFT_DELETE_RETENTION":       c.SoftDeleteRetention,
+		"PURGE_INTERVAL":              c.PurgeInterval,
+		"RESERVATION_TTL":             c.ReservationTTL,
+		"RESERVATION_EXPIRY_INTERVAL": c.ReservationExpiryInterval,
+	}
+
+	for name, value := range durations {
+		if value <= 0 {
+			problems = append(problems, name+" must be positive")
+		}
+	}
+
+	if c.RefreshTokenTTL <= c.AccessTokenTTL {
+		problems = append(problems, "REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL")
+	}
+
+	if c.PasswordHashAlgorithm != "bcrypt" && c.PasswordHashAlgorithm != "argon2id" {
+		problems = append(problems, "PASSWORD_HASH_ALGORITHM must be bcrypt or argon2id")
+	}
+
+	return report(problems)
+}
+
+func (c Config) storageProblems() []string {
+
+	var (
+		problems []string
+		required = map[string]string{}
+	)
+
+	switch c.StorageDriver {
+	case "postgres":
+		required["POSTGRES_HOST"] = c.PostgresHost
+		required["POSTGRES_USER"] = c.PostgresUser
+		required["POSTGRES_DATABASE"] = c.PostgresDatabase
+		required["POSTGRES_PORT"] = c.PostgresPort
+
+		if c.PostgresMaxConnections <= 0 {
+			problems = append(problems, "POSTGRES_MAX_CONNECTIONS must be positive")
+		}
+	case "memory":
+	default:
+		problems = append(problems, "STORAGE_DRIVER must be postgres or memory")
+	}
+
+	for name, value := range required {
+		if value == "" {
+			problems = append(problems, name+" is required")
+		}
+	}
+
+	return problems
+}
+
+func report(problems []string) error {
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	// map iteration order is random, keep messages stable
+	sort.Strings(problems)
+
+	return fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// String prints config with secrets redacted, safe for logs
+func (c Config) String() string {
+
+	var (
+		b strings.Builder
+		v = reflect.ValueOf(c)
+		t = v.Type()
+	)
+
+	for i := 0; i < t.NumField(); i++ {
+		value := fmt.Sprint(v.Field(i).Interface())
+
+		if t.Field(i).Tag.Get("secret") == "true" && value != "" {
+			value = "[REDACTED]"
+		}
+
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "%s=%s", t.Field(i).Name, value)
+	}
+
+	return b.String()
+}
+
+func loadEnv(cfg *Config) error {
+
+	var (
+		v = reflect.ValueOf(cfg).Elem()
+		t = v.Type()
+	)
+
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+
+		value, ok := os.LookupEnv(name)
+		if name == "" || !ok {
+			continue
+		}
+
+		field := v.Field(i)
+
+		switch {
+		case field.Type() == reflect.TypeOf(time.Duration(0)):
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetInt(int64(d))
+
+		case field.Kind() == reflect.String:
+			field.SetString(value)
+
+		case field.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetBool(b)
+
+		case field.Kind() == reflect.Int || field.Kind() == reflect.Int32:
+			n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			field.SetInt(n)
+		}
+	}
+
+	return nil
+}
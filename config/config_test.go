@@ -0,0 +1,253 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable Load reads, t.Setenv puts them back after test
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	names := []string{"CONFIG_FILE"}
+
+	typ := reflect.TypeOf(Config{})
+	for i := 0; i < typ.NumField(); i++ {
+		if name := typ.Field(i).Tag.Get("env"); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func writeFile(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	err := os.WriteFile(path, []byte(data), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+
+	for _, c := range []struct {
+		name    string
+		yaml    string
+		env     map[string]string
+		check   func(cfg Config) bool
+		wantErr string
+	}{
+		{
+			name:  "defaults",
+			check: func(cfg Config) bool { return reflect.DeepEqual(cfg, Default()) },
+		},
+		{
+			name: "yaml over defaults",
+			yaml: "http_port: \":5000\"\naccess_token_ttl: 5m\nmigrate_on_start: false\npostgres_max_connections: 3\n",
+			check: func(cfg Config) bool {
+				return cfg.HTTPPort == ":5000" && cfg.AccessTokenTTL == 5*time.Minute && !cfg.MigrateOnStart &&
+					cfg.PostgresMaxConnections == 3 && cfg.PostgresHost == "localhost"
+			},
+		},
+		{
+			name: "env over yaml",
+			yaml: "http_port: \":5000\"\npostgres_host: db\naccess_token_ttl: 5m\n",
+			env:  map[string]string{"HTTP_PORT": ":6000", "ACCESS_TOKEN_TTL": "7m", "MIGRATE_ON_START": "false", "PASSWORD_HASH_COST": "10"},
+			check: func(cfg Config) bool {
+				return cfg.HTTPPort == ":6000" && cfg.AccessTokenTTL == 7*time.Minute && !cfg.MigrateOnStart &&
+					cfg.PasswordHashCost == 10 && cfg.PostgresHost == "db"
+			},
+		},
+		{
+			name:  "empty env overrides yaml",
+			yaml:  "jwt_keys_dir: /keys\n",
+			env:   map[string]string{"JWT_KEYS_DIR": ""},
+			check: func(cfg Config) bool { return cfg.JWTKeysDir == "" },
+		},
+		{name: "unknown yaml key", yaml: "http_prot: \":5000\"\n", wantErr: "http_prot"},
+		{name: "bad yaml duration", yaml: "access_token_ttl: soon\n", wantErr: "config file"},
+		{name: "bad env duration", env: map[string]string{"ACCESS_TOKEN_TTL": "soon"}, wantErr: "ACCESS_TOKEN_TTL"},
+		{name: "bad env bool", env: map[string]string{"MIGRATE_ON_START": "maybe"}, wantErr: "MIGRATE_ON_START"},
+		{name: "bad env int", env: map[string]string{"POSTGRES_MAX_CONNECTIONS": "many"}, wantErr: "POSTGRES_MAX_CONNECTIONS"},
+		{name: "env int out of range", env: map[string]string{"POSTGRES_MAX_CONNECTIONS": "4294967296"}, wantErr: "POSTGRES_MAX_CONNECTIONS"},
+		{name: "invalid storage", env: map[string]string{"STORAGE_DRIVER": "mysql"}, wantErr: "STORAGE_DRIVER must be postgres or memory"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			clearEnv(t)
+
+			if c.yaml != "" {
+				t.Setenv("CONFIG_FILE", writeFile(t, c.yaml))
+			}
+
+			for name, value := range c.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load()
+
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("Load error = %v, want containing %q", err, c.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			if !c.check(cfg) {
+				t.Fatalf("Load returned %s", cfg)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		clearEnv(t)
+		t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+
+		_, err := Load()
+		if err == nil || !strings.HasPrefix(err.Error(), "config file:") {
+			t.Fatalf("Load error = %v, want config file error", err)
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+
+	// serve is valid config all cases start from
+	serve := func(change func(cfg *Config)) Config {
+		cfg := Default()
+		cfg.AuthSecretKey = "0123456789abcdef"
+		if change != nil {
+			change(&cfg)
+		}
+		return cfg
+	}
+
+	for _, c := range []struct {
+		name      string
+		cfg       Config
+		wantErr   []string
+		serveOnly bool
+	}{
+		{name: "valid", cfg: serve(nil)},
+		{name: "memory needs no postgres", cfg: serve(func(cfg *Config) { cfg.StorageDriver = "memory"; cfg.PostgresHost = "" })},
+		{name: "keys dir replaces secret", cfg: serve(func(cfg *Config) {
+			cfg.JWTKeysDir, cfg.JWTSigningKeyID, cfg.AuthSecretKey, cfg.CursorSecretKey = "/keys", "k1", "", "0123456789abcdef"
+		})},
+		{
+			name:    "storage driver",
+			cfg:     serve(func(cfg *Config) { cfg.StorageDriver = "" }),
+			wantErr: []string{"STORAGE_DRIVER must be postgres or memory"},
+		},
+		{
+			name:    "postgres settings",
+			cfg:     serve(func(cfg *Config) { cfg.PostgresHost, cfg.PostgresPort, cfg.PostgresMaxConnections = "", "", 0 }),
+			wantErr: []string{"POSTGRES_HOST is required", "POSTGRES_MAX_CONNECTIONS must be positive", "POSTGRES_PORT is required"},
+		},
+		{
+			name:      "short secret",
+			cfg:       serve(func(cfg *Config) { cfg.AuthSecretKey = "short" }),
+			wantErr:   []string{"AUTH_SECRET_KEY must be at least 16 characters", "CURSOR_SECRET_KEY must be at least 16 characters"},
+			serveOnly: true,
+		},
+		{
+			name:      "keys dir without key id",
+			cfg:       serve(func(cfg *Config) { cfg.JWTKeysDir = "/keys" }),
+			wantErr:   []string{"JWT_SIGNING_KEY_ID is required when JWT_KEYS_DIR is set"},
+			serveOnly: true,
+		},
+		{
+			name:      "super login without password",
+			cfg:       serve(func(cfg *Config) { cfg.SuperLogin = "root" }),
+			wantErr:   []string{"SUPER_LOGIN and SUPER_PASSWORD must be set together"},
+			serveOnly: true,
+		},
+		{
+			name:      "durations",
+			cfg:       serve(func(cfg *Config) { cfg.PurgeInterval, cfg.RefreshTokenTTL = 0, cfg.AccessTokenTTL }),
+			wantErr:   []string{"PURGE_INTERVAL must be positive", "REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL"},
+			serveOnly: true,
+		},
+		{
+			name:      "hash algorithm",
+			cfg:       serve(func(cfg *Config) { cfg.PasswordHashAlgorithm = "md5" }),
+			wantErr:   []string{"PASSWORD_HASH_ALGORITHM must be bcrypt or argon2id"},
+			serveOnly: true,
+		},
+		{
+			name:      "required",
+			cfg:       serve(func(cfg *Config) { cfg.HTTPPort, cfg.PolicyPath = "", "" }),
+			wantErr:   []string{"HTTP_PORT is required", "POLICY_PATH is required"},
+			serveOnly: true,
+		},
+	} {
+		err := c.cfg.ValidateServe()
+
+		if len(c.wantErr) == 0 {
+			if err != nil {
+				t.Errorf("%s: ValidateServe: %v", c.name, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("%s: ValidateServe succeeded, want %v", c.name, c.wantErr)
+			continue
+		}
+
+		// every problem is reported at once
+		for _, want := range c.wantErr {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: ValidateServe error %q does not mention %q", c.name, err, want)
+			}
+		}
+
+		// migrate validates only storage, so it runs without auth settings
+		if err = c.cfg.Validate(); (err == nil) != c.serveOnly {
+			t.Errorf("%s: Validate error = %v, want error %v", c.name, err, !c.serveOnly)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+
+	cfg := Default()
+	cfg.PostgresPassword = "pg-password"
+	cfg.AuthSecretKey = "auth-secret"
+	cfg.SuperLogin = "root"
+	cfg.SuperPassword = "super-password"
+
+	s := cfg.String()
+
+	for _, secret := range []string{"pg-password", "auth-secret", "super-password"} {
+		if strings.Contains(s, secret) {
+			t.Errorf("String leaks %q: %s", secret, s)
+		}
+	}
+
+	for _, want := range []string{"PostgresPassword=[REDACTED]", "AuthSecretKey=[REDACTED]", "SuperPassword=[REDACTED]", "SuperLogin=root", "HTTPPort=:4000"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("String does not contain %q: %s", want, s)
+		}
+	}
+
+	// empty secret shows it is not set instead of hiding that
+	if !strings.Contains(s, "CursorSecretKey= ") {
+		t.Errorf("String redacts empty secret: %s", s)
+	}
+}
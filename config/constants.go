@@ -1,8 +0,0 @@
-package config
-
-import "time"
-
-const (
-	TimeExpiredAt      = time.Minute * 30
-	SuperTimeExpiredAt = time.Minute * 10
-)
\ No newline at end of file
@@ -0,0 +1,8 @@
+package migrations
+
+import "embed"
+
+// Postgres holds SQL migrations named <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed postgres/*.sql
+var Postgres embed.FS
@@ -1,6 +1,6 @@
 
+DROP TABLE IF EXISTS orders;
+
 DROP TABLE IF EXISTS book;
 
 DROP TABLE IF EXISTS users;
-
-DROP TABLE IF EXISTS order;
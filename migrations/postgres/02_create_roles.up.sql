@@ -0,0 +1,47 @@
+
+CREATE TABLE roles (
+        role_id UUID NOT NULL PRIMARY KEY,
+        name VARCHAR NOT NULL UNIQUE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE permissions (
+        permission_id UUID NOT NULL PRIMARY KEY,
+        name VARCHAR NOT NULL UNIQUE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE role_permissions (
+        role_id UUID NOT NULL REFERENCES roles(role_id) ON DELETE CASCADE,
+        permission_id UUID NOT NULL REFERENCES permissions(permission_id) ON DELETE CASCADE,
+        PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE user_roles (
+        user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+        role_id UUID NOT NULL REFERENCES roles(role_id) ON DELETE CASCADE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+        PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (role_id, name) VALUES
+        ('6f1c8a9e-2b1d-4c47-9f0e-1a2b3c4d5e01', 'SUPER'),
+        ('6f1c8a9e-2b1d-4c47-9f0e-1a2b3c4d5e02', 'CLIENT');
+
+INSERT INTO permissions (permission_id, name) VALUES
+        ('7a2d9b0f-3c2e-4d58-8a1f-2b3c4d5e6f01', 'book:read'),
+        ('7a2d9b0f-3c2e-4d58-8a1f-2b3c4d5e6f02', 'book:write'),
+        ('7a2d9b0f-3c2e-4d58-8a1f-2b3c4d5e6f03', 'user:read'),
+        ('7a2d9b0f-3c2e-4d58-8a1f-2b3c4d5e6f04', 'user:write'),
+        ('7a2d9b0f-3c2e-4d58-8a1f-2b3c4d5e6f05', 'order:read'),
+        ('7a2d9b0f-3c2e-4d58-8a1f-2b3c4d5e6f06', 'order:write'),
+        ('7a2d9b0f-3c2e-4d58-8a1f-2b3c4d5e6f07', 'role:read'),
+        ('7a2d9b0f-3c2e-4d58-8a1f-2b3c4d5e6f08', 'role:write');
+
+INSERT INTO role_permissions (role_id, permission_id)
+        SELECT r.role_id, p.permission_id FROM roles r, permissions p WHERE r.name = 'SUPER';
+
+INSERT INTO role_permissions (role_id, permission_id)
+        SELECT r.role_id, p.permission_id FROM roles r, permissions p
+        WHERE r.name = 'CLIENT' AND p.name IN ('user:read', 'order:write');
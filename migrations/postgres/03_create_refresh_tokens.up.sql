@@ -0,0 +1,14 @@
+
+CREATE TABLE refresh_tokens (
+        refresh_token_id UUID NOT NULL PRIMARY KEY,
+        family_id UUID NOT NULL,
+        user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+        token_hash VARCHAR NOT NULL UNIQUE,
+        role VARCHAR NOT NULL,
+        expires_at TIMESTAMP NOT NULL,
+        used_at TIMESTAMP,
+        revoked_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens(family_id);
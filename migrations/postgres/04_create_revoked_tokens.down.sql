@@ -0,0 +1,4 @@
+
+DROP TABLE IF EXISTS user_token_revocations;
+
+DROP TABLE IF EXISTS revoked_tokens;
@@ -0,0 +1,14 @@
+
+CREATE TABLE revoked_tokens (
+        jti VARCHAR NOT NULL PRIMARY KEY,
+        user_id UUID NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+        expires_at TIMESTAMP NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX revoked_tokens_expires_at_idx ON revoked_tokens(expires_at);
+
+CREATE TABLE user_token_revocations (
+        user_id UUID NOT NULL PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+        revoked_before TIMESTAMP NOT NULL
+);
@@ -0,0 +1,21 @@
+
+DROP INDEX IF EXISTS orders_created_at_idx;
+DROP INDEX IF EXISTS users_created_at_idx;
+DROP INDEX IF EXISTS book_created_at_idx;
+DROP INDEX IF EXISTS orders_user_id_idx;
+DROP INDEX IF EXISTS orders_book_id_idx;
+
+ALTER TABLE orders DROP CONSTRAINT orders_pkey;
+ALTER TABLE orders RENAME COLUMN user_id TO users_id;
+ALTER TABLE orders RENAME COLUMN book_id TO books_id;
+
+ALTER TABLE users ALTER COLUMN balance DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN balance DROP DEFAULT;
+
+ALTER TABLE users DROP CONSTRAINT users_login_key;
+ALTER TABLE users DROP COLUMN password;
+ALTER TABLE users DROP COLUMN login;
+
+ALTER TABLE users DROP CONSTRAINT users_pkey;
+
+ALTER TABLE book DROP CONSTRAINT book_pkey;
@@ -0,0 +1,27 @@
+
+ALTER TABLE book ADD PRIMARY KEY (book_id);
+
+ALTER TABLE users ADD PRIMARY KEY (user_id);
+
+ALTER TABLE users ADD COLUMN login VARCHAR;
+ALTER TABLE users ADD COLUMN password VARCHAR;
+UPDATE users SET login = user_id::VARCHAR WHERE login IS NULL;
+-- '!' is no hash and Verify never matches it, 14 flags these users for password reset
+UPDATE users SET password = '!' WHERE password IS NULL;
+ALTER TABLE users ALTER COLUMN login SET NOT NULL;
+ALTER TABLE users ALTER COLUMN password SET NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_login_key UNIQUE (login);
+
+UPDATE users SET balance = 0 WHERE balance IS NULL;
+ALTER TABLE users ALTER COLUMN balance SET DEFAULT 0;
+ALTER TABLE users ALTER COLUMN balance SET NOT NULL;
+
+ALTER TABLE orders RENAME COLUMN books_id TO book_id;
+ALTER TABLE orders RENAME COLUMN users_id TO user_id;
+ALTER TABLE orders ADD PRIMARY KEY (order_id);
+
+CREATE INDEX orders_book_id_idx ON orders(book_id);
+CREATE INDEX orders_user_id_idx ON orders(user_id);
+CREATE INDEX book_created_at_idx ON book(created_at);
+CREATE INDEX users_created_at_idx ON users(created_at);
+CREATE INDEX orders_created_at_idx ON orders(created_at);
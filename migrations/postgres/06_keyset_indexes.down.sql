@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS orders_created_at_id_idx;
+DROP INDEX IF EXISTS users_created_at_id_idx;
+DROP INDEX IF EXISTS book_created_at_id_idx;
+
+CREATE INDEX book_created_at_idx ON book(created_at);
+CREATE INDEX users_created_at_idx ON users(created_at);
+CREATE INDEX orders_created_at_idx ON orders(created_at);
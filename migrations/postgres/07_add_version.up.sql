@@ -0,0 +1,3 @@
+ALTER TABLE book ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE orders ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS orders_deleted_at_idx;
+DROP INDEX IF EXISTS users_deleted_at_idx;
+DROP INDEX IF EXISTS book_deleted_at_idx;
+
+-- without deleted_at deleted rows would come back, drop those nothing references any more
+DELETE FROM orders WHERE deleted_at IS NOT NULL;
+DELETE FROM book WHERE deleted_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM orders WHERE orders.book_id = book.book_id);
+DELETE FROM users WHERE deleted_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.user_id);
+
+DROP INDEX users_login_key;
+ALTER TABLE users ADD CONSTRAINT users_login_key UNIQUE (login);
+
+ALTER TABLE orders DROP COLUMN deleted_at;
+ALTER TABLE users DROP COLUMN deleted_at;
+ALTER TABLE book DROP COLUMN deleted_at;
@@ -0,0 +1,11 @@
+ALTER TABLE book ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN deleted_at TIMESTAMP;
+
+-- login of deleted user can be taken again
+ALTER TABLE users DROP CONSTRAINT users_login_key;
+CREATE UNIQUE INDEX users_login_key ON users(login) WHERE deleted_at IS NULL;
+
+CREATE INDEX book_deleted_at_idx ON book(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX users_deleted_at_idx ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX orders_deleted_at_idx ON orders(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,8 @@
+-- order keeps book of its first item, the rest is lost
+ALTER TABLE orders ADD COLUMN book_id UUID REFERENCES book(book_id);
+UPDATE orders SET book_id = order_items.book_id
+FROM order_items WHERE order_items.order_id = orders.order_id AND order_items.line = 1;
+ALTER TABLE orders ALTER COLUMN book_id SET NOT NULL;
+CREATE INDEX orders_book_id_idx ON orders(book_id);
+
+DROP TABLE order_items;
@@ -0,0 +1,19 @@
+CREATE TABLE order_items (
+        order_id UUID NOT NULL REFERENCES orders(order_id) ON DELETE CASCADE,
+        line INTEGER NOT NULL,
+        book_id UUID NOT NULL REFERENCES book(book_id),
+        quantity INTEGER NOT NULL CHECK (quantity > 0),
+        unit_price INTEGER NOT NULL,
+        PRIMARY KEY (order_id, line),
+        UNIQUE (order_id, book_id)
+);
+
+CREATE INDEX order_items_book_id_idx ON order_items(book_id);
+
+-- orders so far bought one copy of their book, its current price is the best record of what was paid
+INSERT INTO order_items (order_id, line, book_id, quantity, unit_price)
+SELECT orders.order_id, 1, orders.book_id, 1, book.price
+FROM orders JOIN book ON book.book_id = orders.book_id;
+
+DROP INDEX orders_book_id_idx;
+ALTER TABLE orders DROP COLUMN book_id;
@@ -0,0 +1,4 @@
+DROP TABLE order_status_history;
+
+DROP INDEX orders_status_idx;
+ALTER TABLE orders DROP COLUMN status;
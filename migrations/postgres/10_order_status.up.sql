@@ -0,0 +1,19 @@
+-- orders so far had no lifecycle, they start pending like new ones
+ALTER TABLE orders ADD COLUMN status VARCHAR NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded'));
+
+CREATE INDEX orders_status_idx ON orders(status);
+
+CREATE TABLE order_status_history (
+        order_status_history_id UUID NOT NULL PRIMARY KEY,
+        order_id UUID NOT NULL REFERENCES orders(order_id) ON DELETE CASCADE,
+        from_status VARCHAR,
+        to_status VARCHAR NOT NULL,
+        changed_by UUID REFERENCES users(user_id) ON DELETE SET NULL,
+        changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX order_status_history_order_id_idx ON order_status_history(order_id, changed_at);
+
+INSERT INTO order_status_history (order_status_history_id, order_id, to_status, changed_at)
+SELECT md5(order_id::text || 'pending')::uuid, order_id, 'pending', created_at FROM orders;
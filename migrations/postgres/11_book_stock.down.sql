@@ -0,0 +1,4 @@
+DROP INDEX orders_reserved_until_idx;
+ALTER TABLE orders DROP COLUMN reserved_until;
+
+ALTER TABLE book DROP COLUMN low_stock_threshold, DROP COLUMN stock;
@@ -0,0 +1,9 @@
+-- books so far had no stock, they cannot be ordered until it is set
+ALTER TABLE book
+        ADD COLUMN stock INTEGER NOT NULL DEFAULT 0 CHECK (stock >= 0),
+        ADD COLUMN low_stock_threshold INTEGER NOT NULL DEFAULT 0 CHECK (low_stock_threshold >= 0);
+
+-- stock of pending order goes back once reserved_until passes, orders so far never expire
+ALTER TABLE orders ADD COLUMN reserved_until TIMESTAMP;
+
+CREATE INDEX orders_reserved_until_idx ON orders(reserved_until) WHERE status = 'pending';
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP CONSTRAINT users_balance_check;
+
+DROP TABLE ledger_entries;
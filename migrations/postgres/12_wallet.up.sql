@@ -0,0 +1,33 @@
+-- every change of users.balance is transaction of two entries that sum to zero, one for wallet of the user
+-- and one for cash or revenue account on the other side. users.balance caches sum of wallet entries
+CREATE TABLE ledger_entries (
+        ledger_entry_id UUID NOT NULL PRIMARY KEY,
+        transaction_id UUID NOT NULL,
+        account VARCHAR NOT NULL CHECK (account IN ('wallet', 'cash', 'revenue')),
+        user_id UUID REFERENCES users(user_id),
+        order_id UUID REFERENCES orders(order_id) ON DELETE SET NULL,
+        kind VARCHAR NOT NULL
+                CHECK (kind IN ('opening_balance', 'top_up', 'withdrawal', 'order_payment', 'order_refund')),
+        amount INTEGER NOT NULL CHECK (amount <> 0),
+        created_by UUID REFERENCES users(user_id) ON DELETE SET NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+        CHECK ((account = 'wallet') = (user_id IS NOT NULL))
+);
+
+CREATE INDEX ledger_entries_user_id_idx ON ledger_entries(user_id, created_at) WHERE user_id IS NOT NULL;
+CREATE INDEX ledger_entries_transaction_id_idx ON ledger_entries(transaction_id);
+CREATE INDEX ledger_entries_order_id_idx ON ledger_entries(order_id) WHERE order_id IS NOT NULL;
+
+-- balances so far came from nowhere, they open the ledger as cash paid in
+INSERT INTO ledger_entries (ledger_entry_id, transaction_id, account, user_id, kind, amount, created_at)
+SELECT md5(user_id::text || 'opening wallet')::uuid, md5(user_id::text || 'opening')::uuid,
+        'wallet', user_id, 'opening_balance', balance, created_at
+FROM users WHERE balance <> 0;
+
+INSERT INTO ledger_entries (ledger_entry_id, transaction_id, account, user_id, kind, amount, created_at)
+SELECT md5(user_id::text || 'opening cash')::uuid, md5(user_id::text || 'opening')::uuid,
+        'cash', NULL, 'opening_balance', -balance, created_at
+FROM users WHERE balance <> 0;
+
+-- wallets cannot be overdrawn from now on, balances already below zero are left as they are
+ALTER TABLE users ADD CONSTRAINT users_balance_check CHECK (balance >= 0) NOT VALID;
@@ -0,0 +1,5 @@
+ALTER TABLE book DROP CONSTRAINT book_price_check;
+
+ALTER TABLE ledger_entries DROP COLUMN currency;
+ALTER TABLE order_items DROP COLUMN currency;
+ALTER TABLE book DROP COLUMN currency;
@@ -0,0 +1,8 @@
+-- amounts so far had no currency, they were all in USD. Order items and ledger entries keep currency
+-- their amount was in like they keep the amount itself
+ALTER TABLE book ADD COLUMN currency VARCHAR NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE order_items ADD COLUMN currency VARCHAR NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE ledger_entries ADD COLUMN currency VARCHAR NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$');
+
+-- prices cannot go below zero from now on, prices already below it are left as they are
+ALTER TABLE book ADD CONSTRAINT book_price_check CHECK (price >= 0) NOT VALID;
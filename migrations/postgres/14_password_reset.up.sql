@@ -0,0 +1,4 @@
+-- users without password got '' or '!' from 05, '!' matches no password. They set password again through
+-- PUT or PATCH of SUPER, which clears the flag
+ALTER TABLE users ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT false;
+UPDATE users SET password = '!', password_reset_required = true WHERE password IN ('', '!');
@@ -0,0 +1,5 @@
+-- orders from before 11 never took stock off books, cancelling them must not give any back. Later pending
+-- orders got reserved_until when they reserved, those without it are left holding nothing rather than
+-- risk releasing stock that was never taken
+ALTER TABLE orders ADD COLUMN stock_reserved BOOLEAN NOT NULL DEFAULT false;
+UPDATE orders SET stock_reserved = true WHERE status = 'pending' AND reserved_until IS NOT NULL;
@@ -0,0 +1,4 @@
+INSERT INTO role_permissions (role_id, permission_id)
+        SELECT r.role_id, p.permission_id FROM roles r, permissions p
+        WHERE r.name = 'CLIENT' AND p.name = 'user:read'
+ON CONFLICT DO NOTHING;
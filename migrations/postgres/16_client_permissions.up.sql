@@ -0,0 +1,4 @@
+-- user:read lists every user with phone numbers, customers reach their own user and wallet without it
+DELETE FROM role_permissions
+WHERE role_id = (SELECT role_id FROM roles WHERE name = 'CLIENT')
+  AND permission_id = (SELECT permission_id FROM permissions WHERE name = 'user:read');
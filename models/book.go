@@ -1,39 +1,100 @@
 package models
 
+import "time"
+
 type BookPrimarKey struct {
 	Id string `json:"book_id"`
+
+	// Version, if set, must still be version of row for Delete to succeed
+	Version int32 `json:"-"`
+
+	// IncludeDeleted lets GetByPKey find deleted row too
+	IncludeDeleted bool `json:"-"`
 }
 
 type CreateBook struct {
-	Name       string `json:"name"`
-	AuthorName string `json:"author_name"`
-	Price      string `json:"price"`
-	Date       string `json:"date"`
+	Name              string `json:"name"`
+	AuthorName        string `json:"author_name"`
+	Price             Money  `json:"price"`
+	Date              string `json:"date"`
+	Stock             int32  `json:"stock"`
+	LowStockThreshold int32  `json:"low_stock_threshold"`
 }
 type Book struct {
 	Id         string `json:"book_id"`
 	Name       string `json:"name"`
 	AuthorName string `json:"author_name"`
-	Price      string `json:"price"`
+	Price      Money  `json:"price"`
 	Date       string `json:"date"`
-	CreatedAt  string `json:"created_at"`
-	UpdatedAt  string `json:"updated_at"`
+
+	// Stock is copies left for new orders, pending and paid orders hold theirs already
+	Stock             int32 `json:"stock"`
+	LowStockThreshold int32 `json:"low_stock_threshold"`
+
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	Version   int32  `json:"version"`
+	DeletedAt string `json:"deleted_at,omitempty"`
 }
 
 type UpdateBook struct {
-	Id         string `json:"book_id"`
-	Name       string `json:"name"`
-	AuthorName string `json:"author_name"`
-	Price      string `json:"price"`
-	Date       string `json:"date"`
+	Id                string `json:"book_id"`
+	Name              string `json:"name"`
+	AuthorName        string `json:"author_name"`
+	Price             Money  `json:"price"`
+	Date              string `json:"date"`
+	Stock             int32  `json:"stock"`
+	LowStockThreshold int32  `json:"low_stock_threshold"`
+
+	// Version, if set, must still be version of row
+	Version int32 `json:"-"`
+}
+
+// PatchBook changes only fields that are not nil
+type PatchBook struct {
+	Id                string  `json:"-"`
+	Name              *string `json:"name"`
+	AuthorName        *string `json:"author_name"`
+	Price             *Money  `json:"price"`
+	Date              *string `json:"date"`
+	Stock             *int32  `json:"stock"`
+	LowStockThreshold *int32  `json:"low_stock_threshold"`
+
+	// Version, if set, must still be version of row
+	Version int32 `json:"-"`
 }
 
 type GetListBookRequest struct {
 	Limit  int32
 	Offset int32
+
+	// Search matches part of name or author_name, case insensitive
+	Search      string
+	AuthorName  string
+	Currency    string
+	PriceMin    *int32
+	PriceMax    *int32
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Sort        []SortField
+
+	// IncludeDeleted lists deleted rows too
+	IncludeDeleted bool
+
+	// LowStock lists only books with stock at or below their low stock threshold
+	LowStock bool
+
+	// After switches to cursor pagination, rows come after it in (created_at, id) order.
+	// Count is left out then unless WithCount is set
+	After     *Cursor
+	WithCount bool
 }
 
 type GetListBookResponse struct {
-	Count int32   `json:"count"`
+	Count *int32  `json:"count,omitempty"`
 	Books []*Book `json:"books"`
+
+	// Next is set when more rows follow in (created_at, id) order, handlers sign it into NextCursor
+	Next       *Cursor `json:"-"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,18 @@
+package models
+
+// SortField is one entry of ?sort=-price,name, leading "-" sorts descending
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Cursor is position of last row of page in (created_at, id) order, next page starts after it
+type Cursor struct {
+	CreatedAt string
+	Id        string
+}
+
+// KeysetSorted reports whether sort leaves rows in (created_at, id) order, the only order cursors follow
+func KeysetSorted(sort []SortField) bool {
+	return len(sort) == 0 || len(sort) == 1 && sort[0] == SortField{Field: "created_at"}
+}
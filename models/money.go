@@ -0,0 +1,105 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// DefaultCurrency is currency of amounts stored before currencies existed and of amounts sent as bare number
+const DefaultCurrency = "USD"
+
+var (
+	ErrCurrencyMismatch = errors.New("currencies differ")
+	ErrMoneyOverflow    = errors.New("amount overflows")
+)
+
+// Money is Amount in minor units of Currency, cents of USD for example, so arithmetic on it is exact.
+// Currency is ISO 4217 code
+type Money struct {
+	Amount   int64  `json:"amount" example:"1250"`
+	Currency string `json:"currency" example:"USD"`
+}
+
+// ValidCurrency tells whether code looks like ISO 4217 code, three upper case letters
+func ValidCurrency(code string) bool {
+
+	if len(code) != 3 {
+		return false
+	}
+
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Add returns m plus other, both must be in the same currency
+func (m Money) Add(other Money) (Money, error) {
+
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+
+	sum := m.Amount + other.Amount
+
+	// sum of two numbers of the same sign cannot change it unless it wrapped around
+	if (m.Amount > 0 && other.Amount > 0 && sum < 0) || (m.Amount < 0 && other.Amount < 0 && sum >= 0) {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Mul returns m times n
+func (m Money) Mul(n int64) (Money, error) {
+
+	product := m.Amount * n
+
+	if n != 0 && (product/n != m.Amount || n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Neg returns m with opposite sign
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// UnmarshalJSON takes {"amount": 1250, "currency": "USD"}. Whole number alone, quoted or not, is amount
+// in DefaultCurrency like prices were sent before currencies existed
+func (m *Money) UnmarshalJSON(data []byte) error {
+
+	if string(data) == "null" {
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '{' {
+		type money Money
+		return json.Unmarshal(data, (*money)(m))
+	}
+
+	var (
+		amount json.Number
+		n      int64
+	)
+
+	err := json.Unmarshal(data, &amount)
+	if err == nil {
+		n, err = amount.Int64()
+	}
+
+	if err != nil {
+		return fmt.Errorf("amount must be whole number of minor units, got %s", data)
+	}
+
+	*m = Money{Amount: n, Currency: DefaultCurrency}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMoneyAdd(t *testing.T) {
+
+	for _, c := range []struct {
+		name    string
+		a, b    Money
+		want    Money
+		wantErr error
+	}{
+		{"sum", Money{1250, "USD"}, Money{50, "USD"}, Money{1300, "USD"}, nil},
+		{"negative", Money{1250, "USD"}, Money{-1300, "USD"}, Money{-50, "USD"}, nil},
+		{"currency mismatch", Money{1250, "USD"}, Money{50, "EUR"}, Money{}, ErrCurrencyMismatch},
+		{"missing currency", Money{1250, "USD"}, Money{50, ""}, Money{}, ErrCurrencyMismatch},
+		{"overflow", Money{math.MaxInt64, "USD"}, Money{1, "USD"}, Money{}, ErrMoneyOverflow},
+		{"underflow", Money{math.MinInt64, "USD"}, Money{-1, "USD"}, Money{}, ErrMoneyOverflow},
+		{"opposite signs at limits", Money{math.MaxInt64, "USD"}, Money{math.MinInt64, "USD"}, Money{-1, "USD"}, nil},
+	} {
+		got, err := c.a.Add(c.b)
+		if !errors.Is(err, c.wantErr) || got != c.want {
+			t.Errorf("%s: %v.Add(%v) = %v, %v, want %v, %v", c.name, c.a, c.b, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+func TestMoneyMul(t *testing.T) {
+
+	for _, c := range []struct {
+		name    string
+		m       Money
+		n       int64
+		want    Money
+		wantErr error
+	}{
+		{"product", Money{1250, "EUR"}, 3, Money{3750, "EUR"}, nil},
+		{"zero", Money{math.MaxInt64, "EUR"}, 0, Money{0, "EUR"}, nil},
+		{"negative", Money{1250, "EUR"}, -2, Money{-2500, "EUR"}, nil},
+		{"overflow", Money{math.MaxInt64/2 + 1, "EUR"}, 2, Money{}, ErrMoneyOverflow},
+		{"min times minus one", Money{math.MinInt64, "EUR"}, -1, Money{}, ErrMoneyOverflow},
+	} {
+		got, err := c.m.Mul(c.n)
+		if !errors.Is(err, c.wantErr) || got != c.want {
+			t.Errorf("%s: %v.Mul(%d) = %v, %v, want %v, %v", c.name, c.m, c.n, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+
+	for _, c := range []struct {
+		name    string
+		data    string
+		want    Money
+		wantErr bool
+	}{
+		{"object", `{"amount": 1250, "currency": "EUR"}`, Money{1250, "EUR"}, false},
+		{"bare number", `1250`, Money{1250, DefaultCurrency}, false},
+		{"quoted number", `"1250"`, Money{1250, DefaultCurrency}, false},
+		{"negative number", `-5`, Money{-5, DefaultCurrency}, false},
+		{"null", `null`, Money{7, "GBP"}, false},
+		{"fraction", `12.50`, Money{7, "GBP"}, true},
+		{"quoted fraction", `"12.50"`, Money{7, "GBP"}, true},
+		{"word", `"twelve"`, Money{7, "GBP"}, true},
+		{"too large", `9223372036854775808`, Money{7, "GBP"}, true},
+		{"bool", `true`, Money{7, "GBP"}, true},
+	} {
+		// null and errors leave money as it was
+		got := Money{7, "GBP"}
+
+		err := json.Unmarshal([]byte(c.data), &got)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("%s: Unmarshal(%s) = %v, %v, want %v, error %v", c.name, c.data, got, err, c.want, c.wantErr)
+		}
+	}
+
+	var book struct {
+		Price Money `json:"price"`
+	}
+
+	err := json.Unmarshal([]byte(`{"price": "1250"}`), &book)
+	if err != nil || book.Price != (Money{1250, DefaultCurrency}) {
+		t.Errorf("Unmarshal of field = %v, %v, want %v", book.Price, err, Money{1250, DefaultCurrency})
+	}
+}
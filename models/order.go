@@ -1,35 +1,109 @@
 package models
 
+import "time"
+
 type OrderPrimarKey struct {
-	Id string `json:"order_id"`
+	Id    string `json:"order_id"`
 	Login string `json:"login"`
+
+	// Version, if set, must still be version of row for Delete to succeed
+	Version int32 `json:"-"`
+
+	// IncludeDeleted lets GetByPKey find deleted row too
+	IncludeDeleted bool `json:"-"`
+}
+
+// CreateOrderItem is book bought by order, its unit price is taken from book when order is created
+type CreateOrderItem struct {
+	BookId   string `json:"book_id"`
+	Quantity int32  `json:"quantity"`
 }
 
 type CreateOrder struct {
-	BookId string `json:"book_id"`
-	UserId string `json:"user_id"`
+	UserId string             `json:"user_id"`
+	Items  []*CreateOrderItem `json:"items"`
+
+	// BookId is shorthand for single item of quantity 1, it cannot be combined with Items
+	BookId string `json:"book_id,omitempty"`
+
+	// CreatedBy is user recorded in status history as creator of order
+	CreatedBy string `json:"-"`
+
+	// ReservedUntil is when stock held by order goes back unless it is paid by then, zero holds it
+	// until order moves on
+	ReservedUntil time.Time `json:"-"`
 }
 
-type Order struct {
-	Id        string `json:"order_id"`
+// OrderItem keeps price book had when order was created, Total is Quantity times UnitPrice.
+// Items of one order share currency
+type OrderItem struct {
 	BookId    string `json:"book_id"`
-	UserId    string `json:"user_id"`
+	Quantity  int32  `json:"quantity"`
+	UnitPrice Money  `json:"unit_price"`
+	Total     Money  `json:"total"`
+}
+
+type Order struct {
+	Id     string       `json:"order_id"`
+	UserId string       `json:"user_id"`
+	Status string       `json:"status"`
+	Items  []*OrderItem `json:"items"`
+	Total  Money        `json:"total"`
+
+	// ReservedUntil is set while pending order holds stock, it is cancelled once it passes
+	ReservedUntil string `json:"reserved_until,omitempty"`
+
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
+	Version   int32  `json:"version"`
+	DeletedAt string `json:"deleted_at,omitempty"`
 }
 
+// UpdateOrder changes header of pending order, its items are fixed once order is created
+// and its status changes only by OrderTransition
 type UpdateOrder struct {
 	Id     string `json:"order_id"`
-	BookId string `json:"book_id"`
 	UserId string `json:"user_id"`
+
+	// Version, if set, must still be version of row
+	Version int32 `json:"-"`
+}
+
+// PatchOrder changes only fields that are not nil, order must be pending like for UpdateOrder
+type PatchOrder struct {
+	Id     string  `json:"-"`
+	UserId *string `json:"user_id"`
+
+	// Version, if set, must still be version of row
+	Version int32 `json:"-"`
 }
 
 type GetListOrderRequest struct {
 	Limit  int32
 	Offset int32
+
+	// BookId keeps orders with item of the book
+	BookId      string
+	UserId      string
+	Status      string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Sort        []SortField
+
+	// IncludeDeleted lists deleted rows too
+	IncludeDeleted bool
+
+	// After switches to cursor pagination, rows come after it in (created_at, id) order.
+	// Count is left out then unless WithCount is set
+	After     *Cursor
+	WithCount bool
 }
 
 type GetListOrderResponse struct {
-	Count  int32    `json:"count"`
+	Count  *int32   `json:"count,omitempty"`
 	Orders []*Order `json:"orders"`
+
+	// Next is set when more rows follow in (created_at, id) order, handlers sign it into NextCursor
+	Next       *Cursor `json:"-"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,59 @@
+package models
+
+// Order statuses. Order starts pending and moves only along orderTransitions
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderShipped   = "shipped"
+	OrderDelivered = "delivered"
+	OrderCancelled = "cancelled"
+	OrderRefunded  = "refunded"
+)
+
+var orderTransitions = map[string][]string{
+	OrderPending:   {OrderPaid, OrderCancelled},
+	OrderPaid:      {OrderShipped, OrderRefunded},
+	OrderShipped:   {OrderDelivered},
+	OrderDelivered: {OrderRefunded},
+}
+
+// CanTransition reports whether order with status from may move to status to
+func CanTransition(from, to string) bool {
+
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidOrderStatus reports whether status is one of order statuses
+func ValidOrderStatus(status string) bool {
+
+	switch status {
+	case OrderPending, OrderPaid, OrderShipped, OrderDelivered, OrderCancelled, OrderRefunded:
+		return true
+	}
+
+	return false
+}
+
+// OrderTransition moves order to Status, ChangedBy is user recorded in history
+type OrderTransition struct {
+	Id        string
+	Status    string
+	ChangedBy string
+
+	// Version, if set, must still be version of row
+	Version int32
+}
+
+// OrderStatusChange is row of order status history, FromStatus is empty for creation of order
+type OrderStatusChange struct {
+	FromStatus string `json:"from_status,omitempty"`
+	ToStatus   string `json:"to_status"`
+	ChangedBy  string `json:"changed_by,omitempty"`
+	ChangedAt  string `json:"changed_at"`
+}
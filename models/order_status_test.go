@@ -0,0 +1,48 @@
+package models
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+
+	statuses := []string{OrderPending, OrderPaid, OrderShipped, OrderDelivered, OrderCancelled, OrderRefunded}
+
+	allowed := map[[2]string]bool{
+		{OrderPending, OrderPaid}:       true,
+		{OrderPending, OrderCancelled}:  true,
+		{OrderPaid, OrderShipped}:       true,
+		{OrderPaid, OrderRefunded}:      true,
+		{OrderShipped, OrderDelivered}:  true,
+		{OrderDelivered, OrderRefunded}: true,
+	}
+
+	// every pair not listed above, staying in place and leaving cancelled or refunded included, is forbidden
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]string{from, to}]
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%q, %q) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+
+	for _, c := range [][2]string{{"", OrderPaid}, {"unknown", OrderPaid}, {OrderPending, ""}, {OrderPending, "unknown"}} {
+		if CanTransition(c[0], c[1]) {
+			t.Errorf("CanTransition(%q, %q) = true, want false", c[0], c[1])
+		}
+	}
+}
+
+func TestValidOrderStatus(t *testing.T) {
+
+	for _, status := range []string{OrderPending, OrderPaid, OrderShipped, OrderDelivered, OrderCancelled, OrderRefunded} {
+		if !ValidOrderStatus(status) {
+			t.Errorf("ValidOrderStatus(%q) = false, want true", status)
+		}
+	}
+
+	for _, status := range []string{"", "Pending", "unknown"} {
+		if ValidOrderStatus(status) {
+			t.Errorf("ValidOrderStatus(%q) = true, want false", status)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package models
+
+type RolePrimarKey struct {
+	Id   string `json:"role_id"`
+	Name string `json:"name"`
+}
+
+type CreateRole struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type Role struct {
+	Id          string   `json:"role_id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+}
+
+type UpdateRole struct {
+	Id          string   `json:"role_id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type GetListRoleRequest struct {
+	Limit  int32
+	Offset int32
+}
+
+type GetListRoleResponse struct {
+	Count int32   `json:"count"`
+	Roles []*Role `json:"roles"`
+}
+
+type UserRole struct {
+	UserId string `json:"user_id"`
+	Role   string `json:"role"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+type RefreshTokenPrimarKey struct {
+	Id        string `json:"refresh_token_id"`
+	TokenHash string `json:"token_hash"`
+}
+
+// CreateRefreshToken stores refresh token, Role is comma separated roles of its access tokens.
+// Refresh reads current roles of user and uses Role only to tell sessions of /loginsuper
+type CreateRefreshToken struct {
+	FamilyId  string    `json:"family_id"`
+	UserId    string    `json:"user_id"`
+	TokenHash string    `json:"token_hash"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RefreshToken struct {
+	Id        string     `json:"refresh_token_id"`
+	FamilyId  string     `json:"family_id"`
+	UserId    string     `json:"user_id"`
+	Role      string     `json:"role"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt string     `json:"created_at"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RevokeToken struct {
+	Jti       string    `json:"jti"`
+	UserId    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RevokeUserTokens struct {
+	UserId        string    `json:"user_id"`
+	RevokedBefore time.Time `json:"revoked_before"`
+}
+
+type Revocations struct {
+	Tokens []*RevokeToken      `json:"tokens"`
+	Users  []*RevokeUserTokens `json:"users"`
+}
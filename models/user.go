@@ -1,8 +1,16 @@
 package models
 
+import "time"
+
 type UserPrimarKey struct {
 	Id    string `json:"user_id"`
 	Login string `json:"login"`
+
+	// Version, if set, must still be version of row for Delete to succeed
+	Version int32 `json:"-"`
+
+	// IncludeDeleted lets GetByPKey find deleted row too
+	IncludeDeleted bool `json:"-"`
 }
 
 type CreateUser struct {
@@ -18,10 +26,15 @@ type User struct {
 	FirstName   string `json:"first_name"`
 	LastName    string `json:"last_name"`
 	Login       string `json:"login"`
-	Password    string `json:"password"`
+	Password    string `json:"-"`
 	PhoneNumber string `json:"phone_number"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
+	Version     int32  `json:"version"`
+	DeletedAt   string `json:"deleted_at,omitempty"`
+
+	// PasswordResetRequired marks legacy user without password, it cannot log in until password is set
+	PasswordResetRequired bool `json:"password_reset_required"`
 }
 
 type UpdateUser struct {
@@ -31,14 +44,60 @@ type UpdateUser struct {
 	Login       string `json:"login"`
 	Password    string `json:"password"`
 	PhoneNumber string `json:"phone_number"`
+
+	// CurrentPassword is required unless caller is SUPER, since PUT always sets password
+	CurrentPassword string `json:"current_password"`
+
+	// Version, if set, must still be version of row
+	Version int32 `json:"-"`
+}
+
+// PatchUser changes only fields that are not nil
+type PatchUser struct {
+	Id          string  `json:"-"`
+	FirstName   *string `json:"first_name"`
+	LastName    *string `json:"last_name"`
+	Login       *string `json:"login"`
+	Password    *string `json:"password"`
+	PhoneNumber *string `json:"phone_number"`
+
+	// CurrentPassword is required with Password unless caller is SUPER
+	CurrentPassword *string `json:"current_password"`
+
+	// Version, if set, must still be version of row
+	Version int32 `json:"-"`
+}
+
+type UpdateUserPassword struct {
+	Id       string `json:"id"`
+	Password string `json:"password"`
 }
 
 type GetListUserRequest struct {
 	Limit  int32
 	Offset int32
+
+	// Search matches part of first_name, last_name, login or phone_number, case insensitive
+	Search      string
+	Login       string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Sort        []SortField
+
+	// IncludeDeleted lists deleted rows too
+	IncludeDeleted bool
+
+	// After switches to cursor pagination, rows come after it in (created_at, id) order.
+	// Count is left out then unless WithCount is set
+	After     *Cursor
+	WithCount bool
 }
 
 type GetListUserResponse struct {
-	Count int32   `json:"count"`
+	Count *int32  `json:"count,omitempty"`
 	Users []*User `json:"users"`
+
+	// Next is set when more rows follow in (created_at, id) order, handlers sign it into NextCursor
+	Next       *Cursor `json:"-"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
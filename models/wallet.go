@@ -0,0 +1,67 @@
+package models
+
+// Ledger accounts. Wallet entries belong to user, cash and revenue are the other side of their transactions
+const (
+	AccountWallet  = "wallet"
+	AccountCash    = "cash"
+	AccountRevenue = "revenue"
+)
+
+// Kinds of ledger transactions
+const (
+	LedgerOpeningBalance = "opening_balance"
+	LedgerTopUp          = "top_up"
+	LedgerWithdrawal     = "withdrawal"
+	LedgerOrderPayment   = "order_payment"
+	LedgerOrderRefund    = "order_refund"
+)
+
+// WalletCurrency is currency every wallet holds, orders priced in another one cannot be paid from it
+const WalletCurrency = DefaultCurrency
+
+// Wallet is balance of user, sum of wallet entries of the ledger
+type Wallet struct {
+	UserId  string `json:"user_id"`
+	Balance Money  `json:"balance"`
+}
+
+// WalletOperation tops up or withdraws positive Amount of WalletCurrency, CreatedBy is user recorded in ledger
+type WalletOperation struct {
+	UserId    string `json:"-"`
+	Amount    Money  `json:"amount"`
+	CreatedBy string `json:"-"`
+}
+
+// LedgerEntry is one side of transaction, entries of one TransactionId sum to zero.
+// UserId is set for wallet entries only and Amount is negative when money leaves account
+type LedgerEntry struct {
+	Id            string `json:"ledger_entry_id"`
+	TransactionId string `json:"transaction_id"`
+	Account       string `json:"account"`
+	UserId        string `json:"user_id,omitempty"`
+	OrderId       string `json:"order_id,omitempty"`
+	Kind          string `json:"kind"`
+	Amount        Money  `json:"amount"`
+	CreatedBy     string `json:"created_by,omitempty"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// GetLedgerRequest lists wallet entries of user, oldest first
+type GetLedgerRequest struct {
+	UserId string
+	Limit  int32
+	Offset int32
+}
+
+type GetLedgerResponse struct {
+	Count   int32          `json:"count"`
+	Entries []*LedgerEntry `json:"entries"`
+}
+
+// BalanceMismatch is user whose cached Balance differed from LedgerBalance, reconciliation sets it to
+// LedgerBalance
+type BalanceMismatch struct {
+	UserId        string `json:"user_id"`
+	Balance       Money  `json:"balance"`
+	LedgerBalance Money  `json:"ledger_balance"`
+}
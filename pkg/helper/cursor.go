@@ -0,0 +1,80 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"crud/models"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type cursorPayload struct {
+	List      string `json:"l"`
+	CreatedAt string `json:"t"`
+	Id        string `json:"i"`
+}
+
+// EncodeCursor makes opaque cursor of list, like "book", signed so clients cannot forge
+// positions or pass cursor of one list to another
+func EncodeCursor(secret, list string, cursor *models.Cursor) string {
+
+	payload, _ := json.Marshal(cursorPayload{
+		List:      list,
+		CreatedAt: cursor.CreatedAt,
+		Id:        cursor.Id,
+	})
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signCursor(secret, encoded))
+}
+
+// DecodeCursor verifies cursor made by EncodeCursor for the same list
+func DecodeCursor(secret, list, value string) (*models.Cursor, error) {
+
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, signCursor(secret, encoded)) {
+		return nil, ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var payload cursorPayload
+
+	err = json.Unmarshal(data, &payload)
+	if err != nil || payload.List != list || payload.Id == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	_, err = time.Parse(time.RFC3339Nano, payload.CreatedAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &models.Cursor{CreatedAt: payload.CreatedAt, Id: payload.Id}, nil
+}
+
+func signCursor(secret, encoded string) []byte {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+
+	// keeps cursor signatures apart from anything else signed with the same secret
+	mac.Write([]byte("cursor."))
+	mac.Write([]byte(encoded))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,71 @@
+package helper
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"crud/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+
+	cursor := &models.Cursor{CreatedAt: "2024-05-01T10:20:30.123456Z", Id: "3f1c2d4e-0000-4000-8000-000000000001"}
+
+	value := EncodeCursor("secret", "book", cursor)
+
+	got, err := DecodeCursor("secret", "book", value)
+	if err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+
+	if *got != *cursor {
+		t.Fatalf("DecodeCursor = %+v, want %+v", got, cursor)
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+
+	cursor := &models.Cursor{CreatedAt: "2024-05-01T10:20:30Z", Id: "3f1c2d4e-0000-4000-8000-000000000001"}
+
+	value := EncodeCursor("secret", "book", cursor)
+	encoded, signature, _ := strings.Cut(value, ".")
+
+	// payload of other position signed with other key, kept to swap parts of cursors
+	forged := EncodeCursor("other", "book", &models.Cursor{CreatedAt: cursor.CreatedAt, Id: "other"})
+	forgedEncoded, forgedSignature, _ := strings.Cut(forged, ".")
+
+	sign := func(payload string) string {
+		encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+		return encoded + "." + base64.RawURLEncoding.EncodeToString(signCursor("secret", encoded))
+	}
+
+	for _, c := range []struct {
+		name, secret, list, value string
+	}{
+		{"wrong key", "other", "book", value},
+		{"other list", "secret", "order", value},
+		{"no signature", "secret", "book", encoded},
+		{"empty", "secret", "book", ""},
+		{"signature not base64", "secret", "book", encoded + ".!!!"},
+		{"tampered payload", "secret", "book", forgedEncoded + "." + signature},
+		{"signature of other key", "secret", "book", encoded + "." + forgedSignature},
+		{"flipped signature byte", "secret", "book", encoded + "." + flip(signature)},
+		{"payload not json", "secret", "book", sign("not json")},
+		{"missing id", "secret", "book", sign(`{"l":"book","t":"2024-05-01T10:20:30Z"}`)},
+		{"bad time", "secret", "book", sign(`{"l":"book","t":"yesterday","i":"1"}`)},
+	} {
+		_, err := DecodeCursor(c.secret, c.list, c.value)
+		if err != ErrInvalidCursor {
+			t.Errorf("%s: DecodeCursor = %v, want %v", c.name, err, ErrInvalidCursor)
+		}
+	}
+}
+
+// flip changes first character of base64 text to another valid one
+func flip(text string) string {
+	if text[0] == 'A' {
+		return "B" + text[1:]
+	}
+	return "A" + text[1:]
+}
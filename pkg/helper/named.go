@@ -0,0 +1,220 @@
+package helper
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// namedQuery is query with :name params turned into $n placeholders, names[n-1] is name of $n
+type namedQuery struct {
+	query string
+	names []string
+}
+
+// maxNamedQueries bounds namedQueries. Queries built at run time, like SET lists of PATCH, vary with input,
+// once the cache is full they are parsed on every call instead of growing it
+const maxNamedQueries = 512
+
+// namedQueries caches parsed queries by their text, repos pass the same constant queries again and again
+var (
+	namedMu      sync.RWMutex
+	namedQueries = map[string]*namedQuery{}
+)
+
+// BindNamed turns :name params of query into $1, $2... numbered in order of first use and returns
+// values of params in the same order. The same name used twice binds to one placeholder.
+// String literals, quoted identifiers, comments, dollar quoted strings and ::casts are left alone.
+// Params used by query but missing from params, or passed but not used, are errors.
+func BindNamed(query string, params map[string]interface{}) (string, []interface{}, error) {
+
+	namedMu.RLock()
+	parsed, ok := namedQueries[query]
+	namedMu.RUnlock()
+
+	if !ok {
+		var err error
+
+		parsed, err = parseNamed(query)
+		if err != nil {
+			return "", nil, err
+		}
+
+		namedMu.Lock()
+		if len(namedQueries) < maxNamedQueries {
+			namedQueries[query] = parsed
+		}
+		namedMu.Unlock()
+	}
+
+	var (
+		args = make([]interface{}, len(parsed.names))
+		used = make(map[string]bool, len(parsed.names))
+	)
+
+	for i, name := range parsed.names {
+		value, ok := params[name]
+		if !ok {
+			return "", nil, fmt.Errorf("named query: missing param %q", name)
+		}
+
+		args[i] = value
+		used[name] = true
+	}
+
+	var unused []string
+
+	for name := range params {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		return "", nil, fmt.Errorf("named query: unused params %q", unused)
+	}
+
+	return parsed.query, args, nil
+}
+
+func parseNamed(query string) (*namedQuery, error) {
+
+	var (
+		b       strings.Builder
+		names   []string
+		numbers = map[string]int{}
+		i       = 0
+	)
+
+	for i < len(query) {
+		end, err := skipQuoted(query, i)
+		if err != nil {
+			return nil, err
+		}
+
+		if end > i {
+			b.WriteString(query[i:end])
+			i = end
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(query[i:], "::"):
+			b.WriteString("::")
+			i += 2
+
+		case query[i] == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			end := i + 2
+			for end < len(query) && isNamePart(query[end]) {
+				end++
+			}
+
+			name := query[i+1 : end]
+
+			n, ok := numbers[name]
+			if !ok {
+				names = append(names, name)
+				n = len(names)
+				numbers[name] = n
+			}
+
+			b.WriteString("$" + strconv.Itoa(n))
+			i = end
+
+		default:
+			b.WriteByte(query[i])
+			i++
+		}
+	}
+
+	return &namedQuery{query: b.String(), names: names}, nil
+}
+
+// skipQuoted returns end of string literal, quoted identifier, comment or dollar quoted string
+// starting at i, or i itself when none starts there
+func skipQuoted(query string, i int) (int, error) {
+
+	rest := query[i:]
+
+	switch {
+	case rest[0] == '\'' || rest[0] == '"':
+		// E'...' strings may escape quotes with backslash as well as by doubling
+		escapes := rest[0] == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') &&
+			(i == 1 || !isNamePart(query[i-2]))
+
+		for j := 1; j < len(rest); j++ {
+			switch {
+			case escapes && rest[j] == '\\':
+				j++
+			case rest[j] == rest[0] && j+1 < len(rest) && rest[j+1] == rest[0]:
+				j++
+			case rest[j] == rest[0]:
+				return i + j + 1, nil
+			}
+		}
+
+		return 0, fmt.Errorf("named query: unterminated %c at %d", rest[0], i)
+
+	case strings.HasPrefix(rest, "--"):
+		end := strings.IndexByte(rest, '\n')
+		if end < 0 {
+			return len(query), nil
+		}
+
+		return i + end + 1, nil
+
+	case strings.HasPrefix(rest, "/*"):
+		// block comments nest in postgres
+		depth := 0
+
+		for j := 0; j+1 < len(rest); j++ {
+			switch {
+			case rest[j] == '/' && rest[j+1] == '*':
+				depth++
+				j++
+			case rest[j] == '*' && rest[j+1] == '/':
+				depth--
+				j++
+
+				if depth == 0 {
+					return i + j + 1, nil
+				}
+			}
+		}
+
+		return 0, fmt.Errorf("named query: unterminated comment at %d", i)
+
+	case rest[0] == '$' && (i == 0 || !isNamePart(query[i-1])):
+		end := 1
+		for end < len(rest) && rest[end] != '$' && isNamePart(rest[end]) && (end > 1 || isNameStart(rest[end])) {
+			end++
+		}
+
+		// $1 placeholders and other $ uses are not dollar quotes
+		if end >= len(rest) || rest[end] != '$' {
+			return i, nil
+		}
+
+		tag := rest[:end+1]
+
+		body := strings.Index(rest[len(tag):], tag)
+		if body < 0 {
+			return 0, fmt.Errorf("named query: unterminated %s at %d", tag, i)
+		}
+
+		return i + len(tag) + body + len(tag), nil
+	}
+
+	return i, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNamePart(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
@@ -0,0 +1,125 @@
+package helper
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestBindNamed(t *testing.T) {
+
+	for _, c := range []struct {
+		name   string
+		query  string
+		params map[string]interface{}
+		want   string
+		args   []interface{}
+		err    bool
+	}{
+		{
+			name:   "numbered in order of first use",
+			query:  "UPDATE book SET name = :name, price = :price WHERE book_id = :id",
+			params: map[string]interface{}{"id": "1", "name": "Go", "price": 10},
+			want:   "UPDATE book SET name = $1, price = $2 WHERE book_id = $3",
+			args:   []interface{}{"Go", 10, "1"},
+		},
+		{
+			name:   "repeated name binds once",
+			query:  "SELECT :a, :b, :a",
+			params: map[string]interface{}{"a": 1, "b": 2},
+			want:   "SELECT $1, $2, $1",
+			args:   []interface{}{1, 2},
+		},
+		{
+			name:   "casts",
+			query:  "SELECT :at::timestamp, created_at::date FROM book",
+			params: map[string]interface{}{"at": "now"},
+			want:   "SELECT $1::timestamp, created_at::date FROM book",
+			args:   []interface{}{"now"},
+		},
+		{
+			name:   "string literals and identifiers",
+			query:  `SELECT ':skip', 'it''s :skip', E'\':skip', ":skip" FROM book WHERE name = :name`,
+			params: map[string]interface{}{"name": "x"},
+			want:   `SELECT ':skip', 'it''s :skip', E'\':skip', ":skip" FROM book WHERE name = $1`,
+			args:   []interface{}{"x"},
+		},
+		{
+			name:   "comments and dollar quotes",
+			query:  "SELECT $$:skip$$, $tag$ :skip $tag$ -- :skip\n/* :skip /* :skip */ */ , :name",
+			params: map[string]interface{}{"name": "x"},
+			want:   "SELECT $$:skip$$, $tag$ :skip $tag$ -- :skip\n/* :skip /* :skip */ */ , $1",
+			args:   []interface{}{"x"},
+		},
+		{
+			name:   "missing param",
+			query:  "SELECT :a, :b",
+			params: map[string]interface{}{"a": 1},
+			err:    true,
+		},
+		{
+			name:   "unused param",
+			query:  "SELECT :a",
+			params: map[string]interface{}{"a": 1, "b": 2},
+			err:    true,
+		},
+		{
+			name:  "unterminated literal",
+			query: "SELECT 'open",
+			err:   true,
+		},
+		{
+			name:  "unterminated comment",
+			query: "SELECT /* open",
+			err:   true,
+		},
+	} {
+		got, args, err := BindNamed(c.query, c.params)
+
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: BindNamed succeeded, want error", c.name)
+			}
+			continue
+		}
+
+		if err != nil || got != c.want || !reflect.DeepEqual(args, c.args) {
+			t.Errorf("%s: BindNamed = %q, %v, %v, want %q, %v", c.name, got, args, err, c.want, c.args)
+		}
+	}
+}
+
+func TestBindNamedCache(t *testing.T) {
+
+	query := "SELECT :cached"
+
+	for i := 0; i < 2; i++ {
+		got, args, err := BindNamed(query, map[string]interface{}{"cached": i})
+		if err != nil || got != "SELECT $1" || args[0] != i {
+			t.Fatalf("BindNamed call %d = %q, %v, %v", i, got, args, err)
+		}
+	}
+
+	namedMu.RLock()
+	_, ok := namedQueries[query]
+	namedMu.RUnlock()
+
+	if !ok {
+		t.Fatalf("parsed query was not cached")
+	}
+
+	for i := 0; i < maxNamedQueries*2; i++ {
+		_, _, err := BindNamed(fmt.Sprintf("SELECT :a, %d", i), map[string]interface{}{"a": i})
+		if err != nil {
+			t.Fatalf("BindNamed: %v", err)
+		}
+	}
+
+	namedMu.RLock()
+	size := len(namedQueries)
+	namedMu.RUnlock()
+
+	if size > maxNamedQueries {
+		t.Fatalf("cache holds %d queries, want at most %d", size, maxNamedQueries)
+	}
+}
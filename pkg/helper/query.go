@@ -0,0 +1,52 @@
+package helper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"crud/models"
+)
+
+// ParseSort reads comma separated field names, "-" prefix means descending: "-price,name".
+// Field names are whitelisted by storage
+func ParseSort(sort string) ([]models.SortField, error) {
+
+	var fields []models.SortField
+
+	if sort == "" {
+		return nil, nil
+	}
+
+	for _, part := range strings.Split(sort, ",") {
+		field := models.SortField{Field: strings.TrimSpace(part)}
+
+		if strings.HasPrefix(field.Field, "-") {
+			field.Field, field.Desc = field.Field[1:], true
+		}
+
+		if field.Field == "" {
+			return nil, fmt.Errorf("invalid sort %q", sort)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// ParseTime accepts RFC 3339 time or date like 2006-01-02, which means midnight UTC
+func ParseTime(value string) (time.Time, error) {
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t.UTC(), nil
+	}
+
+	t, err = time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, want RFC 3339 or 2006-01-02", value)
+	}
+
+	return t, nil
+}
@@ -1,38 +1,67 @@
 package helper
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+
+	"crud/pkg/keys"
+)
+
+// TokenInfoKey is gin context key of TokenInfo of authenticated request
+const TokenInfoKey = "token_info"
+
+var (
+	ErrInvalidIssuer   = errors.New("invalid token issuer")
+	ErrInvalidAudience = errors.New("invalid token audience")
+	ErrTokenExpired    = errors.New("token is expired")
 )
 
 type TokenInfo struct {
 	UserID string
+
+	// Roles are every role user had when token was issued, SUPER only in tokens of /loginsuper
+	Roles     []string
+	JTI       string
+	SessionID string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
 }
 
-// GenerateJWT ...  CRETAE TOKEN!!!
-func GenerateJWT(m map[string]interface{}, tokenExpireTime time.Duration, tokenSecretKey, tokenStatus string) (tokenString string, err error) {
-	var token *jwt.Token
+// HasRole reports whether token carries role
+func (t TokenInfo) HasRole(role string) bool {
+	for _, r := range t.Roles {
+		if strings.EqualFold(r, role) {
+			return true
+		}
+	}
+	return false
+}
 
-	token = jwt.New(jwt.SigningMethodHS256)
+// GenerateJWT ...  CRETAE TOKEN!!!
+func GenerateJWT(m map[string]interface{}, tokenExpireTime time.Duration, keySet *keys.Set) (tokenString string, err error) {
 
-	claims := token.Claims.(jwt.MapClaims)
+	claims := jwt.MapClaims{}
 
 	for key, value := range m {
 		claims[key] = value
 	}
 
+	if _, ok := claims["jti"]; !ok {
+		claims["jti"] = uuid.New().String()
+	}
+
 	claims["iat"] = time.Now().Unix()
 	claims["exp"] = time.Now().Add(tokenExpireTime).Unix()
 
-	tokenString, err = token.SignedString([]byte(tokenSecretKey))
-	if err != nil {
-		return "", err
-	}
-
-	tokenString, err = token.SignedString([]byte(tokenStatus))
+	tokenString, err = keySet.Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -40,39 +69,84 @@ func GenerateJWT(m map[string]interface{}, tokenExpireTime time.Duration, tokenS
 	return tokenString, nil
 }
 
-
-// READ TOKEN
-func ParseClaims(token string, secretKey string) (result TokenInfo, err error) {
+// ParseClaims validates token and its issuer and audience and returns info about token owner
+func ParseClaims(token string, keySet *keys.Set, issuer, audience string) (result TokenInfo, err error) {
 	var ok bool
 	var claims jwt.MapClaims
 
-	claims, err = ExtractClaims(token, secretKey)
+	claims, err = ExtractClaims(token, keySet)
 	if err != nil {
 		return result, err
 	}
 
+	if !claims.VerifyIssuer(issuer, true) {
+		return result, ErrInvalidIssuer
+	}
+
+	if !claims.VerifyAudience(audience, true) {
+		return result, ErrInvalidAudience
+	}
+
+	if _, ok = claims["exp"]; !ok {
+		return result, errors.New("missing 'exp' field")
+	}
+
 	result.UserID, ok = claims["user_id"].(string)
 	if !ok {
 		err = errors.New("cannot parse 'user_id' field")
 		return result, err
 	}
 
+	result.JTI, ok = claims["jti"].(string)
+	if !ok {
+		err = errors.New("cannot parse 'jti' field")
+		return result, err
+	}
+
+	roles, ok := claims["roles"].([]interface{})
+	if !ok {
+		err = errors.New("cannot parse 'roles' field")
+		return result, err
+	}
+
+	for _, role := range roles {
+		name, ok := role.(string)
+		if !ok {
+			err = errors.New("cannot parse 'roles' field")
+			return result, err
+		}
+		result.Roles = append(result.Roles, name)
+	}
+
+	result.SessionID, _ = claims["sid"].(string)
+
+	if iat, ok := claims["iat"].(float64); ok {
+		result.IssuedAt = time.Unix(int64(iat), 0)
+	}
+
+	if exp, ok := claims["exp"].(float64); ok {
+		result.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+
 	return
 }
 
-// ExtractClaims extracts claims from given token
-func ExtractClaims(tokenString string, tokenSecretKey string) (jwt.MapClaims, error) {
+// ExtractClaims extracts claims from given token, token must be signed by key of set named in kid header
+func ExtractClaims(tokenString string, keySet *keys.Set) (jwt.MapClaims, error) {
 	var (
 		token *jwt.Token
 		err   error
 	)
 
-	token, err = jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// check token signing method etc
-		return []byte(tokenSecretKey), nil
-	})
+	parser := jwt.Parser{ValidMethods: keySet.Algorithms()}
+
+	token, err = parser.Parse(tokenString, keySet.Keyfunc)
 
 	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, ErrTokenExpired
+		}
 		return nil, err
 	}
 
@@ -84,11 +158,31 @@ func ExtractClaims(tokenString string, tokenSecretKey string) (jwt.MapClaims, er
 	return claims, nil
 }
 
-// ExtractToken checks and returns token part of input string
+// ExtractToken checks and returns token part of "Bearer <token>" string
 func ExtractToken(bearer string) (token string, err error) {
 	strArr := strings.Split(bearer, " ")
-	if len(strArr) == 2 {
+	if len(strArr) == 2 && strings.EqualFold(strArr[0], "Bearer") && strArr[1] != "" {
 		return strArr[1], nil
 	}
 	return token, errors.New("wrong token format")
-}
\ No newline at end of file
+}
+
+// GenerateRefreshToken returns opaque refresh token and hash of it for storing
+func GenerateRefreshToken() (token string, hash string, err error) {
+	buf := make([]byte, 32)
+
+	_, err = rand.Read(buf)
+	if err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(buf)
+
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns hash under which refresh token is stored
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
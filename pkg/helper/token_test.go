@@ -0,0 +1,122 @@
+package helper
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"crud/pkg/keys"
+)
+
+func TestParseClaims(t *testing.T) {
+
+	const (
+		issuer   = "crud"
+		audience = "crud-api"
+	)
+
+	keySet := keys.NewHMAC("0123456789abcdef0123")
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		m := map[string]interface{}{
+			"iss":     issuer,
+			"aud":     audience,
+			"user_id": "user",
+			"roles":   []string{"CLIENT"},
+		}
+		for key, value := range changes {
+			if value == nil {
+				delete(m, key)
+				continue
+			}
+			m[key] = value
+		}
+		return m
+	}
+
+	sign := func(changes map[string]interface{}, ttl time.Duration) string {
+		t.Helper()
+
+		token, err := GenerateJWT(claims(changes), ttl, keySet)
+		if err != nil {
+			t.Fatalf("GenerateJWT: %v", err)
+		}
+		return token
+	}
+
+	// signWith signs valid claims under kid of the set with method and key given
+	signWith := func(method jwt.SigningMethod, key interface{}) string {
+		t.Helper()
+
+		token := jwt.NewWithClaims(method, jwt.MapClaims(claims(map[string]interface{}{
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})))
+		token.Header["kid"] = "hs256"
+
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return signed
+	}
+
+	info, err := ParseClaims(sign(nil, time.Hour), keySet, issuer, audience)
+	if err != nil {
+		t.Fatalf("ParseClaims of valid token: %v", err)
+	}
+
+	if info.UserID != "user" || !info.HasRole("client") || info.JTI == "" || info.ExpiresAt.Before(time.Now()) {
+		t.Fatalf("ParseClaims returned %+v", info)
+	}
+
+	for _, c := range []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"expired", sign(nil, -time.Minute), ErrTokenExpired},
+		{"wrong issuer", sign(map[string]interface{}{"iss": "other"}, time.Hour), ErrInvalidIssuer},
+		{"missing issuer", sign(map[string]interface{}{"iss": nil}, time.Hour), ErrInvalidIssuer},
+		{"wrong audience", sign(map[string]interface{}{"aud": "other"}, time.Hour), ErrInvalidAudience},
+		{"missing roles", sign(map[string]interface{}{"roles": nil}, time.Hour), nil},
+		{"missing user", sign(map[string]interface{}{"user_id": nil}, time.Hour), nil},
+		{"other algorithm", signWith(jwt.SigningMethodHS384, []byte("0123456789abcdef0123")), nil},
+		{"alg none", signWith(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType), nil},
+		{"other secret", signWith(jwt.SigningMethodHS256, []byte("another secret of 20")), nil},
+		{"garbage", "not.a.token", nil},
+	} {
+		_, err := ParseClaims(c.token, keySet, issuer, audience)
+		if err == nil {
+			t.Errorf("%s: ParseClaims succeeded, want error", c.name)
+			continue
+		}
+
+		if c.wantErr != nil && !errors.Is(err, c.wantErr) {
+			t.Errorf("%s: ParseClaims returned %v, want %v", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestExtractToken(t *testing.T) {
+
+	for _, c := range []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{"Bearer abc", "abc", true},
+		{"bearer abc", "abc", true},
+		{"Bearer", "", false},
+		{"Bearer ", "", false},
+		{"Basic abc", "", false},
+		{"abc", "", false},
+		{"Bearer a b", "", false},
+	} {
+		token, err := ExtractToken(c.header)
+		if (err == nil) != c.ok || token != c.want {
+			t.Errorf("ExtractToken(%q) = %q, %v, want %q, ok %v", c.header, token, err, c.want, c.ok)
+		}
+	}
+}
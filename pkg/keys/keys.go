@@ -0,0 +1,228 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const hmacKeyID = "hs256"
+
+var (
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidAlgorithm = errors.New("unexpected signing method")
+)
+
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+}
+
+// Set holds key that signs new tokens and every key that may verify them.
+// Keeping previous keys in the set lets tokens signed before rotation stay valid
+type Set struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewHMAC returns set with single HS256 key, such set publishes no keys in JWKS
+func NewHMAC(secret string) *Set {
+	key := &Key{
+		ID:      hmacKeyID,
+		Method:  jwt.SigningMethodHS256,
+		Private: []byte(secret),
+		Public:  []byte(secret),
+	}
+
+	return &Set{
+		signing: key,
+		keys:    map[string]*Key{key.ID: key},
+	}
+}
+
+// Load reads every *.pem file of dir, kid of key is file name without extension.
+// Private key files (RSA or Ed25519) may sign and verify, public key files only verify.
+// signingKeyID selects the private key that signs new tokens
+func Load(dir, signingKeyID string) (*Set, error) {
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	set := &Set{keys: map[string]*Key{}}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		key.ID = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		set.keys[key.ID] = key
+	}
+
+	signing, ok := set.keys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found in %s", signingKeyID, dir)
+	}
+
+	if signing.Private == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKeyID)
+	}
+
+	set.signing = signing
+
+	return set, nil
+}
+
+// Sign signs claims with the signing key and puts its id into kid header
+func (s *Set) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.signing.Method, claims)
+	token.Header["kid"] = s.signing.ID
+
+	return token.SignedString(s.signing.Private)
+}
+
+// Keyfunc resolves verification key by kid header and rejects algorithms other than the key's one
+func (s *Set) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrInvalidAlgorithm
+	}
+
+	return key.Public, nil
+}
+
+// Algorithms returns algorithms of keys in set
+func (s *Set) Algorithms() []string {
+	var (
+		seen = map[string]bool{}
+		algs []string
+	)
+
+	for _, key := range s.keys {
+		if !seen[key.Method.Alg()] {
+			seen[key.Method.Alg()] = true
+			algs = append(algs, key.Method.Alg())
+		}
+	}
+
+	return algs
+}
+
+// JWKS returns public keys of set, symmetric keys are never published
+func (s *Set) JWKS() JWKS {
+	var jwks = JWKS{Keys: []JWK{}}
+
+	for _, key := range s.keys {
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+
+	return jwks
+}
+
+func parseKey(data []byte) (*Key, error) {
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var (
+		parsed interface{}
+		err    error
+	)
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{Method: jwt.SigningMethodRS256, Private: key, Public: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{Method: jwt.SigningMethodRS256, Public: key}, nil
+	case ed25519.PrivateKey:
+		return &Key{Method: SigningMethodEdDSA, Private: key, Public: key.Public().(ed25519.PublicKey)}, nil
+	case ed25519.PublicKey:
+		return &Key{Method: SigningMethodEdDSA, Public: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
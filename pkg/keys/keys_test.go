@@ -0,0 +1,232 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// writeKeys writes RSA private key "rsa", Ed25519 private key "ed" and public key of another Ed25519 key
+// "old" into temporary dir
+func writeKeys(t *testing.T) (dir string, rsaKey *rsa.PrivateKey, edKey ed25519.PrivateKey, oldKey ed25519.PrivateKey) {
+
+	dir = t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	_, edKey, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	_, oldKey, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+
+	oldDER, err := x509.MarshalPKIXPublicKey(oldKey.Public())
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+
+	writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	writePEM(t, dir, "ed.pem", "PRIVATE KEY", edDER)
+	writePEM(t, dir, "old.pem", "PUBLIC KEY", oldDER)
+
+	return dir, rsaKey, edKey, oldKey
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+
+	dir, _, _, _ := writeKeys(t)
+
+	for _, c := range []struct {
+		signingKeyID string
+		ok           bool
+	}{
+		{"rsa", true},
+		{"ed", true},
+		{"old", false},
+		{"missing", false},
+	} {
+		_, err := Load(dir, c.signingKeyID)
+		if (err == nil) != c.ok {
+			t.Errorf("Load(%q) error = %v, want ok %v", c.signingKeyID, err, c.ok)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a key"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if _, err := Load(dir, "rsa"); err == nil {
+		t.Errorf("Load of dir with broken key file succeeded")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+
+	dir, _, _, oldKey := writeKeys(t)
+
+	for _, signingKeyID := range []string{"rsa", "ed"} {
+		set, err := Load(dir, signingKeyID)
+		if err != nil {
+			t.Fatalf("Load(%q): %v", signingKeyID, err)
+		}
+
+		signed, err := set.Sign(jwt.MapClaims{"user_id": "1"})
+		if err != nil {
+			t.Fatalf("Sign with %q: %v", signingKeyID, err)
+		}
+
+		token, err := jwt.Parse(signed, set.Keyfunc)
+		if err != nil || !token.Valid || token.Header["kid"] != signingKeyID {
+			t.Errorf("token signed with %q does not verify: %v", signingKeyID, err)
+		}
+	}
+
+	set, err := Load(dir, "rsa")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// token signed before rotation with key whose public part is still in the set
+	old := jwt.NewWithClaims(SigningMethodEdDSA, jwt.MapClaims{"user_id": "1"})
+	old.Header["kid"] = "old"
+
+	signed, err := old.SignedString(oldKey)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	if _, err = jwt.Parse(signed, set.Keyfunc); err != nil {
+		t.Errorf("token of rotated key does not verify: %v", err)
+	}
+
+	// public key of set used as HMAC secret must not verify
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": "1"})
+	forged.Header["kid"] = "old"
+
+	signed, err = forged.SignedString([]byte(oldKey.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	_, err = jwt.Parse(signed, set.Keyfunc)
+	if !errors.Is(err.(*jwt.ValidationError).Inner, ErrInvalidAlgorithm) {
+		t.Errorf("token with wrong algorithm = %v, want %v", err, ErrInvalidAlgorithm)
+	}
+
+	unknown := jwt.NewWithClaims(SigningMethodEdDSA, jwt.MapClaims{"user_id": "1"})
+	unknown.Header["kid"] = "unknown"
+
+	signed, err = unknown.SignedString(oldKey)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	_, err = jwt.Parse(signed, set.Keyfunc)
+	if !errors.Is(err.(*jwt.ValidationError).Inner, ErrUnknownKey) {
+		t.Errorf("token with unknown kid = %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestEdDSA(t *testing.T) {
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	sig, err := SigningMethodEdDSA.Sign("header.payload", private)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	for _, c := range []struct {
+		name          string
+		signingString string
+		sig           string
+		key           interface{}
+		want          error
+	}{
+		{"valid", "header.payload", sig, public, nil},
+		{"changed payload", "header.other", sig, public, jwt.ErrSignatureInvalid},
+		{"private key", "header.payload", sig, private, jwt.ErrInvalidKeyType},
+		{"hmac secret", "header.payload", sig, []byte("secret"), jwt.ErrInvalidKeyType},
+	} {
+		err := SigningMethodEdDSA.Verify(c.signingString, c.sig, c.key)
+		if err != c.want {
+			t.Errorf("%s: Verify = %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	if _, err = SigningMethodEdDSA.Sign("header.payload", public); err != jwt.ErrInvalidKeyType {
+		t.Errorf("Sign with public key = %v, want %v", err, jwt.ErrInvalidKeyType)
+	}
+
+	if err = SigningMethodEdDSA.Verify("header.payload", "!!!", public); err == nil {
+		t.Errorf("Verify of malformed signature succeeded")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+
+	if jwks := NewHMAC("secret").JWKS(); len(jwks.Keys) != 0 {
+		t.Errorf("HMAC set publishes %d keys", len(jwks.Keys))
+	}
+
+	dir, rsaKey, edKey, _ := writeKeys(t)
+
+	set, err := Load(dir, "rsa")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	jwks := set.JWKS()
+
+	var kids []string
+	for _, key := range jwks.Keys {
+		kids = append(kids, key.Kid)
+	}
+
+	if len(kids) != 3 || kids[0] != "ed" || kids[1] != "old" || kids[2] != "rsa" {
+		t.Fatalf("JWKS kids = %q, want sorted ed, old, rsa", kids)
+	}
+
+	ed := jwks.Keys[0]
+	if ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || ed.Use != "sig" ||
+		ed.X != base64.RawURLEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey)) {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+
+	rsaJWK := jwks.Keys[2]
+	if rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || rsaJWK.E != "AQAB" ||
+		rsaJWK.N != base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()) {
+		t.Errorf("RSA JWK = %+v", rsaJWK)
+	}
+}
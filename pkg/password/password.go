@@ -0,0 +1,200 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+
+	argon2Memory  = 64 * 1024
+	argon2Threads = 2
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+
+	// MinLength is the shortest password Validate accepts
+	MinLength = 8
+
+	// Unusable is stored for users without password, Verify never matches it
+	Unusable = "!"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrTooShort         = fmt.Errorf("password must be at least %d characters", MinLength)
+)
+
+// Hasher hashes passwords with bcrypt or argon2id.
+// Cost is bcrypt cost for bcrypt and number of iterations for argon2id.
+// acceptPlaintext lets Verify match stored values that are not hashes, only while legacy plaintext
+// rows are migrated; drop it once none remain
+type Hasher struct {
+	algorithm       string
+	cost            int
+	acceptPlaintext bool
+
+	// dummy is hash Burn verifies against
+	dummy string
+}
+
+// Validate checks password before it is hashed
+func Validate(password string) error {
+	if len([]rune(password)) < MinLength {
+		return ErrTooShort
+	}
+	return nil
+}
+
+func NewHasher(algorithm string, cost int, acceptPlaintext bool) (*Hasher, error) {
+	switch algorithm {
+	case Bcrypt:
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case Argon2id:
+		if cost < 1 {
+			return nil, errors.New("argon2id cost must be positive")
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algorithm)
+	}
+
+	h := &Hasher{
+		algorithm:       algorithm,
+		cost:            cost,
+		acceptPlaintext: acceptPlaintext,
+	}
+
+	dummy, err := h.Hash("dummy password")
+	if err != nil {
+		return nil, err
+	}
+
+	h.dummy = dummy
+
+	return h, nil
+}
+
+// Hash returns encoded hash of password with algorithm parameters and salt
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, uint32(h.cost), argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2Memory, h.cost, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify compares password with stored value in constant time, empty or Unusable stored value and empty
+// password never match.
+// Stored values that are not bcrypt or argon2id hashes are legacy plaintext and match only if Hasher
+// accepts plaintext. rehash reports that stored value should be replaced with fresh Hash of password
+func (h *Hasher) Verify(stored, password string) (ok bool, rehash bool, err error) {
+	switch {
+	case stored == "" || stored == Unusable || password == "":
+		return false, false, nil
+
+	case isBcrypt(stored):
+		err = bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+
+		cost, err := bcrypt.Cost([]byte(stored))
+		if err != nil {
+			return false, false, err
+		}
+
+		return true, h.algorithm != Bcrypt || cost != h.cost, nil
+
+	case strings.HasPrefix(stored, "$argon2id$"):
+		var (
+			version            int
+			memory, iterations uint32
+			threads            uint8
+		)
+
+		parts := strings.Split(stored, "$")
+		if len(parts) != 6 {
+			return false, false, errors.New("invalid argon2id hash")
+		}
+
+		if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+			return false, false, err
+		}
+
+		if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+			return false, false, err
+		}
+
+		salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+		if err != nil {
+			return false, false, err
+		}
+
+		key, err := base64.RawStdEncoding.DecodeString(parts[5])
+		if err != nil {
+			return false, false, err
+		}
+
+		actual := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return false, false, nil
+		}
+
+		rehash = h.algorithm != Argon2id ||
+			version != argon2.Version ||
+			iterations != uint32(h.cost) ||
+			memory != argon2Memory ||
+			threads != argon2Threads
+
+		return true, rehash, nil
+
+	case !h.acceptPlaintext:
+		return false, false, nil
+
+	default:
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(password)) != 1 {
+			return false, false, nil
+		}
+		return true, true, nil
+	}
+}
+
+// Burn verifies password against hash of algorithm and cost of Hasher and throws the result away.
+// Login of user that does not exist calls it, so it takes as long as wrong password of one that does
+func (h *Hasher) Burn(password string) {
+	_, _, _ = h.Verify(h.dummy, password)
+}
+
+func isBcrypt(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
@@ -0,0 +1,116 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNewHasher(t *testing.T) {
+
+	for _, c := range []struct {
+		algorithm string
+		cost      int
+		ok        bool
+	}{
+		{Bcrypt, bcrypt.MinCost, true},
+		{Bcrypt, bcrypt.MinCost - 1, false},
+		{Bcrypt, bcrypt.MaxCost + 1, false},
+		{Argon2id, 1, true},
+		{Argon2id, 0, false},
+		{"md5", 1, false},
+	} {
+		_, err := NewHasher(c.algorithm, c.cost, false)
+		if (err == nil) != c.ok {
+			t.Errorf("NewHasher(%q, %d) error = %v, want ok %v", c.algorithm, c.cost, err, c.ok)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	for _, c := range []struct {
+		password string
+		ok       bool
+	}{
+		{"", false},
+		{"1234567", false},
+		{"12345678", true},
+		{"пароль12", true},
+		{"пароль1", false},
+	} {
+		err := Validate(c.password)
+		if (err == nil) != c.ok {
+			t.Errorf("Validate(%q) = %v, want ok %v", c.password, err, c.ok)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+
+	bcryptHasher, _ := NewHasher(Bcrypt, bcrypt.MinCost, false)
+	argonHasher, _ := NewHasher(Argon2id, 1, false)
+	plaintextHasher, _ := NewHasher(Bcrypt, bcrypt.MinCost, true)
+
+	bcryptHash, err := bcryptHasher.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	argonHash, err := argonHasher.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	if !strings.HasPrefix(argonHash, "$argon2id$") {
+		t.Fatalf("argon2id Hash = %q", argonHash)
+	}
+
+	for _, c := range []struct {
+		name           string
+		hasher         *Hasher
+		stored, input  string
+		wantOk, rehash bool
+	}{
+		{"bcrypt match", bcryptHasher, bcryptHash, "correct horse", true, false},
+		{"bcrypt mismatch", bcryptHasher, bcryptHash, "wrong horse", false, false},
+		{"bcrypt with argon2id hasher", argonHasher, bcryptHash, "correct horse", true, true},
+		{"argon2id match", argonHasher, argonHash, "correct horse", true, false},
+		{"argon2id mismatch", argonHasher, argonHash, "wrong horse", false, false},
+		{"argon2id with bcrypt hasher", bcryptHasher, argonHash, "correct horse", true, true},
+		{"empty stored", plaintextHasher, "", "", false, false},
+		{"unusable stored", plaintextHasher, Unusable, Unusable, false, false},
+		{"empty input", plaintextHasher, "secret", "", false, false},
+		{"plaintext refused", bcryptHasher, "secret", "secret", false, false},
+		{"plaintext accepted", plaintextHasher, "secret", "secret", true, true},
+		{"plaintext mismatch", plaintextHasher, "secret", "other", false, false},
+	} {
+		ok, rehash, err := c.hasher.Verify(c.stored, c.input)
+		if err != nil || ok != c.wantOk || rehash != c.rehash {
+			t.Errorf("%s: Verify = %v, %v, %v, want %v, %v", c.name, ok, rehash, err, c.wantOk, c.rehash)
+		}
+	}
+
+	if _, _, err := argonHasher.Verify("$argon2id$broken", "correct horse"); err == nil {
+		t.Errorf("Verify of malformed argon2id hash succeeded")
+	}
+}
+
+func TestBurn(t *testing.T) {
+
+	for _, algorithm := range []string{Bcrypt, Argon2id} {
+		h, err := NewHasher(algorithm, 4, false)
+		if err != nil {
+			t.Fatalf("NewHasher(%q): %v", algorithm, err)
+		}
+
+		h.Burn("password")
+
+		// dummy must be real hash of Hasher, otherwise Verify returns before doing the work
+		ok, rehash, err := h.Verify(h.dummy, "dummy password")
+		if !ok || rehash || err != nil {
+			t.Errorf("%s: Verify of dummy = %v, %v, %v, want match of current parameters", algorithm, ok, rehash, err)
+		}
+	}
+}
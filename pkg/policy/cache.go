@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PermissionCache remembers for ttl whether role was granted permission, so checking access does not
+// query storage on every request. Grants changed meanwhile take effect once ttl passes or Reset is called
+type PermissionCache struct {
+	lookup func(ctx context.Context, role, permission string) (bool, error)
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[grant]cachedGrant
+}
+
+type grant struct {
+	role       string
+	permission string
+}
+
+type cachedGrant struct {
+	granted   bool
+	expiresAt time.Time
+}
+
+func NewPermissionCache(lookup func(ctx context.Context, role, permission string) (bool, error), ttl time.Duration) *PermissionCache {
+	return &PermissionCache{
+		lookup:  lookup,
+		ttl:     ttl,
+		entries: map[grant]cachedGrant{},
+	}
+}
+
+// Has reports whether any of roles was granted permission
+func (c *PermissionCache) Has(ctx context.Context, roles []string, permission string) (bool, error) {
+
+	for _, role := range roles {
+		granted, err := c.has(ctx, role, permission)
+		if err != nil || granted {
+			return granted, err
+		}
+	}
+
+	return false, nil
+}
+
+func (c *PermissionCache) has(ctx context.Context, role, permission string) (bool, error) {
+
+	key := grant{role: role, permission: permission}
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok && now.Before(entry.expiresAt) {
+		return entry.granted, nil
+	}
+
+	granted, err := c.lookup(ctx, role, permission)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	// expired entries are dropped here, so the map never holds more than pairs looked up within ttl
+	for k, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cachedGrant{granted: granted, expiresAt: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	return granted, nil
+}
+
+// Reset forgets every cached grant, role handlers call it after they change permissions of roles
+func (c *PermissionCache) Reset() {
+	c.mu.Lock()
+	c.entries = map[grant]cachedGrant{}
+	c.mu.Unlock()
+}
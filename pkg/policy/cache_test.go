@@ -0,0 +1,69 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPermissionCache(t *testing.T) {
+
+	var (
+		lookups int
+		granted = map[string]bool{"EDITOR": true}
+	)
+
+	cache := NewPermissionCache(func(ctx context.Context, role, permission string) (bool, error) {
+		lookups++
+		if role == "BROKEN" {
+			return false, errors.New("storage down")
+		}
+		return granted[role], nil
+	}, time.Hour)
+
+	for _, c := range []struct {
+		roles   []string
+		want    bool
+		lookups int
+	}{
+		{[]string{"EDITOR"}, true, 1},
+		{[]string{"EDITOR"}, true, 1},
+		{[]string{"CLIENT"}, false, 2},
+		{[]string{"CLIENT", "EDITOR"}, true, 2},
+		{nil, false, 2},
+	} {
+		got, err := cache.Has(context.Background(), c.roles, "book:write")
+		if err != nil || got != c.want || lookups != c.lookups {
+			t.Errorf("Has(%q) = %v, %v after %d lookups, want %v after %d", c.roles, got, err, lookups, c.want, c.lookups)
+		}
+	}
+
+	if _, err := cache.Has(context.Background(), []string{"BROKEN"}, "book:write"); err == nil {
+		t.Errorf("Has succeeded although lookup failed")
+	}
+
+	granted["CLIENT"] = true
+	cache.Reset()
+
+	if got, _ := cache.Has(context.Background(), []string{"CLIENT"}, "book:write"); !got {
+		t.Errorf("Has after Reset still returns cached denial")
+	}
+}
+
+func TestPermissionCacheExpires(t *testing.T) {
+
+	var lookups int
+
+	cache := NewPermissionCache(func(ctx context.Context, role, permission string) (bool, error) {
+		lookups++
+		return true, nil
+	}, 0)
+
+	cache.Has(context.Background(), []string{"EDITOR"}, "book:write")
+	cache.Has(context.Background(), []string{"EDITOR"}, "book:write")
+
+	if lookups != 2 {
+		t.Errorf("expired grant was looked up %d times, want 2", lookups)
+	}
+}
@@ -0,0 +1,176 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	Public        = "PUBLIC"
+	Authenticated = "AUTHENTICATED"
+	Client        = "CLIENT"
+	Super         = "SUPER"
+
+	anyMethod = "*"
+)
+
+type Decision int
+
+const (
+	Allow Decision = iota
+	Unauthenticated
+	Forbidden
+)
+
+type Rule struct {
+	Method      string
+	Path        string
+	Roles       []string
+	Permissions []string
+}
+
+type Policy struct {
+	rules map[string]map[string]Rule
+}
+
+// Load reads policy table from file
+func Load(path string) (*Policy, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	p, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return p, nil
+}
+
+// Parse reads lines in form "METHOD PATH ROLE[,ROLE...]", empty lines and # comments are skipped.
+// Entries containing ":" like order:read are permissions instead of roles
+func Parse(r io.Reader) (*Policy, error) {
+	var (
+		p       = &Policy{rules: map[string]map[string]Rule{}}
+		scanner = bufio.NewScanner(r)
+		line    int
+	)
+
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected METHOD PATH ROLES, got %q", line, strings.TrimSpace(text))
+		}
+
+		rule := Rule{
+			Method: strings.ToUpper(fields[0]),
+			Path:   fields[1],
+		}
+
+		if !strings.HasPrefix(rule.Path, "/") {
+			return nil, fmt.Errorf("line %d: path %q must start with /", line, rule.Path)
+		}
+
+		for _, role := range strings.Split(fields[2], ",") {
+			role = strings.TrimSpace(role)
+			if role == "" {
+				return nil, fmt.Errorf("line %d: empty role", line)
+			}
+
+			if strings.Contains(role, ":") {
+				rule.Permissions = append(rule.Permissions, strings.ToLower(role))
+				continue
+			}
+
+			rule.Roles = append(rule.Roles, strings.ToUpper(role))
+		}
+
+		if _, ok := p.rules[rule.Path][rule.Method]; ok {
+			return nil, fmt.Errorf("line %d: duplicate rule for %s %s", line, rule.Method, rule.Path)
+		}
+
+		if p.rules[rule.Path] == nil {
+			p.rules[rule.Path] = map[string]Rule{}
+		}
+		p.rules[rule.Path][rule.Method] = rule
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Lookup returns rule for route, rule with exact method wins over *
+func (p *Policy) Lookup(method, path string) (Rule, bool) {
+	methods, ok := p.rules[path]
+	if !ok {
+		return Rule{}, false
+	}
+
+	if rule, ok := methods[strings.ToUpper(method)]; ok {
+		return rule, true
+	}
+
+	rule, ok := methods[anyMethod]
+	return rule, ok
+}
+
+// Check decides whether caller with roles may call route, no roles means anonymous caller.
+// hasPermission reports whether any of the roles was granted permission, it may be nil when rules
+// have no permissions
+func (p *Policy) Check(method, path string, roles []string, hasPermission func(permission string) bool) Decision {
+	rule, ok := p.Lookup(method, path)
+	if !ok {
+		return Forbidden
+	}
+
+	for _, r := range rule.Roles {
+		if r == Public {
+			return Allow
+		}
+	}
+
+	if len(roles) == 0 {
+		return Unauthenticated
+	}
+
+	for _, r := range rule.Roles {
+		if r == Authenticated {
+			return Allow
+		}
+
+		for _, role := range roles {
+			if r == strings.ToUpper(role) {
+				return Allow
+			}
+		}
+	}
+
+	if hasPermission != nil {
+		for _, permission := range rule.Permissions {
+			if hasPermission(permission) {
+				return Allow
+			}
+		}
+	}
+
+	return Forbidden
+}
@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+
+	for _, c := range []struct {
+		name, text string
+	}{
+		{"missing roles", "GET /book"},
+		{"extra field", "GET /book PUBLIC SUPER"},
+		{"relative path", "GET book PUBLIC"},
+		{"empty role", "GET /book PUBLIC,"},
+		{"duplicate", "GET /book PUBLIC\nget /book SUPER"},
+	} {
+		_, err := Parse(strings.NewReader(c.text))
+		if err == nil {
+			t.Errorf("%s: Parse(%q) succeeded, want error", c.name, c.text)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+
+	p, err := Parse(strings.NewReader(`
+		# comment
+		get  /book      PUBLIC   # trailing comment
+		POST /order     client,Order:Write
+		*    /any       AUTHENTICATED
+	`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	rule, ok := p.Lookup("GET", "/book")
+	if !ok || rule.Method != "GET" || len(rule.Roles) != 1 || rule.Roles[0] != Public {
+		t.Fatalf("Lookup GET /book returned %+v, %v", rule, ok)
+	}
+
+	rule, ok = p.Lookup("post", "/order")
+	if !ok || len(rule.Roles) != 1 || rule.Roles[0] != Client ||
+		len(rule.Permissions) != 1 || rule.Permissions[0] != "order:write" {
+		t.Fatalf("Lookup POST /order returned %+v, %v", rule, ok)
+	}
+
+	if _, ok = p.Lookup("DELETE", "/any"); !ok {
+		t.Fatalf("Lookup of * rule failed")
+	}
+
+	if _, ok = p.Lookup("GET", "/missing"); ok {
+		t.Fatalf("Lookup of missing route succeeded")
+	}
+}
+
+func TestCheck(t *testing.T) {
+
+	p, err := Parse(strings.NewReader(`
+		GET    /book        PUBLIC
+		POST   /book        SUPER,book:write
+		GET    /user/:id    AUTHENTICATED
+		*      /order       CLIENT
+		GET    /order       SUPER
+	`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	granted := map[string]map[string]bool{
+		"EDITOR": {"book:write": true},
+	}
+
+	hasPermission := func(roles []string) func(string) bool {
+		return func(permission string) bool {
+			for _, role := range roles {
+				if granted[role][permission] {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	for _, c := range []struct {
+		method, path string
+		roles        []string
+		want         Decision
+	}{
+		{"GET", "/book", nil, Allow},
+		{"GET", "/book", []string{"CLIENT"}, Allow},
+		{"POST", "/book", nil, Unauthenticated},
+		{"POST", "/book", []string{"CLIENT"}, Forbidden},
+		{"POST", "/book", []string{"SUPER"}, Allow},
+		{"POST", "/book", []string{"super"}, Allow},
+		{"POST", "/book", []string{"EDITOR"}, Allow},
+		{"POST", "/book", []string{"CLIENT", "EDITOR"}, Allow},
+		{"POST", "/book", []string{"CLIENT", "SUPER"}, Allow},
+		{"GET", "/user/:id", nil, Unauthenticated},
+		{"GET", "/user/:id", []string{"CLIENT"}, Allow},
+		{"DELETE", "/order", []string{"CLIENT"}, Allow},
+		{"GET", "/order", []string{"CLIENT"}, Forbidden},
+		{"GET", "/order", []string{"SUPER"}, Allow},
+		{"GET", "/missing", []string{"SUPER"}, Forbidden},
+		{"GET", "/missing", nil, Forbidden},
+	} {
+		got := p.Check(c.method, c.path, c.roles, hasPermission(c.roles))
+		if got != c.want {
+			t.Errorf("Check(%s %s as %q) = %d, want %d", c.method, c.path, c.roles, got, c.want)
+		}
+	}
+
+	if got := p.Check("POST", "/book", []string{"EDITOR"}, nil); got != Forbidden {
+		t.Errorf("Check without hasPermission = %d, want %d", got, Forbidden)
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+
+	p, err := Load("../../policy.txt")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// writes that change catalogue or accounts must never be open to anonymous callers
+	for _, route := range [][2]string{
+		{"POST", "/book"}, {"PUT", "/book/:id"}, {"PATCH", "/book/:id"}, {"DELETE", "/book/:id"},
+		{"GET", "/user/:id"}, {"PUT", "/user/:id"}, {"PATCH", "/user/:id"}, {"DELETE", "/user/:id"},
+	} {
+		if got := p.Check(route[0], route[1], nil, nil); got == Allow {
+			t.Errorf("%s %s is open to anonymous callers", route[0], route[1])
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package purge
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"crud/storage"
+)
+
+// Purger removes deleted rows once they were deleted longer than retention ago.
+// Orders go first so books and users they held on to can go in the same pass
+type Purger struct {
+	storage   storage.StorageI
+	retention time.Duration
+}
+
+func NewPurger(storage storage.StorageI, retention time.Duration) *Purger {
+	return &Purger{
+		storage:   storage,
+		retention: retention,
+	}
+}
+
+// Purge removes rows deleted before retention and reports how many went
+func (p *Purger) Purge(ctx context.Context) (int64, error) {
+
+	var (
+		deletedBefore = time.Now().Add(-p.retention)
+		total         int64
+	)
+
+	repos := []interface {
+		PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
+	}{
+		p.storage.Order(),
+		p.storage.Book(),
+		p.storage.User(),
+	}
+
+	for _, repo := range repos {
+		n, err := repo.PurgeDeleted(ctx, deletedBefore)
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+	}
+
+	return total, nil
+}
+
+// Run purges every interval until ctx is done
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := p.Purge(ctx)
+		if err != nil {
+			log.Printf("error whiling PurgeDeleted: %v\n", err)
+		}
+
+		if n > 0 {
+			log.Printf("purged %d deleted rows\n", n)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package reservation
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"crud/storage"
+)
+
+// Expirer cancels pending orders that were not paid before their reservation ended, so the stock
+// they held can be ordered again
+type Expirer struct {
+	storage storage.StorageI
+}
+
+func NewExpirer(storage storage.StorageI) *Expirer {
+	return &Expirer{
+		storage: storage,
+	}
+}
+
+// Expire cancels orders whose reservation ended by now and reports how many
+func (e *Expirer) Expire(ctx context.Context) (int64, error) {
+	return e.storage.Order().ExpireReservations(ctx, time.Now())
+}
+
+// Run expires reservations every interval until ctx is done
+func (e *Expirer) Run(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := e.Expire(ctx)
+		if err != nil {
+			log.Printf("error whiling ExpireReservations: %v\n", err)
+		}
+
+		if n > 0 {
+			log.Printf("cancelled %d orders with expired reservations\n", n)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package revocation
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"crud/models"
+	"crud/pkg/helper"
+	"crud/storage"
+)
+
+// Store keeps revoked tokens in memory in front of the database.
+// Revocations made by other replicas become visible after the next Load
+type Store struct {
+	repo storage.RevocationRepoI
+
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[string]time.Time
+}
+
+func NewStore(repo storage.RevocationRepoI) *Store {
+	return &Store{
+		repo:   repo,
+		tokens: map[string]time.Time{},
+		users:  map[string]time.Time{},
+	}
+}
+
+// Load replaces cache with revocations from the database
+func (s *Store) Load(ctx context.Context) error {
+
+	resp, err := s.repo.GetActive(ctx)
+	if err != nil {
+		return err
+	}
+
+	tokens := make(map[string]time.Time, len(resp.Tokens))
+	for _, token := range resp.Tokens {
+		tokens[token.Jti] = token.ExpiresAt
+	}
+
+	users := make(map[string]time.Time, len(resp.Users))
+	for _, user := range resp.Users {
+		users[user.UserId] = user.RevokedBefore
+	}
+
+	s.mu.Lock()
+	s.tokens = tokens
+	s.users = users
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Run reloads cache and deletes expired revocations every interval until ctx is done
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, err := s.repo.DeleteExpired(ctx)
+		if err != nil {
+			log.Printf("error whiling DeleteExpired: %v\n", err)
+		}
+
+		err = s.Load(ctx)
+		if err != nil {
+			log.Printf("error whiling Load revocations: %v\n", err)
+		}
+	}
+}
+
+// Revoke kills single token until it expires
+func (s *Store) Revoke(ctx context.Context, info helper.TokenInfo) error {
+
+	err := s.repo.Revoke(ctx, &models.RevokeToken{
+		Jti:       info.JTI,
+		UserId:    info.UserID,
+		ExpiresAt: info.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.tokens[info.JTI] = info.ExpiresAt
+	s.mu.Unlock()
+
+	return nil
+}
+
+// RevokeUser kills every token of user issued until now
+func (s *Store) RevokeUser(ctx context.Context, userId string) error {
+
+	now := time.Now().UTC()
+
+	err := s.repo.RevokeUser(ctx, &models.RevokeUserTokens{
+		UserId:        userId,
+		RevokedBefore: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.UserRevoked(userId, now)
+
+	return nil
+}
+
+// UserRevoked caches revocation of user that caller wrote through its own repo, inside transaction for example.
+// Call it once the write committed
+func (s *Store) UserRevoked(userId string, revokedBefore time.Time) {
+	s.mu.Lock()
+	s.users[userId] = revokedBefore
+	s.mu.Unlock()
+}
+
+func (s *Store) IsRevoked(info helper.TokenInfo) bool {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tokens[info.JTI]; ok {
+		return true
+	}
+
+	// iat has second precision, tokens issued in the same second as logout are revoked too
+	if before, ok := s.users[info.UserID]; ok && !info.IssuedAt.After(before) {
+		return true
+	}
+
+	return false
+}
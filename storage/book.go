@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+
+	"crud/models"
+)
+
+// CheckPrice checks price of book, its currency must be ISO 4217 code and its amount must be
+// from zero up to what book.price INTEGER column holds. Anything else is ErrInvalidInput
+func CheckPrice(price models.Money) error {
+
+	if !models.ValidCurrency(price.Currency) {
+		return fmt.Errorf("%w: invalid currency %q", ErrInvalidInput, price.Currency)
+	}
+
+	if price.Amount < 0 || price.Amount > math.MaxInt32 {
+		return fmt.Errorf("%w: price must be from 0 to %d minor units, got %d", ErrInvalidInput, math.MaxInt32, price.Amount)
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package storage
+
+import "errors"
+
+// Repos wrap these so callers can tell failures apart with errors.Is
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrForeignKey   = errors.New("foreign key violation")
+	ErrInvalidInput = errors.New("invalid input")
+
+	// ErrVersionMismatch means row exists but was changed since client read the version it expects
+	ErrVersionMismatch = errors.New("version mismatch")
+)
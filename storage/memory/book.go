@@ -0,0 +1,376 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"crud/models"
+	"crud/storage"
+)
+
+type bookRepo struct {
+	db *db
+}
+
+func (f *bookRepo) Create(ctx context.Context, book *models.CreateBook) (string, error) {
+
+	err := storage.CheckPrice(book.Price)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkStock(book.Stock, book.LowStockThreshold)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		id      = uuid.New().String()
+		created = timestamp(now())
+	)
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	f.db.books = append(f.db.books, &models.Book{
+		Id:                id,
+		Name:              book.Name,
+		AuthorName:        book.AuthorName,
+		Price:             book.Price,
+		Date:              book.Date,
+		Stock:             book.Stock,
+		LowStockThreshold: book.LowStockThreshold,
+		CreatedAt:         created,
+		UpdatedAt:         created,
+		Version:           1,
+	})
+
+	return id, nil
+}
+
+func (f *bookRepo) GetByPKey(ctx context.Context, pkey *models.BookPrimarKey) (*models.Book, error) {
+
+	err := checkUUID(pkey.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	book := f.db.findBook(pkey.Id)
+	if book == nil || book.DeletedAt != "" && !pkey.IncludeDeleted {
+		return nil, storage.ErrNotFound
+	}
+
+	resp := *book
+
+	return &resp, nil
+}
+
+func (f *bookRepo) GetList(ctx context.Context, req *models.GetListBookRequest) (*models.GetListBookResponse, error) {
+
+	var (
+		resp  = models.GetListBookResponse{}
+		books []*models.Book
+		total int32
+	)
+
+	err := checkCursor(req.After, req.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	for _, book := range f.db.books {
+		price := book.Price.Amount
+
+		switch {
+		case book.DeletedAt != "" && !req.IncludeDeleted,
+			!matchesSearch(req.Search, book.Name, book.AuthorName),
+			req.AuthorName != "" && !strings.EqualFold(book.AuthorName, req.AuthorName),
+			req.Currency != "" && book.Price.Currency != req.Currency,
+			req.PriceMin != nil && price < int64(*req.PriceMin),
+			req.PriceMax != nil && price > int64(*req.PriceMax),
+			req.LowStock && book.Stock > book.LowStockThreshold,
+			!createdBetween(book.CreatedAt, req.CreatedFrom, req.CreatedTo):
+			continue
+		}
+
+		total++
+
+		if !afterCursor(book.CreatedAt, book.Id, req.After) {
+			continue
+		}
+
+		book := *book
+		books = append(books, &book)
+	}
+
+	err = sortRows(books, req.Sort, map[string]compareFunc{
+		"name":        func(i, j int) int { return strings.Compare(books[i].Name, books[j].Name) },
+		"author_name": func(i, j int) int { return strings.Compare(books[i].AuthorName, books[j].AuthorName) },
+		"price":       func(i, j int) int { return compareInts(books[i].Price.Amount, books[j].Price.Amount) },
+		"date":        func(i, j int) int { return strings.Compare(books[i].Date, books[j].Date) },
+		"stock":       func(i, j int) int { return int(books[i].Stock - books[j].Stock) },
+		"created_at":  func(i, j int) int { return compareTimestamps(books[i].CreatedAt, books[j].CreatedAt) },
+		"updated_at":  func(i, j int) int { return compareTimestamps(books[i].UpdatedAt, books[j].UpdatedAt) },
+	}, func(i, j int) int { return strings.Compare(books[i].Id, books[j].Id) })
+	if err != nil {
+		return nil, err
+	}
+
+	from, to, count := page(len(books), req.Offset, req.Limit, 10)
+
+	switch {
+	case req.After == nil:
+		resp.Count = &count
+	case req.WithCount:
+		resp.Count = &total
+	}
+
+	if from < to {
+		resp.Books = books[from:to]
+	}
+
+	if to < len(books) && models.KeysetSorted(req.Sort) {
+		resp.Next = &models.Cursor{CreatedAt: books[to-1].CreatedAt, Id: books[to-1].Id}
+	}
+
+	return &resp, nil
+}
+
+func (f *bookRepo) Update(ctx context.Context, req *models.UpdateBook) (int64, error) {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = storage.CheckPrice(req.Price)
+	if err != nil {
+		return 0, err
+	}
+
+	err = checkStock(req.Stock, req.LowStockThreshold)
+	if err != nil {
+		return 0, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	book := f.db.findLiveBook(req.Id)
+	if book == nil {
+		return 0, nil
+	}
+
+	if req.Version != 0 && book.Version != req.Version {
+		return 0, storage.ErrVersionMismatch
+	}
+
+	book.Name = req.Name
+	book.AuthorName = req.AuthorName
+	book.Price = req.Price
+	book.Date = req.Date
+	book.Stock = req.Stock
+	book.LowStockThreshold = req.LowStockThreshold
+	book.UpdatedAt = timestamp(now())
+	book.Version++
+
+	return 1, nil
+}
+
+func (f *bookRepo) Patch(ctx context.Context, req *models.PatchBook) (*models.Book, error) {
+
+	if req.Name == nil && req.AuthorName == nil && req.Price == nil && req.Date == nil &&
+		req.Stock == nil && req.LowStockThreshold == nil {
+		book, err := f.GetByPKey(ctx, &models.BookPrimarKey{Id: req.Id})
+		if err == nil && req.Version != 0 && book.Version != req.Version {
+			return nil, storage.ErrVersionMismatch
+		}
+
+		return book, err
+	}
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Price != nil {
+		err = storage.CheckPrice(*req.Price)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, value := range []*int32{req.Stock, req.LowStockThreshold} {
+		if value != nil {
+			err = checkStock(*value, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	book := f.db.findLiveBook(req.Id)
+	if book == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	if req.Version != 0 && book.Version != req.Version {
+		return nil, storage.ErrVersionMismatch
+	}
+
+	if req.Name != nil {
+		book.Name = *req.Name
+	}
+
+	if req.AuthorName != nil {
+		book.AuthorName = *req.AuthorName
+	}
+
+	if req.Price != nil {
+		book.Price = *req.Price
+	}
+
+	if req.Date != nil {
+		book.Date = *req.Date
+	}
+
+	if req.Stock != nil {
+		book.Stock = *req.Stock
+	}
+
+	if req.LowStockThreshold != nil {
+		book.LowStockThreshold = *req.LowStockThreshold
+	}
+
+	book.UpdatedAt = timestamp(now())
+	book.Version++
+
+	resp := *book
+
+	return &resp, nil
+}
+
+func (f *bookRepo) Delete(ctx context.Context, req *models.BookPrimarKey) error {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	book := f.db.findLiveBook(req.Id)
+	if book == nil {
+		return storage.ErrNotFound
+	}
+
+	if req.Version != 0 && book.Version != req.Version {
+		return storage.ErrVersionMismatch
+	}
+
+	book.DeletedAt = timestamp(now())
+	book.Version++
+
+	return nil
+}
+
+func (f *bookRepo) Restore(ctx context.Context, req *models.BookPrimarKey) (*models.Book, error) {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	book := f.db.findBook(req.Id)
+	if book == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	if book.DeletedAt != "" {
+		book.DeletedAt = ""
+		book.UpdatedAt = timestamp(now())
+		book.Version++
+	}
+
+	resp := *book
+
+	return &resp, nil
+}
+
+// PurgeDeleted removes books deleted before deletedBefore that no order references
+func (f *bookRepo) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	var (
+		kept   []*models.Book
+		purged int64
+	)
+
+	for _, book := range f.db.books {
+		if book.DeletedAt != "" && parseTimestamp(book.DeletedAt).Before(deletedBefore) && !f.db.bookReferenced(book.Id) {
+			purged++
+			continue
+		}
+
+		kept = append(kept, book)
+	}
+
+	f.db.books = kept
+
+	return purged, nil
+}
+
+func (d *db) findBook(id string) *models.Book {
+	for _, book := range d.books {
+		if book.Id == id {
+			return book
+		}
+	}
+	return nil
+}
+
+// findLiveBook is findBook skipping deleted book
+func (d *db) findLiveBook(id string) *models.Book {
+	if book := d.findBook(id); book != nil && book.DeletedAt == "" {
+		return book
+	}
+	return nil
+}
+
+func (d *db) bookReferenced(id string) bool {
+	for _, item := range d.orderItems {
+		if item.BookId == id {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrice mirrors price INTEGER column, it reads back without leading zeros or sign
+// checkStock enforces CHECK constraints of book.stock and book.low_stock_threshold
+func checkStock(stock, threshold int32) error {
+	if stock < 0 || threshold < 0 {
+		return fmt.Errorf("%w: stock and low stock threshold cannot be negative", storage.ErrInvalidInput)
+	}
+	return nil
+}
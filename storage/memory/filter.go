@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"crud/models"
+	"crud/storage"
+)
+
+// compareFunc compares rows i and j of slice being sorted like strings.Compare
+type compareFunc func(i, j int) int
+
+// sortRows sorts rows by whitelisted fields, id breaks ties like ORDER BY of postgres repos.
+// Without fields rows come oldest first
+func sortRows(rows interface{}, fields []models.SortField, columns map[string]compareFunc, id compareFunc) error {
+
+	if len(fields) == 0 {
+		fields = []models.SortField{{Field: "created_at"}}
+	}
+
+	var compares []compareFunc
+
+	for _, field := range fields {
+		compare, ok := columns[field.Field]
+		if !ok {
+			return fmt.Errorf("%w: cannot sort by %q", storage.ErrInvalidInput, field.Field)
+		}
+
+		if field.Desc {
+			asc := compare
+			compare = func(i, j int) int { return -asc(i, j) }
+		}
+
+		compares = append(compares, compare)
+	}
+
+	compares = append(compares, id)
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, compare := range compares {
+			if c := compare(i, j); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	return nil
+}
+
+// matchesSearch is ILIKE '%q%' over any of values
+func matchesSearch(q string, values ...string) bool {
+
+	if q == "" {
+		return true
+	}
+
+	q = strings.ToLower(q)
+
+	for _, value := range values {
+		if strings.Contains(strings.ToLower(value), q) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// createdBetween keeps rows created at from or later and before to, zero times are ignored
+func createdBetween(createdAt string, from, to time.Time) bool {
+
+	created := parseTimestamp(createdAt)
+
+	if !from.IsZero() && created.Before(from) {
+		return false
+	}
+
+	if !to.IsZero() && !created.Before(to) {
+		return false
+	}
+
+	return true
+}
+
+// afterCursor is (created_at, id) > cursor of postgres repos, nil cursor keeps all rows
+func afterCursor(createdAt, id string, cursor *models.Cursor) bool {
+
+	if cursor == nil {
+		return true
+	}
+
+	c := compareTimestamps(createdAt, cursor.CreatedAt)
+
+	return c > 0 || c == 0 && id > cursor.Id
+}
+
+// checkCursor rejects cursor together with sort other than (created_at, id) order
+func checkCursor(cursor *models.Cursor, sort []models.SortField) error {
+
+	if cursor != nil && !models.KeysetSorted(sort) {
+		return fmt.Errorf("%w: cursor pages cannot be sorted", storage.ErrInvalidInput)
+	}
+
+	return nil
+}
+
+func parseTimestamp(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	return t
+}
+
+func compareTimestamps(a, b string) int {
+	x, y := parseTimestamp(a), parseTimestamp(b)
+
+	switch {
+	case x.Before(y):
+		return -1
+	case x.After(y):
+		return 1
+	}
+	return 0
+}
+
+func compareInts(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
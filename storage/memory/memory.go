@@ -0,0 +1,238 @@
+package memory
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"crud/models"
+	"crud/storage"
+)
+
+// Store keeps every table in process memory, it is safe for concurrent use.
+// Repos behave like the postgres ones: generated UUIDs, COUNT(*) OVER() totals, rows affected on update
+// and the same unique and foreign key constraints
+type Store struct {
+	db    *db
+	inTx  bool
+	user  *userRepo
+	book  *bookRepo
+	order *orderRepo
+	role  *roleRepo
+
+	refreshToken *refreshTokenRepo
+	revocation   *revocationRepo
+	wallet       *walletRepo
+}
+
+// db holds all tables behind single lock so foreign keys between tables stay consistent.
+// version grows with every write lock, WithTx uses it to detect concurrent writes.
+// txMu lets one transaction run at a time, so transactions only conflict with writes outside them
+type db struct {
+	mu      sync.RWMutex
+	txMu    sync.Mutex
+	version uint64
+
+	tables
+}
+
+type tables struct {
+	books      []*models.Book
+	users      []*models.User
+	orders     []*models.Order
+	orderItems []*orderItem
+
+	orderStatusHistory []*orderStatusChange
+
+	// stockReserved holds ids of orders whose stock is off books like orders.stock_reserved
+	stockReserved map[string]bool
+
+	roles     []*models.Role
+	userRoles []*userRole
+
+	refreshTokens   []*refreshToken
+	revokedTokens   map[string]*models.RevokeToken
+	userRevocations map[string]time.Time
+
+	// balances caches sum of wallet entries of ledgerEntries by user like users.balance
+	ledgerEntries []*models.LedgerEntry
+	balances      map[string]int64
+}
+
+type userRole struct {
+	UserId string
+	RoleId string
+}
+
+// orderItem is row of order_items, Line keeps items in order they were listed
+type orderItem struct {
+	models.OrderItem
+	OrderId string
+	Line    int
+}
+
+// orderStatusChange is row of order_status_history
+type orderStatusChange struct {
+	models.OrderStatusChange
+	OrderId string
+}
+
+type refreshToken struct {
+	models.RefreshToken
+	TokenHash string
+}
+
+// NewMemory returns empty store seeded with SUPER and CLIENT roles like the migrations do
+func NewMemory() storage.StorageI {
+	db := &db{
+		tables: tables{
+			revokedTokens:   map[string]*models.RevokeToken{},
+			userRevocations: map[string]time.Time{},
+			balances:        map[string]int64{},
+			stockReserved:   map[string]bool{},
+		},
+	}
+
+	created := timestamp(now())
+
+	db.roles = []*models.Role{
+		{
+			Id:   "6f1c8a9e-2b1d-4c47-9f0e-1a2b3c4d5e01",
+			Name: "SUPER",
+			Permissions: []string{
+				"book:read", "book:write", "order:read", "order:write",
+				"role:read", "role:write", "user:read", "user:write",
+			},
+			CreatedAt: created,
+			UpdatedAt: created,
+		},
+		{
+			Id:          "6f1c8a9e-2b1d-4c47-9f0e-1a2b3c4d5e02",
+			Name:        "CLIENT",
+			Permissions: []string{"order:write"},
+			CreatedAt:   created,
+			UpdatedAt:   created,
+		},
+	}
+
+	return &Store{db: db}
+}
+
+func (s *Store) CloseDB() {}
+
+// lock takes write lock and marks db as changed
+func (d *db) lock() {
+	d.mu.Lock()
+	d.version++
+}
+
+func (s *Store) User() storage.UserRepoI {
+
+	if s.user == nil {
+		s.user = &userRepo{db: s.db}
+	}
+
+	return s.user
+}
+
+func (s *Store) Book() storage.BookRepoI {
+
+	if s.book == nil {
+		s.book = &bookRepo{db: s.db}
+	}
+
+	return s.book
+}
+
+func (s *Store) Order() storage.OrderRepoI {
+
+	if s.order == nil {
+		s.order = &orderRepo{db: s.db}
+	}
+
+	return s.order
+}
+
+func (s *Store) Role() storage.RoleRepoI {
+
+	if s.role == nil {
+		s.role = &roleRepo{db: s.db}
+	}
+
+	return s.role
+}
+
+func (s *Store) RefreshToken() storage.RefreshTokenRepoI {
+
+	if s.refreshToken == nil {
+		s.refreshToken = &refreshTokenRepo{db: s.db}
+	}
+
+	return s.refreshToken
+}
+
+func (s *Store) Revocation() storage.RevocationRepoI {
+
+	if s.revocation == nil {
+		s.revocation = &revocationRepo{db: s.db}
+	}
+
+	return s.revocation
+}
+
+func (s *Store) Wallet() storage.WalletRepoI {
+
+	if s.wallet == nil {
+		s.wallet = &walletRepo{db: s.db}
+	}
+
+	return s.wallet
+}
+
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// timestamp formats time the way TIMESTAMP columns scanned into sql.NullString look
+func timestamp(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// checkUUID rejects ids postgres would fail to cast to UUID
+func checkUUID(id string) error {
+	_, err := uuid.Parse(id)
+	if err != nil {
+		return fmt.Errorf("%w: malformed uuid %q", storage.ErrInvalidInput, id)
+	}
+	return nil
+}
+
+// page applies OFFSET and LIMIT, count is total like COUNT(*) OVER() which is zero when page has no rows
+func page(total int, offset, limit, defaultLimit int32) (from, to int, count int32) {
+
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	from, to = int(offset), int(offset)+int(limit)
+
+	if from > total {
+		from = total
+	}
+
+	if to > total {
+		to = total
+	}
+
+	if from < to {
+		count = int32(total)
+	}
+
+	return from, to, count
+}
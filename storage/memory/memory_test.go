@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"crud/storage"
+	"crud/storage/memory"
+	"crud/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageI {
+		return memory.NewMemory()
+	})
+}
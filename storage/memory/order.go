@@ -0,0 +1,654 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"crud/models"
+	"crud/storage"
+)
+
+type orderRepo struct {
+	db *db
+}
+
+func (f *orderRepo) Create(ctx context.Context, order *models.CreateOrder) (string, error) {
+
+	var (
+		id      = uuid.New().String()
+		created = timestamp(now())
+	)
+
+	items, err := storage.OrderItems(order)
+	if err != nil {
+		return "", err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	err = f.db.checkUserReference(order.UserId)
+	if err != nil {
+		return "", err
+	}
+
+	err = f.db.checkChangedBy(order.CreatedBy)
+	if err != nil {
+		return "", err
+	}
+
+	var orderItems []*orderItem
+
+	for i, item := range items {
+		err = f.db.checkBookReference(item.BookId)
+		if err != nil {
+			return "", err
+		}
+
+		if f.db.findBook(item.BookId).Stock < item.Quantity {
+			return "", fmt.Errorf("%w: not enough stock of book %s", storage.ErrConflict, item.BookId)
+		}
+
+		// unit price is copied from book, later price changes leave the order alone
+		price := f.db.findBook(item.BookId).Price
+
+		if i > 0 && price.Currency != orderItems[0].UnitPrice.Currency {
+			return "", fmt.Errorf("%w: books of order are priced in different currencies", storage.ErrInvalidInput)
+		}
+
+		orderItems = append(orderItems, &orderItem{
+			OrderItem: models.OrderItem{
+				BookId:    item.BookId,
+				Quantity:  item.Quantity,
+				UnitPrice: price,
+			},
+			OrderId: id,
+			Line:    i + 1,
+		})
+	}
+
+	// every item is checked before any stock is taken, nothing is left half reserved
+	// version of book moves on like in postgres, stale PUT or PATCH cannot bring reserved copies back
+	for _, item := range orderItems {
+		book := f.db.findBook(item.BookId)
+		book.Stock -= item.Quantity
+		book.Version++
+	}
+
+	var reservedUntil string
+	if !order.ReservedUntil.IsZero() {
+		reservedUntil = timestamp(order.ReservedUntil.UTC().Truncate(time.Microsecond))
+	}
+
+	f.db.orders = append(f.db.orders, &models.Order{
+		Id:            id,
+		UserId:        order.UserId,
+		Status:        models.OrderPending,
+		ReservedUntil: reservedUntil,
+		CreatedAt:     created,
+		UpdatedAt:     created,
+		Version:       1,
+	})
+
+	f.db.orderItems = append(f.db.orderItems, orderItems...)
+	f.db.stockReserved[id] = true
+	f.db.recordStatus(id, "", models.OrderPending, order.CreatedBy)
+
+	return id, nil
+}
+
+func (f *orderRepo) GetByPKey(ctx context.Context, pkey *models.OrderPrimarKey) (*models.Order, error) {
+
+	err := checkUUID(pkey.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	order := f.db.findOrder(pkey.Id)
+	if order == nil || order.DeletedAt != "" && !pkey.IncludeDeleted {
+		return nil, storage.ErrNotFound
+	}
+
+	return f.db.withItems(order), nil
+}
+
+func (f *orderRepo) GetList(ctx context.Context, req *models.GetListOrderRequest) (*models.GetListOrderResponse, error) {
+
+	var (
+		resp   = models.GetListOrderResponse{}
+		orders []*models.Order
+		total  int32
+	)
+
+	err := checkCursor(req.After, req.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range []string{req.BookId, req.UserId} {
+		if id != "" {
+			err := checkUUID(id)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	for _, order := range f.db.orders {
+		switch {
+		case order.DeletedAt != "" && !req.IncludeDeleted,
+			req.BookId != "" && !f.db.orderHasBook(order.Id, req.BookId),
+			req.UserId != "" && order.UserId != req.UserId,
+			req.Status != "" && order.Status != req.Status,
+			!createdBetween(order.CreatedAt, req.CreatedFrom, req.CreatedTo):
+			continue
+		}
+
+		total++
+
+		if !afterCursor(order.CreatedAt, order.Id, req.After) {
+			continue
+		}
+
+		orders = append(orders, f.db.withItems(order))
+	}
+
+	err = sortRows(orders, req.Sort, map[string]compareFunc{
+		"created_at": func(i, j int) int { return compareTimestamps(orders[i].CreatedAt, orders[j].CreatedAt) },
+		"updated_at": func(i, j int) int { return compareTimestamps(orders[i].UpdatedAt, orders[j].UpdatedAt) },
+	}, func(i, j int) int { return strings.Compare(orders[i].Id, orders[j].Id) })
+	if err != nil {
+		return nil, err
+	}
+
+	from, to, count := page(len(orders), req.Offset, req.Limit, 10)
+
+	switch {
+	case req.After == nil:
+		resp.Count = &count
+	case req.WithCount:
+		resp.Count = &total
+	}
+
+	if from < to {
+		resp.Orders = orders[from:to]
+	}
+
+	if to < len(orders) && models.KeysetSorted(req.Sort) {
+		resp.Next = &models.Cursor{CreatedAt: orders[to-1].CreatedAt, Id: orders[to-1].Id}
+	}
+
+	return &resp, nil
+}
+
+func (f *orderRepo) Update(ctx context.Context, req *models.UpdateOrder) (int64, error) {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	order := f.db.findLiveOrder(req.Id)
+	if order == nil {
+		return 0, nil
+	}
+
+	if req.Version != 0 && order.Version != req.Version {
+		return 0, storage.ErrVersionMismatch
+	}
+
+	err = checkPending(order)
+	if err != nil {
+		return 0, err
+	}
+
+	err = f.db.checkUserReference(req.UserId)
+	if err != nil {
+		return 0, err
+	}
+
+	order.UserId = req.UserId
+	order.UpdatedAt = timestamp(now())
+	order.Version++
+
+	return 1, nil
+}
+
+func (f *orderRepo) Patch(ctx context.Context, req *models.PatchOrder) (*models.Order, error) {
+
+	if req.UserId == nil {
+		order, err := f.GetByPKey(ctx, &models.OrderPrimarKey{Id: req.Id})
+		if err == nil && req.Version != 0 && order.Version != req.Version {
+			return nil, storage.ErrVersionMismatch
+		}
+
+		return order, err
+	}
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	order := f.db.findLiveOrder(req.Id)
+	if order == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	if req.Version != 0 && order.Version != req.Version {
+		return nil, storage.ErrVersionMismatch
+	}
+
+	err = checkPending(order)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.db.checkUserReference(*req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	order.UserId = *req.UserId
+	order.UpdatedAt = timestamp(now())
+	order.Version++
+
+	return f.db.withItems(order), nil
+}
+
+func (f *orderRepo) Delete(ctx context.Context, req *models.OrderPrimarKey) error {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	order := f.db.findLiveOrder(req.Id)
+	if order == nil {
+		return storage.ErrNotFound
+	}
+
+	if req.Version != 0 && order.Version != req.Version {
+		return storage.ErrVersionMismatch
+	}
+
+	order.DeletedAt = timestamp(now())
+	order.Version++
+
+	return nil
+}
+
+// Restore brings order back only together with its user and books
+func (f *orderRepo) Restore(ctx context.Context, req *models.OrderPrimarKey) (*models.Order, error) {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	order := f.db.findOrder(req.Id)
+	if order == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	if order.DeletedAt != "" {
+		err = f.db.checkOrderReferences(order.Id, order.UserId)
+		if err != nil {
+			return nil, err
+		}
+
+		order.DeletedAt = ""
+		order.UpdatedAt = timestamp(now())
+		order.Version++
+	}
+
+	return f.db.withItems(order), nil
+}
+
+// Transition moves live order to next status of its state machine and records it in history.
+// Status the order cannot move to from where it is is ErrConflict
+func (f *orderRepo) Transition(ctx context.Context, req *models.OrderTransition) (*models.Order, error) {
+
+	if !models.ValidOrderStatus(req.Status) {
+		return nil, fmt.Errorf("%w: unknown status %q", storage.ErrInvalidInput, req.Status)
+	}
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	order := f.db.findLiveOrder(req.Id)
+	if order == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	if req.Version != 0 && order.Version != req.Version {
+		return nil, storage.ErrVersionMismatch
+	}
+
+	if !models.CanTransition(order.Status, req.Status) {
+		return nil, fmt.Errorf("%w: order cannot go from %s to %s", storage.ErrConflict, order.Status, req.Status)
+	}
+
+	err = f.db.checkChangedBy(req.ChangedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	// paying debits wallet of user and refund gives back what was paid, both can still fail
+	switch req.Status {
+	case models.OrderPaid:
+		err = f.db.payOrder(order, req.ChangedBy)
+	case models.OrderRefunded:
+		err = f.db.refundOrder(order, req.ChangedBy)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.recordStatus(order.Id, order.Status, req.Status, req.ChangedBy)
+
+	// only pending order holds stock, cancelled one gives it back
+	if req.Status == models.OrderCancelled {
+		f.db.releaseStock(order.Id)
+	}
+
+	order.Status = req.Status
+	order.ReservedUntil = ""
+	order.UpdatedAt = timestamp(now())
+	order.Version++
+
+	return f.db.withItems(order), nil
+}
+
+// GetStatusHistory returns status changes of order, oldest first
+func (f *orderRepo) GetStatusHistory(ctx context.Context, pkey *models.OrderPrimarKey) ([]*models.OrderStatusChange, error) {
+
+	err := checkUUID(pkey.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	order := f.db.findOrder(pkey.Id)
+	if order == nil || order.DeletedAt != "" && !pkey.IncludeDeleted {
+		return nil, storage.ErrNotFound
+	}
+
+	history := []*models.OrderStatusChange{}
+
+	for _, change := range f.db.orderStatusHistory {
+		if change.OrderId == order.Id {
+			change := change.OrderStatusChange
+			history = append(history, &change)
+		}
+	}
+
+	return history, nil
+}
+
+// PurgeDeleted removes orders deleted before deletedBefore, stock still held by pending ones goes back
+func (f *orderRepo) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	var (
+		kept   []*models.Order
+		purged int64
+	)
+
+	for _, order := range f.db.orders {
+		if order.DeletedAt != "" && parseTimestamp(order.DeletedAt).Before(deletedBefore) {
+			if order.Status == models.OrderPending {
+				f.db.releaseStock(order.Id)
+			}
+
+			delete(f.db.stockReserved, order.Id)
+
+			purged++
+			continue
+		}
+
+		kept = append(kept, order)
+	}
+
+	f.db.orders = kept
+
+	// items go with their order like ON DELETE CASCADE
+	var items []*orderItem
+	for _, item := range f.db.orderItems {
+		if f.db.findOrder(item.OrderId) != nil {
+			items = append(items, item)
+		}
+	}
+	f.db.orderItems = items
+
+	var history []*orderStatusChange
+	for _, change := range f.db.orderStatusHistory {
+		if f.db.findOrder(change.OrderId) != nil {
+			history = append(history, change)
+		}
+	}
+	f.db.orderStatusHistory = history
+
+	// ledger keeps payments of purged orders like ON DELETE SET NULL
+	for _, entry := range f.db.ledgerEntries {
+		if entry.OrderId != "" && f.db.findOrder(entry.OrderId) == nil {
+			entry.OrderId = ""
+		}
+	}
+
+	return purged, nil
+}
+
+// ExpireReservations cancels pending orders reserved until before expiredBefore and gives their stock back.
+// Deleted orders expire too, their stock is held until then like for live ones
+func (f *orderRepo) ExpireReservations(ctx context.Context, expiredBefore time.Time) (int64, error) {
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	var expired int64
+
+	for _, order := range f.db.orders {
+		if order.Status != models.OrderPending || order.ReservedUntil == "" ||
+			!parseTimestamp(order.ReservedUntil).Before(expiredBefore) {
+			continue
+		}
+
+		f.db.releaseStock(order.Id)
+		f.db.recordStatus(order.Id, order.Status, models.OrderCancelled, "")
+
+		order.Status = models.OrderCancelled
+		order.ReservedUntil = ""
+		order.UpdatedAt = timestamp(now())
+		order.Version++
+
+		expired++
+	}
+
+	return expired, nil
+}
+
+func (d *db) findOrder(id string) *models.Order {
+	for _, order := range d.orders {
+		if order.Id == id {
+			return order
+		}
+	}
+	return nil
+}
+
+// findLiveOrder is findOrder skipping deleted order
+func (d *db) findLiveOrder(id string) *models.Order {
+	if order := d.findOrder(id); order != nil && order.DeletedAt == "" {
+		return order
+	}
+	return nil
+}
+
+// checkOrderReferences enforces foreign keys of orders.user_id and order_items.book_id of order,
+// deleted book or user counts as missing
+func (d *db) checkOrderReferences(orderId, userId string) error {
+
+	err := d.checkUserReference(userId)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range d.orderItems {
+		if item.OrderId == orderId {
+			err = d.checkBookReference(item.BookId)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkChangedBy enforces foreign key of order_status_history.changed_by, empty changedBy is unknown user
+func (d *db) checkChangedBy(changedBy string) error {
+
+	if changedBy == "" {
+		return nil
+	}
+
+	err := checkUUID(changedBy)
+	if err != nil {
+		return err
+	}
+
+	if d.findUser(changedBy) == nil {
+		return fmt.Errorf("%w: user %s does not exist", storage.ErrForeignKey, changedBy)
+	}
+
+	return nil
+}
+
+func (d *db) checkBookReference(bookId string) error {
+
+	err := checkUUID(bookId)
+	if err != nil {
+		return err
+	}
+
+	if d.findLiveBook(bookId) == nil {
+		return fmt.Errorf("%w: book %s does not exist", storage.ErrForeignKey, bookId)
+	}
+
+	return nil
+}
+
+func (d *db) checkUserReference(userId string) error {
+
+	err := checkUUID(userId)
+	if err != nil {
+		return err
+	}
+
+	if d.findLiveUser(userId) == nil {
+		return fmt.Errorf("%w: user %s does not exist", storage.ErrForeignKey, userId)
+	}
+
+	return nil
+}
+
+// withItems copies order with its items and total
+func (d *db) withItems(order *models.Order) *models.Order {
+
+	resp := *order
+	resp.Items = []*models.OrderItem{}
+
+	for _, item := range d.orderItems {
+		if item.OrderId == order.Id {
+			item := item.OrderItem
+			resp.Items = append(resp.Items, &item)
+		}
+	}
+
+	// Create lets only books of one currency into order, summing its items cannot fail
+	_ = storage.OrderTotals(&resp)
+
+	return &resp
+}
+
+func (d *db) orderHasBook(orderId, bookId string) bool {
+	for _, item := range d.orderItems {
+		if item.OrderId == orderId && item.BookId == bookId {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseStock gives copies held by items of order back to their books and moves their version on.
+// Order that never reserved stock or already gave it back releases nothing
+func (d *db) releaseStock(orderId string) {
+
+	if !d.stockReserved[orderId] {
+		return
+	}
+
+	delete(d.stockReserved, orderId)
+
+	for _, item := range d.orderItems {
+		if item.OrderId == orderId {
+			if book := d.findBook(item.BookId); book != nil {
+				book.Stock += item.Quantity
+				book.Version++
+			}
+		}
+	}
+}
+
+func (d *db) recordStatus(orderId, from, to, changedBy string) {
+	d.orderStatusHistory = append(d.orderStatusHistory, &orderStatusChange{
+		OrderStatusChange: models.OrderStatusChange{
+			FromStatus: from,
+			ToStatus:   to,
+			ChangedBy:  changedBy,
+			ChangedAt:  timestamp(now()),
+		},
+		OrderId: orderId,
+	})
+}
+
+// checkPending lets only pending order change its user
+func checkPending(order *models.Order) error {
+	if order.Status != models.OrderPending {
+		return fmt.Errorf("%w: order is %s, only pending order can change", storage.ErrConflict, order.Status)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"crud/models"
+	"crud/storage"
+)
+
+type refreshTokenRepo struct {
+	db *db
+}
+
+func (f *refreshTokenRepo) Create(ctx context.Context, token *models.CreateRefreshToken) (string, error) {
+
+	var id = uuid.New().String()
+
+	for _, id := range []string{token.FamilyId, token.UserId} {
+		err := checkUUID(id)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	if f.db.findUser(token.UserId) == nil {
+		return "", fmt.Errorf("%w: user %s does not exist", storage.ErrForeignKey, token.UserId)
+	}
+
+	if f.db.findRefreshToken("", token.TokenHash) != nil {
+		return "", fmt.Errorf("%w: refresh token hash already exists", storage.ErrConflict)
+	}
+
+	f.db.refreshTokens = append(f.db.refreshTokens, &refreshToken{
+		RefreshToken: models.RefreshToken{
+			Id:        id,
+			FamilyId:  token.FamilyId,
+			UserId:    token.UserId,
+			Role:      token.Role,
+			ExpiresAt: token.ExpiresAt.UTC(),
+			CreatedAt: timestamp(now()),
+		},
+		TokenHash: token.TokenHash,
+	})
+
+	return id, nil
+}
+
+func (f *refreshTokenRepo) GetByPKey(ctx context.Context, pkey *models.RefreshTokenPrimarKey) (*models.RefreshToken, error) {
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	token := f.db.findRefreshToken(pkey.Id, pkey.TokenHash)
+	if token == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	resp := token.RefreshToken
+
+	if token.UsedAt != nil {
+		usedAt := *token.UsedAt
+		resp.UsedAt = &usedAt
+	}
+
+	if token.RevokedAt != nil {
+		revokedAt := *token.RevokedAt
+		resp.RevokedAt = &revokedAt
+	}
+
+	return &resp, nil
+}
+
+// Use marks active token as used, zero rows affected means token was already used or revoked
+func (f *refreshTokenRepo) Use(ctx context.Context, pkey *models.RefreshTokenPrimarKey) (int64, error) {
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	token := f.db.findRefreshToken("", pkey.TokenHash)
+	if token == nil || token.UsedAt != nil || token.RevokedAt != nil {
+		return 0, nil
+	}
+
+	usedAt := now()
+	token.UsedAt = &usedAt
+
+	return 1, nil
+}
+
+func (f *refreshTokenRepo) RevokeFamily(ctx context.Context, familyId string) error {
+
+	err := checkUUID(familyId)
+	if err != nil {
+		return err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	revokedAt := now()
+
+	for _, token := range f.db.refreshTokens {
+		if token.FamilyId == familyId && token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+		}
+	}
+
+	return nil
+}
+
+func (f *refreshTokenRepo) RevokeUser(ctx context.Context, userId string) error {
+
+	err := checkUUID(userId)
+	if err != nil {
+		return err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	revokedAt := now()
+
+	for _, token := range f.db.refreshTokens {
+		if token.UserId == userId && token.RevokedAt == nil {
+			token.RevokedAt = &revokedAt
+		}
+	}
+
+	return nil
+}
+
+func (d *db) findRefreshToken(id, tokenHash string) *refreshToken {
+	for _, token := range d.refreshTokens {
+		if token.Id == id || token.TokenHash == tokenHash {
+			return token
+		}
+	}
+	return nil
+}
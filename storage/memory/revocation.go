@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"crud/models"
+	"crud/storage"
+)
+
+type revocationRepo struct {
+	db *db
+}
+
+func (f *revocationRepo) Revoke(ctx context.Context, req *models.RevokeToken) error {
+
+	err := checkUUID(req.UserId)
+	if err != nil {
+		return err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	if f.db.findUser(req.UserId) == nil {
+		return fmt.Errorf("%w: user %s does not exist", storage.ErrForeignKey, req.UserId)
+	}
+
+	if _, ok := f.db.revokedTokens[req.Jti]; ok {
+		return nil
+	}
+
+	f.db.revokedTokens[req.Jti] = &models.RevokeToken{
+		Jti:       req.Jti,
+		UserId:    req.UserId,
+		ExpiresAt: req.ExpiresAt.UTC(),
+	}
+
+	return nil
+}
+
+func (f *revocationRepo) RevokeUser(ctx context.Context, req *models.RevokeUserTokens) error {
+
+	err := checkUUID(req.UserId)
+	if err != nil {
+		return err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	if f.db.findUser(req.UserId) == nil {
+		return fmt.Errorf("%w: user %s does not exist", storage.ErrForeignKey, req.UserId)
+	}
+
+	f.db.userRevocations[req.UserId] = req.RevokedBefore.UTC()
+
+	return nil
+}
+
+// GetActive returns revoked tokens that are not expired yet and all user wide revocations
+func (f *revocationRepo) GetActive(ctx context.Context) (*models.Revocations, error) {
+
+	var (
+		resp    = models.Revocations{}
+		current = now()
+	)
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	for _, token := range f.db.revokedTokens {
+		if token.ExpiresAt.After(current) {
+			token := *token
+			resp.Tokens = append(resp.Tokens, &token)
+		}
+	}
+
+	for userId, revokedBefore := range f.db.userRevocations {
+		resp.Users = append(resp.Users, &models.RevokeUserTokens{
+			UserId:        userId,
+			RevokedBefore: revokedBefore,
+		})
+	}
+
+	return &resp, nil
+}
+
+func (f *revocationRepo) DeleteExpired(ctx context.Context) (int64, error) {
+
+	var (
+		deleted int64
+		current = now()
+	)
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	for jti, token := range f.db.revokedTokens {
+		if !token.ExpiresAt.After(current) {
+			delete(f.db.revokedTokens, jti)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,279 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"crud/models"
+	"crud/storage"
+)
+
+type roleRepo struct {
+	db *db
+}
+
+func (f *roleRepo) Create(ctx context.Context, role *models.CreateRole) (string, error) {
+
+	var (
+		id      = uuid.New().String()
+		created = timestamp(now())
+	)
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	if f.db.findRoleByName(role.Name) != nil {
+		return "", fmt.Errorf("%w: role %q already exists", storage.ErrConflict, role.Name)
+	}
+
+	f.db.roles = append(f.db.roles, &models.Role{
+		Id:          id,
+		Name:        role.Name,
+		Permissions: permissionSet(role.Permissions),
+		CreatedAt:   created,
+		UpdatedAt:   created,
+	})
+
+	return id, nil
+}
+
+func (f *roleRepo) GetByPKey(ctx context.Context, pkey *models.RolePrimarKey) (*models.Role, error) {
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	for _, role := range f.db.roles {
+		if role.Id == pkey.Id || role.Name == pkey.Name {
+			return copyRole(role), nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (f *roleRepo) GetList(ctx context.Context, req *models.GetListRoleRequest) (*models.GetListRoleResponse, error) {
+
+	var resp = models.GetListRoleResponse{}
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	roles := make([]*models.Role, len(f.db.roles))
+	copy(roles, f.db.roles)
+
+	sort.SliceStable(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	from, to, count := page(len(roles), req.Offset, req.Limit, 10)
+
+	resp.Count = count
+
+	for _, role := range roles[from:to] {
+		resp.Roles = append(resp.Roles, copyRole(role))
+	}
+
+	return &resp, nil
+}
+
+func (f *roleRepo) Update(ctx context.Context, req *models.UpdateRole) (int64, error) {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	role := f.db.findRole(req.Id)
+	if role == nil {
+		return 0, nil
+	}
+
+	if other := f.db.findRoleByName(req.Name); other != nil && other.Id != role.Id {
+		return 0, fmt.Errorf("%w: role %q already exists", storage.ErrConflict, req.Name)
+	}
+
+	role.Name = req.Name
+	role.Permissions = permissionSet(req.Permissions)
+	role.UpdatedAt = timestamp(now())
+
+	return 1, nil
+}
+
+func (f *roleRepo) Delete(ctx context.Context, req *models.RolePrimarKey) error {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	role := f.db.findRole(req.Id)
+	if role == nil {
+		return storage.ErrNotFound
+	}
+
+	for i := range f.db.roles {
+		if f.db.roles[i] == role {
+			f.db.roles = append(f.db.roles[:i], f.db.roles[i+1:]...)
+			break
+		}
+	}
+
+	var userRoles []*userRole
+	for _, userRole := range f.db.userRoles {
+		if userRole.RoleId != role.Id {
+			userRoles = append(userRoles, userRole)
+		}
+	}
+	f.db.userRoles = userRoles
+
+	return nil
+}
+
+func (f *roleRepo) AssignToUser(ctx context.Context, req *models.UserRole) error {
+
+	err := checkUUID(req.UserId)
+	if err != nil {
+		return err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	role := f.db.findRoleByName(req.Role)
+	if role == nil {
+		return storage.ErrNotFound
+	}
+
+	if f.db.findUser(req.UserId) == nil {
+		return fmt.Errorf("%w: user %s does not exist", storage.ErrForeignKey, req.UserId)
+	}
+
+	for _, userRole := range f.db.userRoles {
+		if userRole.UserId == req.UserId && userRole.RoleId == role.Id {
+			return nil
+		}
+	}
+
+	f.db.userRoles = append(f.db.userRoles, &userRole{UserId: req.UserId, RoleId: role.Id})
+
+	return nil
+}
+
+func (f *roleRepo) RevokeFromUser(ctx context.Context, req *models.UserRole) error {
+
+	err := checkUUID(req.UserId)
+	if err != nil {
+		return err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	role := f.db.findRoleByName(req.Role)
+	if role == nil {
+		return nil
+	}
+
+	for i, userRole := range f.db.userRoles {
+		if userRole.UserId == req.UserId && userRole.RoleId == role.Id {
+			f.db.userRoles = append(f.db.userRoles[:i], f.db.userRoles[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (f *roleRepo) GetUserRoles(ctx context.Context, userId string) ([]string, error) {
+
+	var roles []string
+
+	err := checkUUID(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	// userRoles is kept in assignment order like ORDER BY created_at
+	for _, userRole := range f.db.userRoles {
+		if userRole.UserId == userId {
+			roles = append(roles, f.db.findRole(userRole.RoleId).Name)
+		}
+	}
+
+	return roles, nil
+}
+
+func (f *roleRepo) HasPermission(ctx context.Context, role string, permission string) (bool, error) {
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	found := f.db.findRoleByName(role)
+	if found == nil {
+		return false, nil
+	}
+
+	for _, name := range found.Permissions {
+		if name == permission {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (d *db) findRole(id string) *models.Role {
+	for _, role := range d.roles {
+		if role.Id == id {
+			return role
+		}
+	}
+	return nil
+}
+
+func (d *db) findRoleByName(name string) *models.Role {
+	for _, role := range d.roles {
+		if role.Name == name {
+			return role
+		}
+	}
+	return nil
+}
+
+func copyRole(role *models.Role) *models.Role {
+	resp := *role
+	resp.Permissions = append([]string{}, role.Permissions...)
+	return &resp
+}
+
+// permissionSet removes duplicates and sorts by name like role_permissions read back
+func permissionSet(permissions []string) []string {
+
+	var (
+		seen = map[string]bool{}
+		set  = []string{}
+	)
+
+	for _, permission := range permissions {
+		if !seen[permission] {
+			seen[permission] = true
+			set = append(set, permission)
+		}
+	}
+
+	sort.Strings(set)
+
+	return set
+}
@@ -0,0 +1,142 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"crud/models"
+	"crud/storage"
+)
+
+// maxTxAttempts bounds how often WithTx reruns fn after another writer committed first
+const maxTxAttempts = 5
+
+var errSerializationFailure = errors.New("could not serialize access due to concurrent update")
+
+// WithTx runs fn on private copy of all tables and publishes the copy when fn returns nil.
+// When anything else wrote meanwhile, fn reruns on fresh copy like postgres retries serialization failures,
+// so fn must not have other side effects. WithTx called on tx joins the running transaction
+func (s *Store) WithTx(ctx context.Context, fn func(tx storage.StorageI) error) error {
+
+	if s.inTx {
+		return fn(s)
+	}
+
+	s.db.txMu.Lock()
+	defer s.db.txMu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+
+		err := s.runTx(fn)
+		if err == nil || !errors.Is(err, errSerializationFailure) || attempt == maxTxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * time.Millisecond):
+		}
+	}
+}
+
+func (s *Store) runTx(fn func(tx storage.StorageI) error) error {
+
+	s.db.mu.RLock()
+	base := s.db.version
+	snapshot := &db{tables: s.db.tables.clone()}
+	s.db.mu.RUnlock()
+
+	err := fn(&Store{db: snapshot, inTx: true})
+	if err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.version != base {
+		return errSerializationFailure
+	}
+
+	s.db.tables = snapshot.tables
+	s.db.version++
+
+	return nil
+}
+
+// clone copies rows, so writes through the copy leave t untouched
+func (t tables) clone() tables {
+
+	c := tables{
+		revokedTokens:   make(map[string]*models.RevokeToken, len(t.revokedTokens)),
+		userRevocations: make(map[string]time.Time, len(t.userRevocations)),
+		balances:        make(map[string]int64, len(t.balances)),
+		stockReserved:   make(map[string]bool, len(t.stockReserved)),
+	}
+
+	for _, book := range t.books {
+		book := *book
+		c.books = append(c.books, &book)
+	}
+
+	for _, user := range t.users {
+		user := *user
+		c.users = append(c.users, &user)
+	}
+
+	for _, order := range t.orders {
+		order := *order
+		c.orders = append(c.orders, &order)
+	}
+
+	for _, item := range t.orderItems {
+		item := *item
+		c.orderItems = append(c.orderItems, &item)
+	}
+
+	for _, change := range t.orderStatusHistory {
+		change := *change
+		c.orderStatusHistory = append(c.orderStatusHistory, &change)
+	}
+
+	for orderId := range t.stockReserved {
+		c.stockReserved[orderId] = true
+	}
+
+	for _, role := range t.roles {
+		c.roles = append(c.roles, copyRole(role))
+	}
+
+	for _, userRole := range t.userRoles {
+		userRole := *userRole
+		c.userRoles = append(c.userRoles, &userRole)
+	}
+
+	// UsedAt and RevokedAt are replaced, never written through, so sharing them is safe
+	for _, token := range t.refreshTokens {
+		token := *token
+		c.refreshTokens = append(c.refreshTokens, &token)
+	}
+
+	for jti, token := range t.revokedTokens {
+		token := *token
+		c.revokedTokens[jti] = &token
+	}
+
+	for userId, revokedBefore := range t.userRevocations {
+		c.userRevocations[userId] = revokedBefore
+	}
+
+	for _, entry := range t.ledgerEntries {
+		entry := *entry
+		c.ledgerEntries = append(c.ledgerEntries, &entry)
+	}
+
+	for userId, balance := range t.balances {
+		c.balances[userId] = balance
+	}
+
+	return c
+}
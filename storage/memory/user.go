@@ -0,0 +1,421 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"crud/models"
+	"crud/storage"
+)
+
+type userRepo struct {
+	db *db
+}
+
+func (f *userRepo) Create(ctx context.Context, user *models.CreateUser) (string, error) {
+
+	var (
+		id      = uuid.New().String()
+		created = timestamp(now())
+	)
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	if f.db.findUserByLogin(user.Login) != nil {
+		return "", fmt.Errorf("%w: login %q already exists", storage.ErrConflict, user.Login)
+	}
+
+	f.db.users = append(f.db.users, &models.User{
+		Id:          id,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		Login:       user.Login,
+		Password:    user.Password,
+		PhoneNumber: user.PhoneNumber,
+		CreatedAt:   created,
+		UpdatedAt:   created,
+		Version:     1,
+	})
+
+	return id, nil
+}
+
+func (f *userRepo) GetByPKey(ctx context.Context, pkey *models.UserPrimarKey) (*models.User, error) {
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	var user *models.User
+
+	if len(pkey.Login) > 0 {
+		user = f.db.findUserByLogin(pkey.Login)
+	} else {
+		err := checkUUID(pkey.Id)
+		if err != nil {
+			return nil, err
+		}
+		user = f.db.findUser(pkey.Id)
+	}
+
+	if user == nil || user.DeletedAt != "" && !pkey.IncludeDeleted {
+		return nil, storage.ErrNotFound
+	}
+
+	resp := *user
+
+	return &resp, nil
+}
+
+func (f *userRepo) GetList(ctx context.Context, req *models.GetListUserRequest) (*models.GetListUserResponse, error) {
+
+	var (
+		resp  = models.GetListUserResponse{}
+		users []*models.User
+		total int32
+	)
+
+	err := checkCursor(req.After, req.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	for _, user := range f.db.users {
+		switch {
+		case user.DeletedAt != "" && !req.IncludeDeleted,
+			!matchesSearch(req.Search, user.FirstName, user.LastName, user.Login, user.PhoneNumber),
+			req.Login != "" && user.Login != req.Login,
+			!createdBetween(user.CreatedAt, req.CreatedFrom, req.CreatedTo):
+			continue
+		}
+
+		total++
+
+		if !afterCursor(user.CreatedAt, user.Id, req.After) {
+			continue
+		}
+
+		user := *user
+		users = append(users, &user)
+	}
+
+	err = sortRows(users, req.Sort, map[string]compareFunc{
+		"first_name": func(i, j int) int { return strings.Compare(users[i].FirstName, users[j].FirstName) },
+		"last_name":  func(i, j int) int { return strings.Compare(users[i].LastName, users[j].LastName) },
+		"login":      func(i, j int) int { return strings.Compare(users[i].Login, users[j].Login) },
+		"created_at": func(i, j int) int { return compareTimestamps(users[i].CreatedAt, users[j].CreatedAt) },
+		"updated_at": func(i, j int) int { return compareTimestamps(users[i].UpdatedAt, users[j].UpdatedAt) },
+	}, func(i, j int) int { return strings.Compare(users[i].Id, users[j].Id) })
+	if err != nil {
+		return nil, err
+	}
+
+	from, to, count := page(len(users), req.Offset, req.Limit, 5)
+
+	switch {
+	case req.After == nil:
+		resp.Count = &count
+	case req.WithCount:
+		resp.Count = &total
+	}
+
+	if from < to {
+		resp.Users = users[from:to]
+	}
+
+	if to < len(users) && models.KeysetSorted(req.Sort) {
+		resp.Next = &models.Cursor{CreatedAt: users[to-1].CreatedAt, Id: users[to-1].Id}
+	}
+
+	return &resp, nil
+}
+
+func (f *userRepo) Update(ctx context.Context, req *models.UpdateUser) (int64, error) {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	user := f.db.findLiveUser(req.Id)
+	if user == nil {
+		return 0, nil
+	}
+
+	if req.Version != 0 && user.Version != req.Version {
+		return 0, storage.ErrVersionMismatch
+	}
+
+	if other := f.db.findUserByLogin(req.Login); other != nil && other.Id != user.Id {
+		return 0, fmt.Errorf("%w: login %q already exists", storage.ErrConflict, req.Login)
+	}
+
+	user.FirstName = req.FirstName
+	user.LastName = req.LastName
+	user.Login = req.Login
+	user.Password = req.Password
+	user.PasswordResetRequired = false
+	user.PhoneNumber = req.PhoneNumber
+	user.UpdatedAt = timestamp(now())
+	user.Version++
+
+	return 1, nil
+}
+
+func (f *userRepo) Patch(ctx context.Context, req *models.PatchUser) (*models.User, error) {
+
+	if req.FirstName == nil && req.LastName == nil && req.Login == nil && req.Password == nil && req.PhoneNumber == nil {
+		user, err := f.GetByPKey(ctx, &models.UserPrimarKey{Id: req.Id})
+		if err == nil && req.Version != 0 && user.Version != req.Version {
+			return nil, storage.ErrVersionMismatch
+		}
+
+		return user, err
+	}
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	user := f.db.findLiveUser(req.Id)
+	if user == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	if req.Version != 0 && user.Version != req.Version {
+		return nil, storage.ErrVersionMismatch
+	}
+
+	if req.Login != nil {
+		if other := f.db.findUserByLogin(*req.Login); other != nil && other.Id != user.Id {
+			return nil, fmt.Errorf("%w: login %q already exists", storage.ErrConflict, *req.Login)
+		}
+
+		user.Login = *req.Login
+	}
+
+	if req.FirstName != nil {
+		user.FirstName = *req.FirstName
+	}
+
+	if req.LastName != nil {
+		user.LastName = *req.LastName
+	}
+
+	if req.Password != nil {
+		user.Password = *req.Password
+		user.PasswordResetRequired = false
+	}
+
+	if req.PhoneNumber != nil {
+		user.PhoneNumber = *req.PhoneNumber
+	}
+
+	user.UpdatedAt = timestamp(now())
+	user.Version++
+
+	resp := *user
+
+	return &resp, nil
+}
+
+func (f *userRepo) UpdatePassword(ctx context.Context, req *models.UpdateUserPassword) (int64, error) {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	user := f.db.findLiveUser(req.Id)
+	if user == nil {
+		return 0, nil
+	}
+
+	user.Password = req.Password
+	user.UpdatedAt = timestamp(now())
+	user.Version++
+
+	return 1, nil
+}
+
+func (f *userRepo) Delete(ctx context.Context, req *models.UserPrimarKey) error {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	user := f.db.findLiveUser(req.Id)
+	if user == nil {
+		return storage.ErrNotFound
+	}
+
+	if req.Version != 0 && user.Version != req.Version {
+		return storage.ErrVersionMismatch
+	}
+
+	user.DeletedAt = timestamp(now())
+	user.Version++
+
+	return nil
+}
+
+func (f *userRepo) Restore(ctx context.Context, req *models.UserPrimarKey) (*models.User, error) {
+
+	err := checkUUID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	user := f.db.findUser(req.Id)
+	if user == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	if user.DeletedAt != "" {
+		if f.db.findUserByLogin(user.Login) != nil {
+			return nil, fmt.Errorf("%w: login %q already exists", storage.ErrConflict, user.Login)
+		}
+
+		user.DeletedAt = ""
+		user.UpdatedAt = timestamp(now())
+		user.Version++
+	}
+
+	resp := *user
+
+	return &resp, nil
+}
+
+// PurgeDeleted removes users deleted before deletedBefore that no order or ledger entry references, with their roles,
+// refresh tokens and revocations like ON DELETE CASCADE
+func (f *userRepo) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	var (
+		kept   []*models.User
+		purged = map[string]bool{}
+	)
+
+	for _, user := range f.db.users {
+		if user.DeletedAt != "" && parseTimestamp(user.DeletedAt).Before(deletedBefore) && !f.db.userReferenced(user.Id) {
+			purged[user.Id] = true
+			continue
+		}
+
+		kept = append(kept, user)
+	}
+
+	f.db.users = kept
+
+	var userRoles []*userRole
+	for _, userRole := range f.db.userRoles {
+		if !purged[userRole.UserId] {
+			userRoles = append(userRoles, userRole)
+		}
+	}
+	f.db.userRoles = userRoles
+
+	var tokens []*refreshToken
+	for _, token := range f.db.refreshTokens {
+		if !purged[token.UserId] {
+			tokens = append(tokens, token)
+		}
+	}
+	f.db.refreshTokens = tokens
+
+	for jti, token := range f.db.revokedTokens {
+		if purged[token.UserId] {
+			delete(f.db.revokedTokens, jti)
+		}
+	}
+
+	for id := range purged {
+		delete(f.db.userRevocations, id)
+	}
+
+	// history and ledger keep changes of purged user like ON DELETE SET NULL
+	for _, change := range f.db.orderStatusHistory {
+		if purged[change.ChangedBy] {
+			change.ChangedBy = ""
+		}
+	}
+
+	for _, entry := range f.db.ledgerEntries {
+		if purged[entry.CreatedBy] {
+			entry.CreatedBy = ""
+		}
+	}
+
+	for id := range purged {
+		delete(f.db.balances, id)
+	}
+
+	return int64(len(purged)), nil
+}
+
+func (d *db) findUser(id string) *models.User {
+	for _, user := range d.users {
+		if user.Id == id {
+			return user
+		}
+	}
+	return nil
+}
+
+// findLiveUser is findUser skipping deleted user
+func (d *db) findLiveUser(id string) *models.User {
+	if user := d.findUser(id); user != nil && user.DeletedAt == "" {
+		return user
+	}
+	return nil
+}
+
+// findUserByLogin skips deleted users, their logins can be taken again
+func (d *db) findUserByLogin(login string) *models.User {
+	for _, user := range d.users {
+		if user.Login == login && user.DeletedAt == "" {
+			return user
+		}
+	}
+	return nil
+}
+
+func (d *db) userReferenced(id string) bool {
+	for _, order := range d.orders {
+		if order.UserId == id {
+			return true
+		}
+	}
+	for _, entry := range d.ledgerEntries {
+		if entry.UserId == id {
+			return true
+		}
+	}
+	return false
+}
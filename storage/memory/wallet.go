@@ -0,0 +1,266 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"crud/models"
+	"crud/storage"
+)
+
+type walletRepo struct {
+	db *db
+}
+
+// GetBalance sums wallet entries of user, cached balances only guard against overdraw
+func (f *walletRepo) GetBalance(ctx context.Context, pkey *models.UserPrimarKey) (*models.Wallet, error) {
+
+	err := checkUUID(pkey.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	user := f.db.findUser(pkey.Id)
+	if user == nil || user.DeletedAt != "" && !pkey.IncludeDeleted {
+		return nil, storage.ErrNotFound
+	}
+
+	return f.db.wallet(user.Id), nil
+}
+
+func (f *walletRepo) TopUp(ctx context.Context, req *models.WalletOperation) (*models.Wallet, error) {
+	return f.move(req, models.LedgerTopUp, 1)
+}
+
+func (f *walletRepo) Withdraw(ctx context.Context, req *models.WalletOperation) (*models.Wallet, error) {
+	return f.move(req, models.LedgerWithdrawal, -1)
+}
+
+// move posts amount of req between wallet and cash account, sign tells direction
+func (f *walletRepo) move(req *models.WalletOperation, kind string, sign int64) (*models.Wallet, error) {
+
+	amount, err := storage.WalletAmount(req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkUUID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	err = f.db.checkChangedBy(req.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.db.post(transfer{
+		userId:    req.UserId,
+		account:   models.AccountCash,
+		kind:      kind,
+		amount:    sign * amount,
+		createdBy: req.CreatedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return f.db.wallet(req.UserId), nil
+}
+
+// GetLedger lists wallet entries of user, deleted user keeps its ledger
+func (f *walletRepo) GetLedger(ctx context.Context, req *models.GetLedgerRequest) (*models.GetLedgerResponse, error) {
+
+	err := checkUUID(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+
+	if f.db.findUser(req.UserId) == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	var entries []*models.LedgerEntry
+
+	for _, entry := range f.db.ledgerEntries {
+		if entry.UserId == req.UserId {
+			entry := *entry
+			entries = append(entries, &entry)
+		}
+	}
+
+	from, to, count := page(len(entries), req.Offset, req.Limit, 10)
+
+	resp := &models.GetLedgerResponse{Count: count, Entries: []*models.LedgerEntry{}}
+	if from < to {
+		resp.Entries = entries[from:to]
+	}
+
+	return resp, nil
+}
+
+// Reconcile sets cached balance of every user to sum of their ledger entries
+func (f *walletRepo) Reconcile(ctx context.Context) ([]*models.BalanceMismatch, error) {
+
+	f.db.lock()
+	defer f.db.mu.Unlock()
+
+	fixed := []*models.BalanceMismatch{}
+
+	for _, user := range f.db.users {
+		cached, ledger := f.db.balances[user.Id], f.db.ledgerBalance(user.Id)
+
+		if cached != ledger {
+			fixed = append(fixed, &models.BalanceMismatch{
+				UserId:        user.Id,
+				Balance:       models.Money{Amount: cached, Currency: models.WalletCurrency},
+				LedgerBalance: models.Money{Amount: ledger, Currency: models.WalletCurrency},
+			})
+
+			f.db.balances[user.Id] = ledger
+		}
+	}
+
+	return fixed, nil
+}
+
+// transfer is ledger transaction between wallet of user and account, positive amount goes into wallet
+type transfer struct {
+	userId    string
+	account   string
+	kind      string
+	orderId   string
+	createdBy string
+	amount    int64
+}
+
+// post records transfer as two entries that sum to zero and moves cached balance of user with it.
+// User must be live, wallet that would go below zero is ErrConflict
+func (d *db) post(t transfer) error {
+
+	if d.findLiveUser(t.userId) == nil {
+		return storage.ErrNotFound
+	}
+
+	balance := d.balances[t.userId] + t.amount
+
+	if balance < 0 {
+		return fmt.Errorf("%w: balance of user %s is too low", storage.ErrConflict, t.userId)
+	}
+
+	if balance > 1<<31-1 {
+		return fmt.Errorf("%w: balance of user %s would overflow", storage.ErrInvalidInput, t.userId)
+	}
+
+	var (
+		transactionId = uuid.New().String()
+		created       = timestamp(now())
+	)
+
+	d.balances[t.userId] = balance
+
+	d.ledgerEntries = append(d.ledgerEntries,
+		&models.LedgerEntry{
+			Id:            uuid.New().String(),
+			TransactionId: transactionId,
+			Account:       models.AccountWallet,
+			UserId:        t.userId,
+			OrderId:       t.orderId,
+			Kind:          t.kind,
+			Amount:        models.Money{Amount: t.amount, Currency: models.WalletCurrency},
+			CreatedBy:     t.createdBy,
+			CreatedAt:     created,
+		},
+		&models.LedgerEntry{
+			Id:            uuid.New().String(),
+			TransactionId: transactionId,
+			Account:       t.account,
+			OrderId:       t.orderId,
+			Kind:          t.kind,
+			Amount:        models.Money{Amount: -t.amount, Currency: models.WalletCurrency},
+			CreatedBy:     t.createdBy,
+			CreatedAt:     created,
+		},
+	)
+
+	return nil
+}
+
+// payOrder debits wallet of user with total of order, order priced in other currency than wallets hold
+// is ErrConflict
+func (d *db) payOrder(order *models.Order, changedBy string) error {
+
+	total := d.withItems(order).Total
+	if total.Amount == 0 {
+		return nil
+	}
+
+	if total.Currency != models.WalletCurrency {
+		return fmt.Errorf("%w: order is priced in %s, wallets hold %s", storage.ErrConflict, total.Currency, models.WalletCurrency)
+	}
+
+	return d.post(transfer{
+		userId:    order.UserId,
+		account:   models.AccountRevenue,
+		kind:      models.LedgerOrderPayment,
+		orderId:   order.Id,
+		createdBy: changedBy,
+		amount:    -total.Amount,
+	})
+}
+
+// refundOrder credits wallet of user with what ledger says order took from it
+func (d *db) refundOrder(order *models.Order, changedBy string) error {
+
+	var paid int64
+
+	for _, entry := range d.ledgerEntries {
+		if entry.OrderId == order.Id && entry.Account == models.AccountWallet {
+			paid -= entry.Amount.Amount
+		}
+	}
+
+	if paid <= 0 {
+		return nil
+	}
+
+	return d.post(transfer{
+		userId:    order.UserId,
+		account:   models.AccountRevenue,
+		kind:      models.LedgerOrderRefund,
+		orderId:   order.Id,
+		createdBy: changedBy,
+		amount:    paid,
+	})
+}
+
+func (d *db) ledgerBalance(userId string) int64 {
+
+	var balance int64
+
+	for _, entry := range d.ledgerEntries {
+		if entry.UserId == userId {
+			balance += entry.Amount.Amount
+		}
+	}
+
+	return balance
+}
+
+func (d *db) wallet(userId string) *models.Wallet {
+	return &models.Wallet{
+		UserId:  userId,
+		Balance: models.Money{Amount: d.ledgerBalance(userId), Currency: models.WalletCurrency},
+	}
+}
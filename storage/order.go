@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"fmt"
+
+	"crud/models"
+)
+
+// OrderItems returns items of order to create, BookId alone is single item of quantity 1.
+// Order without items, with quantity below 1 or with the same book twice is ErrInvalidInput
+func OrderItems(order *models.CreateOrder) ([]*models.CreateOrderItem, error) {
+
+	items := order.Items
+
+	if order.BookId != "" {
+		if len(items) > 0 {
+			return nil, fmt.Errorf("%w: book_id cannot be combined with items", ErrInvalidInput)
+		}
+
+		items = []*models.CreateOrderItem{{BookId: order.BookId, Quantity: 1}}
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: order has no items", ErrInvalidInput)
+	}
+
+	seen := make(map[string]bool, len(items))
+
+	for _, item := range items {
+		if item == nil || item.Quantity < 1 {
+			return nil, fmt.Errorf("%w: quantity must be at least 1", ErrInvalidInput)
+		}
+
+		if seen[item.BookId] {
+			return nil, fmt.Errorf("%w: book %s is listed twice", ErrInvalidInput, item.BookId)
+		}
+
+		seen[item.BookId] = true
+	}
+
+	return items, nil
+}
+
+// OrderTotals sets Total of every item of order and of order itself. Order without items totals zero
+// of DefaultCurrency, items in different currencies cannot be summed
+func OrderTotals(order *models.Order) error {
+
+	total := models.Money{Currency: models.DefaultCurrency}
+
+	if len(order.Items) > 0 {
+		total.Currency = order.Items[0].UnitPrice.Currency
+	}
+
+	for _, item := range order.Items {
+		itemTotal, err := item.UnitPrice.Mul(int64(item.Quantity))
+		if err != nil {
+			return fmt.Errorf("total of order %s: %w", order.Id, err)
+		}
+
+		total, err = total.Add(itemTotal)
+		if err != nil {
+			return fmt.Errorf("total of order %s: %w", order.Id, err)
+		}
+
+		item.Total = itemTotal
+	}
+
+	order.Total = total
+
+	return nil
+}
@@ -3,20 +3,22 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v4/pgxpool"
 
 	"crud/models"
 	"crud/pkg/helper"
+	"crud/storage"
 )
 
 type bookRepo struct {
-	db *pgxpool.Pool
+	db querier
 }
 
-func NewBookRepo(db *pgxpool.Pool) *bookRepo {
+func NewBookRepo(db querier) *bookRepo {
 	return &bookRepo{
 		db: db,
 	}
@@ -29,28 +31,38 @@ func (f *bookRepo) Create(ctx context.Context, book *models.CreateBook) (string,
 		query string
 	)
 
+	err := storage.CheckPrice(book.Price)
+	if err != nil {
+		return "", err
+	}
+
 	query = `
 		INSERT INTO book(
 			book_id,
 			name, 
 			author_name,
 			price,
+			currency,
 			date,
-			created_at,
+			stock,
+			low_stock_threshold,
 			updated_at
-		) VALUES ( $1, $2 , $3, $4, $5, now())
+		) VALUES ( $1, $2 , $3, $4, $5, $6, $7, $8, now())
 	`
 
-	_, err := f.db.Exec(ctx, query,
+	_, err = f.db.Exec(ctx, query,
 		id,
 		book.Name,
 		book.AuthorName,
-		book.Price,
+		book.Price.Amount,
+		book.Price.Currency,
 		book.Date,
+		book.Stock,
+		book.LowStockThreshold,
 	)
 
 	if err != nil {
-		return "", err
+		return "", translateError(err)
 	}
 
 	return id, nil
@@ -62,10 +74,15 @@ func (f *bookRepo) GetByPKey(ctx context.Context, pkey *models.BookPrimarKey) (*
 		id         sql.NullString
 		name       sql.NullString
 		authorName sql.NullString
-		price      sql.NullString
+		price      sql.NullInt64
+		currency   sql.NullString
 		date       sql.NullString
+		stock      sql.NullInt32
+		threshold  sql.NullInt32
 		createdAt  sql.NullString
 		updatedAt  sql.NullString
+		version    sql.NullInt32
+		deletedAt  sql.NullString
 	)
 
 	query := `
@@ -74,34 +91,54 @@ func (f *bookRepo) GetByPKey(ctx context.Context, pkey *models.BookPrimarKey) (*
 			name, 
 			author_name,
 			price,
+			currency,
 			date,
+			stock,
+			low_stock_threshold,
 			created_at,
-			updated_at
+			updated_at,
+			version,
+			deleted_at
 		FROM
 			book
 		WHERE book_id = $1
 	`
 
+	if !pkey.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+
 	err := f.db.QueryRow(ctx, query, pkey.Id).
 		Scan(
 			&id,
 			&name,
 			&authorName,
 			&price,
+			&currency,
 			&date,
+			&stock,
+			&threshold,
+			&createdAt,
+			&updatedAt,
+			&version,
+			&deletedAt,
 		)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return &models.Book{
-		Id:         id.String,
-		Name:       name.String,
-		AuthorName: authorName.String,
-		Price:      price.String,
-		Date:       date.String,
-		CreatedAt:  createdAt.String,
-		UpdatedAt:  updatedAt.String,
+		Id:                id.String,
+		Name:              name.String,
+		AuthorName:        authorName.String,
+		Price:             models.Money{Amount: price.Int64, Currency: currency.String},
+		Date:              date.String,
+		Stock:             stock.Int32,
+		LowStockThreshold: threshold.Int32,
+		CreatedAt:         createdAt.String,
+		UpdatedAt:         updatedAt.String,
+		Version:           version.Int32,
+		DeletedAt:         deletedAt.String,
 	}, nil
 }
 
@@ -109,35 +146,102 @@ func (f *bookRepo) GetList(ctx context.Context, req *models.GetListBookRequest)
 
 	var (
 		resp   = models.GetListBookResponse{}
+		filter = &filter{}
 		offset = " OFFSET 0"
-		limit  = " LIMIT 10"
+		limit  = int32(10)
+		total  int32
 	)
 
+	if !req.IncludeDeleted {
+		filter.add("deleted_at IS NULL")
+	}
+
+	filter.search(req.Search, "name", "author_name")
+
+	if req.AuthorName != "" {
+		filter.add("author_name ILIKE ?", escapeLike(req.AuthorName))
+	}
+
+	if req.Currency != "" {
+		filter.add("currency = ?", req.Currency)
+	}
+
+	if req.PriceMin != nil {
+		filter.add("price >= ?", *req.PriceMin)
+	}
+
+	if req.PriceMax != nil {
+		filter.add("price <= ?", *req.PriceMax)
+	}
+
+	if req.LowStock {
+		filter.add("stock <= low_stock_threshold")
+	}
+
+	filter.createdBetween(req.CreatedFrom, req.CreatedTo)
+
+	order, err := orderBy(req.Sort, bookSortColumns, "book_id")
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkCursor(req.After, req.Sort)
+	if err != nil {
+		return nil, err
+	}
+
 	if req.Limit > 0 {
-		limit = fmt.Sprintf(" LIMIT %d", req.Limit)
+		limit = req.Limit
 	}
 
 	if req.Offset > 0 {
 		offset = fmt.Sprintf(" OFFSET %d", req.Offset)
 	}
 
+	totalColumn := countOver
+
+	if req.After == nil {
+		resp.Count = &total
+	} else {
+		totalColumn = "0"
+
+		if req.WithCount {
+			count, err := filter.count(ctx, f.db, "book")
+			if err != nil {
+				return nil, err
+			}
+			resp.Count = &count
+		}
+
+		filter.after(req.After, "book_id")
+	}
+
 	query := `
 		SELECT
-			COUNT(*) OVER(),
+			` + totalColumn + `,
 			book_id,
 			name, 
 			author_name,
 			price,
+			currency,
 			date,
+			stock,
+			low_stock_threshold,
 			created_at,
-			updated_at
+			updated_at,
+			version,
+			deleted_at
 		FROM
 			book
 	`
 
-	query += offset + limit
+	query += filter.where() + order + offset + pageLimit(limit)
 
-	rows, err := f.db.Query(ctx, query)
+	rows, err := f.db.Query(ctx, query, filter.args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
 
 	for rows.Next() {
 
@@ -145,40 +249,63 @@ func (f *bookRepo) GetList(ctx context.Context, req *models.GetListBookRequest)
 			id         sql.NullString
 			name       sql.NullString
 			authorName sql.NullString
-			price      sql.NullString
+			price      sql.NullInt64
+			currency   sql.NullString
 			date       sql.NullString
+			stock      sql.NullInt32
+			threshold  sql.NullInt32
 			createdAt  sql.NullString
 			updatedAt  sql.NullString
+			version    sql.NullInt32
+			deletedAt  sql.NullString
 		)
 
 		err := rows.Scan(
-			&resp.Count,
+			&total,
 			&id,
 			&name,
 			&authorName,
 			&price,
+			&currency,
 			&date,
+			&stock,
+			&threshold,
 			&createdAt,
 			&updatedAt,
+			&version,
+			&deletedAt,
 		)
 
 		if err != nil {
-			return nil, err
+			return nil, translateError(err)
 		}
 
 		resp.Books = append(resp.Books, &models.Book{
-			Id:         id.String,
-			Name:       name.String,
-			AuthorName: authorName.String,
-			Price:      price.String,
-			Date:       date.String,
-			CreatedAt:  createdAt.String,
-			UpdatedAt:  updatedAt.String,
+			Id:                id.String,
+			Name:              name.String,
+			AuthorName:        authorName.String,
+			Price:             models.Money{Amount: price.Int64, Currency: currency.String},
+			Date:              date.String,
+			Stock:             stock.Int32,
+			LowStockThreshold: threshold.Int32,
+			CreatedAt:         createdAt.String,
+			UpdatedAt:         updatedAt.String,
+			Version:           version.Int32,
+			DeletedAt:         deletedAt.String,
 		})
 
 	}
 
-	return &resp, err
+	if len(resp.Books) > int(limit) {
+		resp.Books = resp.Books[:limit]
+
+		if models.KeysetSorted(req.Sort) {
+			last := resp.Books[limit-1]
+			resp.Next = &models.Cursor{CreatedAt: last.CreatedAt, Id: last.Id}
+		}
+	}
+
+	return &resp, rows.Err()
 }
 
 func (f *bookRepo) Update(ctx context.Context, req *models.UpdateBook) (int64, error) {
@@ -188,6 +315,11 @@ func (f *bookRepo) Update(ctx context.Context, req *models.UpdateBook) (int64, e
 		params map[string]interface{}
 	)
 
+	err := storage.CheckPrice(req.Price)
+	if err != nil {
+		return 0, err
+	}
+
 	query = `
 			UPDATE
 				book
@@ -195,35 +327,275 @@ func (f *bookRepo) Update(ctx context.Context, req *models.UpdateBook) (int64, e
 				name = :name,
 				author_name = :author_name,
 				price = :price,
-				date = date, 
-				updated_at = now()
-			WHERE book_id = :book_id
+				currency = :currency,
+				date = :date,
+				stock = :stock,
+				low_stock_threshold = :low_stock_threshold,
+				updated_at = now(),
+				version = version + 1
+			WHERE book_id = :book_id AND deleted_at IS NULL
 		`
 
 	params = map[string]interface{}{
-		"book_id":     req.Id,
-		"name":        req.Name,
-		"author_name": req.AuthorName,
-		"price":       req.Price,
-		"date":        req.Date,
+		"book_id":             req.Id,
+		"name":                req.Name,
+		"author_name":         req.AuthorName,
+		"price":               req.Price.Amount,
+		"currency":            req.Price.Currency,
+		"date":                req.Date,
+		"stock":               req.Stock,
+		"low_stock_threshold": req.LowStockThreshold,
 	}
 
-	query, args := helper.ReplaceQueryParams(query, params)
+	query += versionCheck(params, req.Version)
 
-	rowsAffected, err := f.db.Exec(ctx, query, args...)
+	query, args, err := helper.BindNamed(query, params)
 	if err != nil {
 		return 0, err
 	}
 
+	rowsAffected, err := f.db.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	if rowsAffected.RowsAffected() == 0 && req.Version != 0 {
+		err = missingOrStale(ctx, f.db, "book", "book_id", req.Id)
+		if !errors.Is(err, storage.ErrNotFound) {
+			return 0, err
+		}
+	}
+
 	return rowsAffected.RowsAffected(), nil
 }
 
+func (f *bookRepo) Patch(ctx context.Context, req *models.PatchBook) (*models.Book, error) {
+
+	var (
+		params     = map[string]interface{}{"book_id": req.Id}
+		id         sql.NullString
+		name       sql.NullString
+		authorName sql.NullString
+		price      sql.NullInt64
+		currency   sql.NullString
+		date       sql.NullString
+		stock      sql.NullInt32
+		threshold  sql.NullInt32
+		createdAt  sql.NullString
+		updatedAt  sql.NullString
+		version    sql.NullInt32
+		deletedAt  sql.NullString
+	)
+
+	if req.Price != nil {
+		err := storage.CheckPrice(*req.Price)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	priceAmount, priceCurrency := formatMoney(req.Price)
+
+	set := setColumns(params,
+		patchColumn{"name", req.Name},
+		patchColumn{"author_name", req.AuthorName},
+		patchColumn{"price", priceAmount},
+		patchColumn{"currency", priceCurrency},
+		patchColumn{"date", req.Date},
+		patchColumn{"stock", formatInt32(req.Stock)},
+		patchColumn{"low_stock_threshold", formatInt32(req.LowStockThreshold)},
+	)
+
+	if set == "" {
+		book, err := f.GetByPKey(ctx, &models.BookPrimarKey{Id: req.Id})
+		if err == nil && req.Version != 0 && book.Version != req.Version {
+			return nil, storage.ErrVersionMismatch
+		}
+
+		return book, err
+	}
+
+	query := `
+		UPDATE
+			book
+		SET ` + set + `
+		WHERE book_id = :book_id AND deleted_at IS NULL` + versionCheck(params, req.Version) + `
+		RETURNING
+			book_id,
+			name,
+			author_name,
+			price,
+			currency,
+			date,
+			stock,
+			low_stock_threshold,
+			created_at,
+			updated_at,
+			version,
+			deleted_at
+	`
+
+	query, args, err := helper.BindNamed(query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err = translateError(f.db.QueryRow(ctx, query, args...).
+		Scan(
+			&id,
+			&name,
+			&authorName,
+			&price,
+			&currency,
+			&date,
+			&stock,
+			&threshold,
+			&createdAt,
+			&updatedAt,
+			&version,
+			&deletedAt,
+		))
+	if errors.Is(err, storage.ErrNotFound) && req.Version != 0 {
+		return nil, missingOrStale(ctx, f.db, "book", "book_id", req.Id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Book{
+		Id:                id.String,
+		Name:              name.String,
+		AuthorName:        authorName.String,
+		Price:             models.Money{Amount: price.Int64, Currency: currency.String},
+		Date:              date.String,
+		Stock:             stock.Int32,
+		LowStockThreshold: threshold.Int32,
+		CreatedAt:         createdAt.String,
+		UpdatedAt:         updatedAt.String,
+		Version:           version.Int32,
+		DeletedAt:         deletedAt.String,
+	}, nil
+}
+
 func (f *bookRepo) Delete(ctx context.Context, req *models.BookPrimarKey) error {
 
-	_, err := f.db.Exec(ctx, "DELETE FROM book WHERE book_id = $1", req.Id)
+	params := map[string]interface{}{"book_id": req.Id}
+
+	query := `
+		UPDATE
+			book
+		SET
+			deleted_at = now(),
+			version = version + 1
+		WHERE book_id = :book_id AND deleted_at IS NULL`
+
+	query, args, err := helper.BindNamed(query+versionCheck(params, req.Version), params)
 	if err != nil {
 		return err
 	}
 
-	return err
+	result, err := f.db.Exec(ctx, query, args...)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return missingOrStale(ctx, f.db, "book", "book_id", req.Id)
+	}
+
+	return nil
+}
+
+func (f *bookRepo) Restore(ctx context.Context, req *models.BookPrimarKey) (*models.Book, error) {
+
+	var (
+		id         sql.NullString
+		name       sql.NullString
+		authorName sql.NullString
+		price      sql.NullInt64
+		currency   sql.NullString
+		date       sql.NullString
+		stock      sql.NullInt32
+		threshold  sql.NullInt32
+		createdAt  sql.NullString
+		updatedAt  sql.NullString
+		version    sql.NullInt32
+	)
+
+	query := `
+		UPDATE
+			book
+		SET
+			deleted_at = NULL,
+			updated_at = now(),
+			version = version + 1
+		WHERE book_id = $1 AND deleted_at IS NOT NULL
+		RETURNING
+			book_id,
+			name,
+			author_name,
+			price,
+			currency,
+			date,
+			stock,
+			low_stock_threshold,
+			created_at,
+			updated_at,
+			version
+	`
+
+	err := translateError(f.db.QueryRow(ctx, query, req.Id).
+		Scan(
+			&id,
+			&name,
+			&authorName,
+			&price,
+			&currency,
+			&date,
+			&stock,
+			&threshold,
+			&createdAt,
+			&updatedAt,
+			&version,
+		))
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return f.GetByPKey(ctx, &models.BookPrimarKey{Id: req.Id})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Book{
+		Id:                id.String,
+		Name:              name.String,
+		AuthorName:        authorName.String,
+		Price:             models.Money{Amount: price.Int64, Currency: currency.String},
+		Date:              date.String,
+		Stock:             stock.Int32,
+		LowStockThreshold: threshold.Int32,
+		CreatedAt:         createdAt.String,
+		UpdatedAt:         updatedAt.String,
+		Version:           version.Int32,
+	}, nil
+}
+
+// PurgeDeleted removes books deleted before deletedBefore that no order references
+func (f *bookRepo) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	query := `
+		DELETE FROM
+			book
+		WHERE deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM order_items WHERE order_items.book_id = book.book_id)
+	`
+
+	result, err := f.db.Exec(ctx, query, deletedBefore.UTC())
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	return result.RowsAffected(), nil
 }
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+
+	"crud/storage"
+)
+
+// constraintMessages are what callers see when constraint of that name is violated. Detail of postgres
+// quotes row values, so it only goes to the log
+var constraintMessages = map[string]string{
+	"users_login_key":                     "login already exists",
+	"roles_name_key":                      "role already exists",
+	"permissions_name_key":                "permission already exists",
+	"order_items_order_id_book_id_key":    "book appears in order more than once",
+	"orders_users_id_fkey":                "user does not exist or still has orders",
+	"order_items_book_id_fkey":            "book does not exist or is still ordered",
+	"user_roles_role_id_fkey":             "role does not exist",
+	"user_roles_user_id_fkey":             "user does not exist",
+	"role_permissions_permission_id_fkey": "permission does not exist",
+	"ledger_entries_user_id_fkey":         "user does not exist or still has ledger entries",
+	"book_price_check":                    "price must not be negative",
+	"book_stock_check":                    "not enough stock",
+	"book_low_stock_threshold_check":      "low stock threshold must not be negative",
+	"order_items_quantity_check":          "quantity must be positive",
+	"orders_status_check":                 "unknown order status",
+	"users_balance_check":                 "not enough money in wallet",
+	"book_currency_check":                 "currency must be ISO 4217 code",
+	"order_items_currency_check":          "currency must be ISO 4217 code",
+	"ledger_entries_currency_check":       "currency must be ISO 4217 code",
+}
+
+// translateError turns pgx.ErrNoRows and constraint or input errors of postgres into storage errors,
+// anything else is returned unchanged
+func translateError(err error) error {
+
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	var (
+		kind    error
+		message string
+	)
+
+	switch pgErr.Code {
+	case "23505": // unique_violation
+		kind, message = storage.ErrConflict, "already exists"
+	case "23503": // foreign_key_violation
+		kind, message = storage.ErrForeignKey, "referenced row does not exist or is still referenced"
+	case "22P02": // invalid_text_representation
+		kind, message = storage.ErrInvalidInput, "invalid value"
+	case "22003": // numeric_value_out_of_range
+		kind, message = storage.ErrInvalidInput, "number out of range"
+	case "22001": // string_data_right_truncation
+		kind, message = storage.ErrInvalidInput, "value too long"
+	case "22007", // invalid_datetime_format
+		"22008": // datetime_field_overflow
+		kind, message = storage.ErrInvalidInput, "invalid date"
+	case "23502": // not_null_violation
+		kind, message = storage.ErrInvalidInput, pgErr.ColumnName+" is required"
+	case "23514": // check_violation
+		kind, message = storage.ErrInvalidInput, "value violates check"
+	default:
+		return err
+	}
+
+	if fixed, ok := constraintMessages[pgErr.ConstraintName]; ok {
+		message = fixed
+	}
+
+	log.Printf("error whiling query: %s: %s\n", pgErr.Message, pgErr.Detail)
+
+	return fmt.Errorf("%w: %s", kind, message)
+}
@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"crud/models"
+	"crud/storage"
+)
+
+var (
+	bookSortColumns = map[string]string{
+		"name":        "name",
+		"author_name": "author_name",
+		"price":       "price",
+		"date":        "date",
+		"stock":       "stock",
+		"created_at":  "created_at",
+		"updated_at":  "updated_at",
+	}
+
+	userSortColumns = map[string]string{
+		"first_name": "first_name",
+		"last_name":  "last_name",
+		"login":      "login",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	}
+
+	orderSortColumns = map[string]string{
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	}
+)
+
+// filter collects WHERE conditions. Values only ever travel as arguments, conditions hold "?" which
+// become numbered placeholders, and column names come from code or whitelists, never from requests
+type filter struct {
+	conds []string
+	args  []interface{}
+}
+
+func (f *filter) add(cond string, args ...interface{}) {
+
+	for _, arg := range args {
+		f.args = append(f.args, arg)
+		cond = strings.Replace(cond, "?", "$"+strconv.Itoa(len(f.args)), 1)
+	}
+
+	f.conds = append(f.conds, cond)
+}
+
+// search matches part of any of columns, case insensitive
+func (f *filter) search(q string, columns ...string) {
+
+	if q == "" {
+		return
+	}
+
+	f.args = append(f.args, "%"+escapeLike(q)+"%")
+
+	var (
+		placeholder = "$" + strconv.Itoa(len(f.args))
+		conds       = make([]string, len(columns))
+	)
+
+	for i, column := range columns {
+		conds[i] = column + " ILIKE " + placeholder
+	}
+
+	f.conds = append(f.conds, "("+strings.Join(conds, " OR ")+")")
+}
+
+// createdBetween keeps rows created at from or later and before to, zero times are ignored
+func (f *filter) createdBetween(from, to time.Time) {
+
+	if !from.IsZero() {
+		f.add("created_at >= ?", from.UTC())
+	}
+
+	if !to.IsZero() {
+		f.add("created_at < ?", to.UTC())
+	}
+}
+
+// after keeps rows that come after cursor in (created_at, id) order, nil cursor keeps all
+func (f *filter) after(cursor *models.Cursor, idColumn string) {
+
+	if cursor != nil {
+		f.add("(created_at, "+idColumn+") > (?::timestamp, ?::uuid)", cursor.CreatedAt, cursor.Id)
+	}
+}
+
+// countOver is total column of offset pages. It reads every matching row, so cursor pages select 0 instead
+// and count with filter.count only on request
+const countOver = "COUNT(*) OVER()"
+
+// pageLimit is LIMIT of list query, one row past limit tells whether next page exists
+func pageLimit(limit int32) string {
+	return fmt.Sprintf(" LIMIT %d", limit+1)
+}
+
+// count counts rows of table matching filter
+func (f *filter) count(ctx context.Context, db querier, table string) (int32, error) {
+
+	var count int32
+
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM "+table+f.where(), f.args...).Scan(&count)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	return count, nil
+}
+
+func (f *filter) where() string {
+
+	if len(f.conds) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(f.conds, " AND ")
+}
+
+// orderBy builds ORDER BY from whitelisted columns, id column breaks ties so pages are stable.
+// Without sort rows come oldest first
+func orderBy(sort []models.SortField, columns map[string]string, idColumn string) (string, error) {
+
+	if len(sort) == 0 {
+		sort = []models.SortField{{Field: "created_at"}}
+	}
+
+	var terms []string
+
+	for _, field := range sort {
+		column, ok := columns[field.Field]
+		if !ok {
+			return "", fmt.Errorf("%w: cannot sort by %q", storage.ErrInvalidInput, field.Field)
+		}
+
+		if field.Desc {
+			column += " DESC"
+		}
+
+		terms = append(terms, column)
+	}
+
+	return " ORDER BY " + strings.Join(append(terms, idColumn), ", "), nil
+}
+
+// checkCursor rejects cursor together with sort other than (created_at, id) order
+func checkCursor(cursor *models.Cursor, sort []models.SortField) error {
+
+	if cursor != nil && !models.KeysetSorted(sort) {
+		return fmt.Errorf("%w: cursor pages cannot be sorted", storage.ErrInvalidInput)
+	}
+
+	return nil
+}
+
+// escapeLike makes % and _ of user input match literally in LIKE patterns
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
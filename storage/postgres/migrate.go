@@ -0,0 +1,329 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// migrationLockKey is pg_advisory_lock key held while migrating so replicas starting together wait for each other
+const migrationLockKey = 727_001
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+// NewMigrator reads <version>_<name>.up.sql and <version>_<name>.down.sql files from root of files
+func NewMigrator(db *pgxpool.Pool, files fs.FS) (*Migrator, error) {
+
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+
+	for _, name := range names {
+		var (
+			base      = path.Base(name)
+			direction string
+		)
+
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction, base = "up", strings.TrimSuffix(base, ".up.sql")
+		case strings.HasSuffix(base, ".down.sql"):
+			direction, base = "down", strings.TrimSuffix(base, ".down.sql")
+		default:
+			return nil, fmt.Errorf("migration %s: name must end with .up.sql or .down.sql", name)
+		}
+
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("migration %s: name must start with <version>_", name)
+		}
+
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", name, parts[0])
+		}
+
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+
+		if m.Name != parts[1] {
+			return nil, fmt.Errorf("migration %d has different names %q and %q", version, m.Name, parts[1])
+		}
+
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrator := &Migrator{db: db}
+
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrator.migrations = append(migrator.migrations, *m)
+	}
+
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+// Latest returns version of the newest known migration
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the last applied migration
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				return m.rollback(ctx, conn, m.migrations[i])
+			}
+		}
+
+		return nil
+	})
+}
+
+// To applies or rolls back migrations until database is at version, 0 rolls back everything
+func (m *Migrator) To(ctx context.Context, version int64) error {
+
+	if version != 0 && !m.known(version) {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; ok && migration.Version > version {
+				err = m.rollback(ctx, conn, migration)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; !ok && migration.Version <= version {
+				err = m.apply(ctx, conn, migration)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+
+	var resp []MigrationStatus
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			appliedAt, ok := applied[migration.Version]
+			resp = append(resp, MigrationStatus{
+				Migration: migration,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+
+		return nil
+	})
+
+	return resp, err
+}
+
+func (m *Migrator) known(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, migration Migration) error {
+
+	return inTx(ctx, conn, func(tx pgx.Tx) error {
+
+		_, err := tx.Exec(ctx, migration.Up)
+		if err != nil {
+			return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+		}
+
+		_, err = tx.Exec(ctx,
+			"INSERT INTO schema_versions(version, name) VALUES ($1, $2)",
+			migration.Version, migration.Name,
+		)
+		return err
+	})
+}
+
+func (m *Migrator) rollback(ctx context.Context, conn *pgxpool.Conn, migration Migration) error {
+
+	if migration.Down == "" {
+		return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+	}
+
+	return inTx(ctx, conn, func(tx pgx.Tx) error {
+
+		_, err := tx.Exec(ctx, migration.Down)
+		if err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM schema_versions WHERE version = $1", migration.Version)
+		return err
+	})
+}
+
+// withLock runs fn on single connection holding the migration advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) (err error) {
+
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_, unlockErr := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_versions (
+			version BIGINT NOT NULL PRIMARY KEY,
+			name VARCHAR NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *pgxpool.Conn) (map[int64]time.Time, error) {
+
+	applied := map[int64]time.Time{}
+
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_versions")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func inTx(ctx context.Context, conn *pgxpool.Conn, fn func(tx pgx.Tx) error) error {
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			return fmt.Errorf("%w (rollback: %v)", err, rollbackErr)
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
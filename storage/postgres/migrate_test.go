@@ -0,0 +1,208 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"crud/migrations"
+)
+
+func TestNewMigrator(t *testing.T) {
+
+	file := func(data string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(data)} }
+
+	migrator, err := NewMigrator(nil, fstest.MapFS{
+		"10_orders.up.sql":   file("up 10"),
+		"2_users.up.sql":     file("up 2"),
+		"2_users.down.sql":   file("down 2"),
+		"1_books.up.sql":     file("up 1"),
+		"1_books.down.sql":   file("down 1"),
+		"10_orders.down.sql": file("down 10"),
+	})
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+
+	// migrations are ordered by number, not by name
+	var got []string
+	for _, m := range migrator.migrations {
+		got = append(got, fmt.Sprintf("%d %s %q %q", m.Version, m.Name, m.Up, m.Down))
+	}
+
+	want := []string{`1 books "up 1" "down 1"`, `2 users "up 2" "down 2"`, `10 orders "up 10" "down 10"`}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("NewMigrator read %v, want %v", got, want)
+	}
+
+	if migrator.Latest() != 10 {
+		t.Fatalf("Latest = %d, want 10", migrator.Latest())
+	}
+
+	if err = migrator.To(context.Background(), 3); err == nil || !strings.Contains(err.Error(), "unknown migration version 3") {
+		t.Fatalf("To of unknown version returned %v", err)
+	}
+
+	for _, c := range []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"other suffix", fstest.MapFS{"1_books.sql": file("")}},
+		{"no version", fstest.MapFS{"books.up.sql": file("")}},
+		{"bad version", fstest.MapFS{"one_books.up.sql": file("")}},
+		{"zero version", fstest.MapFS{"0_books.up.sql": file("")}},
+		{"different names", fstest.MapFS{"1_books.up.sql": file("up"), "1_films.down.sql": file("down")}},
+		{"down only", fstest.MapFS{"1_books.down.sql": file("down")}},
+	} {
+		if _, err := NewMigrator(nil, c.files); err == nil {
+			t.Errorf("%s: NewMigrator succeeded, want error", c.name)
+		}
+	}
+}
+
+// TestMigrate runs against database from TEST_POSTGRES_DSN in a schema of its own, which is dropped afterwards
+func TestMigrate(t *testing.T) {
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	schema := "migrate_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+
+	admin, err := pgxpool.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	_, err = admin.Exec(ctx, "CREATE SCHEMA "+schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolConfig.ConnConfig.RuntimeParams["search_path"] = schema
+
+	pool, err := pgxpool.ConnectConfig(ctx, poolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	files, err := fs.Sub(migrations.Postgres, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(pool, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CheckSchema(ctx, pool)
+	if err == nil || !strings.Contains(err.Error(), "table book is missing") {
+		t.Fatalf("CheckSchema of empty schema returned %v", err)
+	}
+
+	// replica holding the lock makes migrate wait instead of applying same migrations twice
+	conn, err := admin.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	err = migrator.Up(waitCtx)
+	cancel()
+
+	if !errors.Is(err, context.DeadlineExceeded) && !strings.Contains(fmt.Sprint(err), "timeout") {
+		t.Fatalf("Up while lock is held returned %v, want timeout", err)
+	}
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	conn.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	err = CheckSchema(ctx, pool)
+	if err != nil {
+		t.Fatalf("CheckSchema after Up: %v", err)
+	}
+
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+
+	for _, s := range status {
+		if !s.Applied || s.AppliedAt.IsZero() {
+			t.Fatalf("Status after Up has %d_%s not applied", s.Version, s.Name)
+		}
+	}
+
+	// every down migration undoes its up, so the way back and forth ends at same schema
+	err = migrator.To(ctx, 0)
+	if err != nil {
+		t.Fatalf("To(0): %v", err)
+	}
+
+	err = CheckSchema(ctx, pool)
+	if err == nil {
+		t.Fatal("CheckSchema after To(0) succeeded, want missing tables")
+	}
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up after To(0): %v", err)
+	}
+
+	err = migrator.Down(ctx)
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+
+	if status, err = migrator.Status(ctx); err != nil || status[len(status)-1].Applied {
+		t.Fatalf("Status after Down = %+v, %v, want latest not applied", status[len(status)-1], err)
+	}
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+
+	_, err = pool.Exec(ctx, "ALTER TABLE book DROP COLUMN stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CheckSchema(ctx, pool)
+	if err == nil || !strings.Contains(err.Error(), "column book.stock is missing") {
+		t.Fatalf("CheckSchema without book.stock returned %v", err)
+	}
+}
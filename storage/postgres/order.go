@@ -3,20 +3,23 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v4/pgxpool"
 
 	"crud/models"
 	"crud/pkg/helper"
+	"crud/storage"
 )
 
 type orderRepo struct {
-	db *pgxpool.Pool
+	db querier
 }
 
-func NewOrderRepo(db *pgxpool.Pool) *orderRepo {
+func NewOrderRepo(db querier) *orderRepo {
 	return &orderRepo{
 		db: db,
 	}
@@ -24,26 +27,91 @@ func NewOrderRepo(db *pgxpool.Pool) *orderRepo {
 
 func (f *orderRepo) Create(ctx context.Context, order *models.CreateOrder) (string, error) {
 
-	var (
-		id    = uuid.New().String()
-		query string
-	)
+	id := uuid.New().String()
 
-	query = `
-		INSERT INTO orders(
-			order_id,
-			book_id, 
-			user_id, 
-			updated_at
-		) VALUES ( $1, $2 , $3, now())
-	`
+	items, err := storage.OrderItems(order)
+	if err != nil {
+		return "", err
+	}
 
-	_, err := f.db.Exec(ctx, query,
-		id,
-		order.BookId,
-		order.UserId,
-	)
+	// order and its items are written together
+	err = atomic(ctx, f.db, func(tx querier) error {
+
+		err := checkLive(ctx, tx, "users", "user_id", order.UserId)
+		if err != nil {
+			return err
+		}
 
+		query := `
+			INSERT INTO orders(
+				order_id,
+				user_id, 
+				reserved_until,
+				stock_reserved,
+				updated_at
+			) VALUES ( $1, $2, $3, true, now())
+		`
+
+		_, err = tx.Exec(ctx, query,
+			id,
+			order.UserId,
+			sql.NullTime{Time: order.ReservedUntil.UTC(), Valid: !order.ReservedUntil.IsZero()},
+		)
+
+		if err != nil {
+			return translateError(err)
+		}
+
+		// books are locked in one order so concurrent orders of the same books cannot deadlock
+		reserve := append([]*models.CreateOrderItem(nil), items...)
+		sort.Slice(reserve, func(i, j int) bool { return reserve[i].BookId < reserve[j].BookId })
+
+		for _, item := range reserve {
+			err = reserveStock(ctx, tx, item.BookId, item.Quantity)
+			if err != nil {
+				return err
+			}
+		}
+
+		// unit price is copied from book, later price changes leave the order alone
+		query = `
+			INSERT INTO order_items(
+				order_id,
+				line,
+				book_id,
+				quantity,
+				unit_price,
+				currency
+			)
+			SELECT $1, $2, book_id, $4, price, currency
+			FROM book
+			WHERE book_id = $3 AND deleted_at IS NULL
+		`
+
+		for i, item := range items {
+			result, err := tx.Exec(ctx, query, id, i+1, item.BookId, item.Quantity)
+			if err != nil {
+				return translateError(err)
+			}
+
+			if result.RowsAffected() == 0 {
+				return fmt.Errorf("%w: book_id %s does not exist", storage.ErrForeignKey, item.BookId)
+			}
+		}
+
+		var currencies int
+
+		err = tx.QueryRow(ctx, "SELECT COUNT(DISTINCT currency) FROM order_items WHERE order_id = $1", id).Scan(&currencies)
+		if err != nil {
+			return translateError(err)
+		}
+
+		if currencies > 1 {
+			return fmt.Errorf("%w: books of order are priced in different currencies", storage.ErrInvalidInput)
+		}
+
+		return recordStatus(ctx, tx, id, "", models.OrderPending, order.CreatedBy)
+	})
 	if err != nil {
 		return "", err
 	}
@@ -54,111 +122,222 @@ func (f *orderRepo) Create(ctx context.Context, order *models.CreateOrder) (stri
 func (f *orderRepo) GetByPKey(ctx context.Context, pkey *models.OrderPrimarKey) (*models.Order, error) {
 
 	var (
-		id        sql.NullString
-		bookId    sql.NullString
-		userId    sql.NullString
-		createdAt sql.NullString
-		updatedAt sql.NullString
+		id            sql.NullString
+		userId        sql.NullString
+		status        sql.NullString
+		reservedUntil sql.NullString
+		createdAt     sql.NullString
+		updatedAt     sql.NullString
+		version       sql.NullInt32
+		deletedAt     sql.NullString
 	)
 
 	query := `
 		SELECT
 			order_id,
-			book_id,
 			user_id, 
+			status,
+			reserved_until,
 			created_at,
-			updated_at
+			updated_at,
+			version,
+			deleted_at
 		FROM
 			orders
 		WHERE order_id = $1
 	`
 
+	if !pkey.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+
 	err := f.db.QueryRow(ctx, query, pkey.Id).
 		Scan(
 			&id,
-			&bookId,
 			&userId,
+			&status,
+			&reservedUntil,
+			&createdAt,
+			&updatedAt,
+			&version,
+			&deletedAt,
 		)
 
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	resp := &models.Order{
+		Id:            id.String,
+		UserId:        userId.String,
+		Status:        status.String,
+		ReservedUntil: reservedUntil.String,
+		CreatedAt:     createdAt.String,
+		UpdatedAt:     updatedAt.String,
+		Version:       version.Int32,
+		DeletedAt:     deletedAt.String,
+	}
+
+	err = f.loadItems(ctx, resp)
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.Order{
-		Id:        id.String,
-		BookId:    bookId.String,
-		UserId:    userId.String,
-		CreatedAt: createdAt.String,
-		UpdatedAt: updatedAt.String,
-	}, nil
+	return resp, nil
 }
 
 func (f *orderRepo) GetList(ctx context.Context, req *models.GetListOrderRequest) (*models.GetListOrderResponse, error) {
 
 	var (
 		resp   = models.GetListOrderResponse{}
+		filter = &filter{}
 		offset = " OFFSET 0"
-		limit  = " LIMIT 10"
+		limit  = int32(10)
+		total  int32
 	)
 
+	if !req.IncludeDeleted {
+		filter.add("deleted_at IS NULL")
+	}
+
+	if req.BookId != "" {
+		filter.add("EXISTS (SELECT 1 FROM order_items WHERE order_items.order_id = orders.order_id AND order_items.book_id = ?)", req.BookId)
+	}
+
+	if req.UserId != "" {
+		filter.add("user_id = ?", req.UserId)
+	}
+
+	if req.Status != "" {
+		filter.add("status = ?", req.Status)
+	}
+
+	filter.createdBetween(req.CreatedFrom, req.CreatedTo)
+
+	order, err := orderBy(req.Sort, orderSortColumns, "order_id")
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkCursor(req.After, req.Sort)
+	if err != nil {
+		return nil, err
+	}
+
 	if req.Limit > 0 {
-		limit = fmt.Sprintf(" LIMIT %d", req.Limit)
+		limit = req.Limit
 	}
 
 	if req.Offset > 0 {
 		offset = fmt.Sprintf(" OFFSET %d", req.Offset)
 	}
 
+	totalColumn := countOver
+
+	if req.After == nil {
+		resp.Count = &total
+	} else {
+		totalColumn = "0"
+
+		if req.WithCount {
+			count, err := filter.count(ctx, f.db, "orders")
+			if err != nil {
+				return nil, err
+			}
+			resp.Count = &count
+		}
+
+		filter.after(req.After, "order_id")
+	}
+
 	query := `
 		SELECT
-			COUNT(*) OVER(),
+			` + totalColumn + `,
 			order_id,
-			book_id,
 			user_id, 
+			status,
+			reserved_until,
 			created_at,
-			updated_at
+			updated_at,
+			version,
+			deleted_at
 		FROM
 			orders
 	`
 
-	query += offset + limit
+	query += filter.where() + order + offset + pageLimit(limit)
 
-	rows, err := f.db.Query(ctx, query)
+	rows, err := f.db.Query(ctx, query, filter.args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
 
 	for rows.Next() {
 
 		var (
-			id        sql.NullString
-			bookId    sql.NullString
-			userId    sql.NullString
-			createdAt sql.NullString
-			updatedAt sql.NullString
+			id            sql.NullString
+			userId        sql.NullString
+			status        sql.NullString
+			reservedUntil sql.NullString
+			createdAt     sql.NullString
+			updatedAt     sql.NullString
+			version       sql.NullInt32
+			deletedAt     sql.NullString
 		)
 
 		err := rows.Scan(
-			&resp.Count,
+			&total,
 			&id,
-			&bookId,
 			&userId,
+			&status,
+			&reservedUntil,
 			&createdAt,
 			&updatedAt,
+			&version,
+			&deletedAt,
 		)
 
 		if err != nil {
-			return nil, err
+			return nil, translateError(err)
 		}
 
 		resp.Orders = append(resp.Orders, &models.Order{
-			Id:        id.String,
-			BookId:    bookId.String,
-			UserId:    userId.String,
-			CreatedAt: createdAt.String,
-			UpdatedAt: updatedAt.String,
+			Id:            id.String,
+			UserId:        userId.String,
+			Status:        status.String,
+			ReservedUntil: reservedUntil.String,
+			CreatedAt:     createdAt.String,
+			UpdatedAt:     updatedAt.String,
+			Version:       version.Int32,
+			DeletedAt:     deletedAt.String,
 		})
 
 	}
 
-	return &resp, err
+	err = rows.Err()
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	// connection of tx serves one query at a time
+	rows.Close()
+
+	if len(resp.Orders) > int(limit) {
+		resp.Orders = resp.Orders[:limit]
+
+		if models.KeysetSorted(req.Sort) {
+			last := resp.Orders[limit-1]
+			resp.Next = &models.Cursor{CreatedAt: last.CreatedAt, Id: last.Id}
+		}
+	}
+
+	err = f.loadItems(ctx, resp.Orders...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
 }
 
 func (f *orderRepo) Update(ctx context.Context, req *models.UpdateOrder) (int64, error) {
@@ -172,34 +351,679 @@ func (f *orderRepo) Update(ctx context.Context, req *models.UpdateOrder) (int64,
 		UPDATE
 			orders
 		SET
-			book_id = :book_id,
 			user_id = :user_id, 
-			updated_at = now()
-		WHERE order_id = :order_id
+			updated_at = now(),
+			version = version + 1
+		WHERE order_id = :order_id AND deleted_at IS NULL AND status = 'pending'
 	`
 
 	params = map[string]interface{}{
 		"order_id": req.Id,
-		"book_id":  req.BookId,
 		"user_id":  req.UserId,
 	}
 
-	query, args := helper.ReplaceQueryParams(query, params)
+	query += versionCheck(params, req.Version)
 
-	rowsAffected, err := f.db.Exec(ctx, query, args...)
+	err := checkLive(ctx, f.db, "users", "user_id", req.UserId)
 	if err != nil {
 		return 0, err
 	}
 
+	query, args, err := helper.BindNamed(query, params)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := f.db.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	if rowsAffected.RowsAffected() == 0 {
+		err = f.unchanged(ctx, req.Id, req.Version)
+		if !errors.Is(err, storage.ErrNotFound) {
+			return 0, err
+		}
+	}
+
 	return rowsAffected.RowsAffected(), nil
 }
 
+func (f *orderRepo) Patch(ctx context.Context, req *models.PatchOrder) (*models.Order, error) {
+
+	var (
+		params        = map[string]interface{}{"order_id": req.Id}
+		id            sql.NullString
+		userId        sql.NullString
+		status        sql.NullString
+		reservedUntil sql.NullString
+		createdAt     sql.NullString
+		updatedAt     sql.NullString
+		version       sql.NullInt32
+		deletedAt     sql.NullString
+	)
+
+	set := setColumns(params,
+		patchColumn{"user_id", req.UserId},
+	)
+
+	if set == "" {
+		order, err := f.GetByPKey(ctx, &models.OrderPrimarKey{Id: req.Id})
+		if err == nil && req.Version != 0 && order.Version != req.Version {
+			return nil, storage.ErrVersionMismatch
+		}
+
+		return order, err
+	}
+
+	err := checkLive(ctx, f.db, "users", "user_id", *req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE
+			orders
+		SET ` + set + `
+		WHERE order_id = :order_id AND deleted_at IS NULL AND status = 'pending'` + versionCheck(params, req.Version) + `
+		RETURNING
+			order_id,
+			user_id,
+			status,
+			reserved_until,
+			created_at,
+			updated_at,
+			version,
+			deleted_at
+	`
+
+	query, args, err := helper.BindNamed(query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err = translateError(f.db.QueryRow(ctx, query, args...).
+		Scan(
+			&id,
+			&userId,
+			&status,
+			&reservedUntil,
+			&createdAt,
+			&updatedAt,
+			&version,
+			&deletedAt,
+		))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, f.unchanged(ctx, req.Id, req.Version)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.Order{
+		Id:            id.String,
+		UserId:        userId.String,
+		Status:        status.String,
+		ReservedUntil: reservedUntil.String,
+		CreatedAt:     createdAt.String,
+		UpdatedAt:     updatedAt.String,
+		Version:       version.Int32,
+		DeletedAt:     deletedAt.String,
+	}
+
+	err = f.loadItems(ctx, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
 func (f *orderRepo) Delete(ctx context.Context, req *models.OrderPrimarKey) error {
 
-	_, err := f.db.Exec(ctx, "DELETE FROM orders WHERE order_id = $1", req.Id)
+	params := map[string]interface{}{"order_id": req.Id}
+
+	query := `
+		UPDATE
+			orders
+		SET
+			deleted_at = now(),
+			version = version + 1
+		WHERE order_id = :order_id AND deleted_at IS NULL`
+
+	query, args, err := helper.BindNamed(query+versionCheck(params, req.Version), params)
 	if err != nil {
 		return err
 	}
 
-	return err
+	result, err := f.db.Exec(ctx, query, args...)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return missingOrStale(ctx, f.db, "orders", "order_id", req.Id)
+	}
+
+	return nil
+}
+
+func (f *orderRepo) Restore(ctx context.Context, req *models.OrderPrimarKey) (*models.Order, error) {
+
+	var (
+		id            sql.NullString
+		userId        sql.NullString
+		status        sql.NullString
+		reservedUntil sql.NullString
+		createdAt     sql.NullString
+		updatedAt     sql.NullString
+		version       sql.NullInt32
+	)
+
+	order, err := f.GetByPKey(ctx, &models.OrderPrimarKey{Id: req.Id, IncludeDeleted: true})
+	if err != nil {
+		return nil, err
+	}
+
+	if order.DeletedAt == "" {
+		return order, nil
+	}
+
+	// order comes back only together with its user and books
+	err = checkOrderReferences(ctx, f.db, order)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE
+			orders
+		SET
+			deleted_at = NULL,
+			updated_at = now(),
+			version = version + 1
+		WHERE order_id = $1 AND deleted_at IS NOT NULL
+		RETURNING
+			order_id,
+			user_id,
+			status,
+			reserved_until,
+			created_at,
+			updated_at,
+			version
+	`
+
+	err = translateError(f.db.QueryRow(ctx, query, req.Id).
+		Scan(
+			&id,
+			&userId,
+			&status,
+			&reservedUntil,
+			&createdAt,
+			&updatedAt,
+			&version,
+		))
+
+	// restored meanwhile by someone else
+	if errors.Is(err, storage.ErrNotFound) {
+		return f.GetByPKey(ctx, &models.OrderPrimarKey{Id: req.Id})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.Order{
+		Id:            id.String,
+		UserId:        userId.String,
+		Status:        status.String,
+		ReservedUntil: reservedUntil.String,
+		CreatedAt:     createdAt.String,
+		UpdatedAt:     updatedAt.String,
+		Version:       version.Int32,
+	}
+
+	err = f.loadItems(ctx, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// PurgeDeleted removes orders deleted before deletedBefore, stock still held by pending ones goes back
+func (f *orderRepo) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	var purged int64
+
+	// every part of the statement sees items as they were before the delete cascaded to them
+	query := `
+		WITH purged AS (
+			DELETE FROM orders WHERE deleted_at < $1 RETURNING order_id, status, stock_reserved
+		), released AS (
+			UPDATE
+				book
+			SET
+				stock = book.stock + held.quantity,
+				version = book.version + 1
+			FROM (
+				SELECT order_items.book_id, SUM(order_items.quantity) AS quantity
+				FROM order_items JOIN purged ON purged.order_id = order_items.order_id
+				WHERE purged.status = 'pending' AND purged.stock_reserved
+				GROUP BY order_items.book_id
+			) held
+			WHERE book.book_id = held.book_id
+		)
+		SELECT COUNT(*) FROM purged
+	`
+
+	err := f.db.QueryRow(ctx, query, deletedBefore.UTC()).Scan(&purged)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	return purged, nil
+}
+
+// ExpireReservations cancels pending orders reserved until before expiredBefore and gives their stock back.
+// Deleted orders expire too, their stock is held until then like for live ones
+func (f *orderRepo) ExpireReservations(ctx context.Context, expiredBefore time.Time) (int64, error) {
+
+	var ids []string
+
+	err := atomic(ctx, f.db, func(tx querier) error {
+
+		// orders locked by running transitions are left for the next run
+		query := `
+			SELECT
+				order_id
+			FROM
+				orders
+			WHERE status = 'pending' AND reserved_until < $1
+			FOR UPDATE SKIP LOCKED
+		`
+
+		rows, err := tx.Query(ctx, query, expiredBefore.UTC())
+		if err != nil {
+			return translateError(err)
+		}
+
+		for rows.Next() {
+			var id string
+
+			err = rows.Scan(&id)
+			if err != nil {
+				rows.Close()
+				return translateError(err)
+			}
+
+			ids = append(ids, id)
+		}
+
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return translateError(err)
+		}
+
+		query = `
+			UPDATE
+				orders
+			SET
+				status = 'cancelled',
+				reserved_until = NULL,
+				updated_at = now(),
+				version = version + 1
+			WHERE order_id = $1
+		`
+
+		for _, id := range ids {
+			_, err = tx.Exec(ctx, query, id)
+			if err != nil {
+				return translateError(err)
+			}
+
+			err = releaseStock(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+
+			err = recordStatus(ctx, tx, id, models.OrderPending, models.OrderCancelled, "")
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(ids)), nil
+}
+
+// Transition moves live order to next status of its state machine and records it in history.
+// Status the order cannot move to from where it is is ErrConflict
+func (f *orderRepo) Transition(ctx context.Context, req *models.OrderTransition) (*models.Order, error) {
+
+	var (
+		status  string
+		version int32
+		userId  string
+	)
+
+	if !models.ValidOrderStatus(req.Status) {
+		return nil, fmt.Errorf("%w: unknown status %q", storage.ErrInvalidInput, req.Status)
+	}
+
+	err := atomic(ctx, f.db, func(tx querier) error {
+
+		query := "SELECT status, version, user_id FROM orders WHERE order_id = $1 AND deleted_at IS NULL FOR UPDATE"
+
+		err := tx.QueryRow(ctx, query, req.Id).Scan(&status, &version, &userId)
+		if err != nil {
+			return translateError(err)
+		}
+
+		if req.Version != 0 && version != req.Version {
+			return storage.ErrVersionMismatch
+		}
+
+		if !models.CanTransition(status, req.Status) {
+			return fmt.Errorf("%w: order cannot go from %s to %s", storage.ErrConflict, status, req.Status)
+		}
+
+		query = `
+			UPDATE
+				orders
+			SET
+				status = $2,
+				reserved_until = NULL,
+				updated_at = now(),
+				version = version + 1
+			WHERE order_id = $1
+		`
+
+		_, err = tx.Exec(ctx, query, req.Id, req.Status)
+		if err != nil {
+			return translateError(err)
+		}
+
+		// only pending order holds stock, cancelled one gives it back. Paying debits wallet of user
+		// and refund gives back what was paid
+		switch req.Status {
+		case models.OrderCancelled:
+			err = releaseStock(ctx, tx, req.Id)
+		case models.OrderPaid:
+			err = payOrder(ctx, tx, req.Id, userId, req.ChangedBy)
+		case models.OrderRefunded:
+			err = refundOrder(ctx, tx, req.Id, userId, req.ChangedBy)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return recordStatus(ctx, tx, req.Id, status, req.Status, req.ChangedBy)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return f.GetByPKey(ctx, &models.OrderPrimarKey{Id: req.Id})
+}
+
+// GetStatusHistory returns status changes of order, oldest first
+func (f *orderRepo) GetStatusHistory(ctx context.Context, pkey *models.OrderPrimarKey) ([]*models.OrderStatusChange, error) {
+
+	var exists bool
+
+	query := "SELECT EXISTS(SELECT 1 FROM orders WHERE order_id = $1"
+	if !pkey.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+
+	err := f.db.QueryRow(ctx, query+")", pkey.Id).Scan(&exists)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	if !exists {
+		return nil, storage.ErrNotFound
+	}
+
+	query = `
+		SELECT
+			from_status,
+			to_status,
+			changed_by,
+			changed_at
+		FROM
+			order_status_history
+		WHERE order_id = $1
+		ORDER BY changed_at, order_status_history_id
+	`
+
+	rows, err := f.db.Query(ctx, query, pkey.Id)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	history := []*models.OrderStatusChange{}
+
+	for rows.Next() {
+
+		var (
+			fromStatus sql.NullString
+			toStatus   sql.NullString
+			changedBy  sql.NullString
+			changedAt  sql.NullString
+		)
+
+		err := rows.Scan(
+			&fromStatus,
+			&toStatus,
+			&changedBy,
+			&changedAt,
+		)
+
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		history = append(history, &models.OrderStatusChange{
+			FromStatus: fromStatus.String,
+			ToStatus:   toStatus.String,
+			ChangedBy:  changedBy.String,
+			ChangedAt:  changedAt.String,
+		})
+	}
+
+	return history, translateError(rows.Err())
+}
+
+// unchanged tells why change of pending order touched nothing like missingOrStale does, it also reports
+// order that is not pending any more
+func (f *orderRepo) unchanged(ctx context.Context, id string, version int32) error {
+
+	var (
+		status  string
+		current int32
+	)
+
+	query := "SELECT status, version FROM orders WHERE order_id = $1 AND deleted_at IS NULL"
+
+	err := f.db.QueryRow(ctx, query, id).Scan(&status, &current)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if version != 0 && current != version {
+		return storage.ErrVersionMismatch
+	}
+
+	if status != models.OrderPending {
+		return fmt.Errorf("%w: order is %s, only pending order can change", storage.ErrConflict, status)
+	}
+
+	return fmt.Errorf("%w: order changed meanwhile", storage.ErrConflict)
+}
+
+// reserveStock takes quantity copies of live book off its stock. Missing or deleted book is
+// ErrForeignKey and book without enough copies ErrConflict. Version of book moves on, so PUT or PATCH
+// of stock read before the order cannot bring the reserved copies back
+func reserveStock(ctx context.Context, db querier, bookId string, quantity int32) error {
+
+	query := `
+		UPDATE
+			book
+		SET
+			stock = stock - $2,
+			version = version + 1
+		WHERE book_id = $1 AND deleted_at IS NULL AND stock >= $2
+	`
+
+	result, err := db.Exec(ctx, query, bookId, quantity)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		err = checkLive(ctx, db, "book", "book_id", bookId)
+		if err != nil {
+			return err
+		}
+
+		return fmt.Errorf("%w: not enough stock of book %s", storage.ErrConflict, bookId)
+	}
+
+	return nil
+}
+
+// releaseStock gives copies held by items of order back to their books and moves their version on like
+// reserveStock. Order that never reserved stock or already gave it back releases nothing
+func releaseStock(ctx context.Context, db querier, orderId string) error {
+
+	query := `
+		WITH released AS (
+			UPDATE orders SET stock_reserved = false WHERE order_id = $1 AND stock_reserved RETURNING order_id
+		)
+		UPDATE
+			book
+		SET
+			stock = book.stock + order_items.quantity,
+			version = book.version + 1
+		FROM
+			order_items JOIN released ON released.order_id = order_items.order_id
+		WHERE book.book_id = order_items.book_id
+	`
+
+	_, err := db.Exec(ctx, query, orderId)
+
+	return translateError(err)
+}
+
+// recordStatus adds status change of order to its history, empty from is creation and empty
+// changedBy unknown user
+func recordStatus(ctx context.Context, db querier, orderId, from, to, changedBy string) error {
+
+	query := `
+		INSERT INTO order_status_history(
+			order_status_history_id,
+			order_id,
+			from_status,
+			to_status,
+			changed_by,
+			changed_at
+		) VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, '')::uuid, clock_timestamp())
+	`
+
+	_, err := db.Exec(ctx, query, uuid.New().String(), orderId, from, to, changedBy)
+
+	return translateError(err)
+}
+
+// loadItems sets items and totals of orders with one query
+func (f *orderRepo) loadItems(ctx context.Context, orders ...*models.Order) error {
+
+	if len(orders) == 0 {
+		return nil
+	}
+
+	var (
+		ids     = make([]string, len(orders))
+		byOrder = make(map[string]*models.Order, len(orders))
+	)
+
+	for i, order := range orders {
+		ids[i] = order.Id
+		byOrder[order.Id] = order
+		order.Items = []*models.OrderItem{}
+	}
+
+	query := `
+		SELECT
+			order_id,
+			book_id,
+			quantity,
+			unit_price,
+			currency
+		FROM
+			order_items
+		WHERE order_id = ANY($1::uuid[])
+		ORDER BY order_id, line
+	`
+
+	rows, err := f.db.Query(ctx, query, ids)
+	if err != nil {
+		return translateError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var (
+			orderId   sql.NullString
+			bookId    sql.NullString
+			quantity  sql.NullInt32
+			unitPrice sql.NullInt64
+			currency  sql.NullString
+		)
+
+		err := rows.Scan(
+			&orderId,
+			&bookId,
+			&quantity,
+			&unitPrice,
+			&currency,
+		)
+
+		if err != nil {
+			return translateError(err)
+		}
+
+		order := byOrder[orderId.String]
+
+		order.Items = append(order.Items, &models.OrderItem{
+			BookId:    bookId.String,
+			Quantity:  quantity.Int32,
+			UnitPrice: models.Money{Amount: unitPrice.Int64, Currency: currency.String},
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return translateError(err)
+	}
+
+	for _, order := range orders {
+		err = storage.OrderTotals(order)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+
+	"crud/models"
+)
+
+// patchColumn is column of PATCH, nil value leaves it alone
+type patchColumn struct {
+	name  string
+	value *string
+}
+
+// setColumns builds SET list of UPDATE for columns with values, adding them to params of named query.
+// Columns keep their order so the same patch always makes the same query. Empty when nothing changes
+func setColumns(params map[string]interface{}, columns ...patchColumn) string {
+
+	var set []string
+
+	for _, column := range columns {
+		if column.value != nil {
+			set = append(set, column.name+" = :"+column.name)
+			params[column.name] = *column.value
+		}
+	}
+
+	if len(set) == 0 {
+		return ""
+	}
+
+	return strings.Join(append(set, "updated_at = now()", "version = version + 1"), ", ")
+}
+
+// formatInt32 passes integer of PATCH as text like other columns. Postgres reports parameter type of column
+// and pgtype parses the text into it while encoding the argument, so the server never sees text
+func formatInt32(value *int32) *string {
+
+	if value == nil {
+		return nil
+	}
+
+	text := strconv.FormatInt(int64(*value), 10)
+
+	return &text
+}
+
+// formatMoney splits money of PATCH into amount and currency columns, nil money leaves both alone
+func formatMoney(value *models.Money) (amount, currency *string) {
+
+	if value == nil {
+		return nil, nil
+	}
+
+	text := strconv.FormatInt(value.Amount, 10)
+
+	return &text, &value.Currency
+}
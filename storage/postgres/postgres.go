@@ -2,7 +2,7 @@ package postgres
 
 import (
 	"context"
-	"fmt"
+	"net/url"
 
 	"github.com/jackc/pgx/v4/pgxpool"
 
@@ -10,39 +10,71 @@ import (
 	"crud/storage"
 )
 
+// Store runs repos on pool, or on transaction when pool is nil
 type Store struct {
-	db   *pgxpool.Pool
-	user *UserRepo
+	pool  *pgxpool.Pool
+	db    querier
+	user  *UserRepo
+	book  *bookRepo
+	order *orderRepo
+	role  *roleRepo
+
+	refreshToken *refreshTokenRepo
+	revocation   *revocationRepo
+	wallet       *walletRepo
 }
 
+// NewPostgres connects to database and refuses to return store when schema does not match what repos query
 func NewPostgres(ctx context.Context, cfg config.Config) (storage.StorageI, error) {
-	config, err := pgxpool.ParseConfig(fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		cfg.PostgresUser,
-		cfg.PostgresPassword,
-		cfg.PostgresHost,
-		cfg.PostgresPort,
-		cfg.PostgresDatabase,
-	))
+	pool, err := Connect(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	config.MaxConns = cfg.PostgresMaxConnections
-
-	pool, err := pgxpool.ConnectConfig(ctx, config)
+	err = CheckSchema(ctx, pool)
 	if err != nil {
+		pool.Close()
 		return nil, err
 	}
 
 	return &Store{
-		db:   pool,
-		user: NewUserRepo(pool),
+		pool:  pool,
+		db:    pool,
+		user:  NewUserRepo(pool),
+		book:  NewBookRepo(pool),
+		order: NewOrderRepo(pool),
+		role:  NewRoleRepo(pool),
+
+		refreshToken: NewRefreshTokenRepo(pool),
+		revocation:   NewRevocationRepo(pool),
+		wallet:       NewWalletRepo(pool),
 	}, err
 }
 
+// Connect opens connection pool to database from config
+func Connect(ctx context.Context, cfg config.Config) (*pgxpool.Pool, error) {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.PostgresUser, cfg.PostgresPassword),
+		Host:     cfg.PostgresHost + ":" + cfg.PostgresPort,
+		Path:     cfg.PostgresDatabase,
+		RawQuery: "sslmode=disable",
+	}
+
+	config, err := pgxpool.ParseConfig(dsn.String())
+	if err != nil {
+		return nil, err
+	}
+
+	config.MaxConns = cfg.PostgresMaxConnections
+
+	return pgxpool.ConnectConfig(ctx, config)
+}
+
 func (s *Store) CloseDB() {
-	s.db.Close()
+	if s.pool != nil {
+		s.pool.Close()
+	}
 }
 
 func (s *Store) User() storage.UserRepoI {
@@ -53,3 +85,57 @@ func (s *Store) User() storage.UserRepoI {
 
 	return s.user
 }
+
+func (s *Store) Book() storage.BookRepoI {
+
+	if s.book == nil {
+		s.book = NewBookRepo(s.db)
+	}
+
+	return s.book
+}
+
+func (s *Store) Order() storage.OrderRepoI {
+
+	if s.order == nil {
+		s.order = NewOrderRepo(s.db)
+	}
+
+	return s.order
+}
+
+func (s *Store) Role() storage.RoleRepoI {
+
+	if s.role == nil {
+		s.role = NewRoleRepo(s.db)
+	}
+
+	return s.role
+}
+
+func (s *Store) RefreshToken() storage.RefreshTokenRepoI {
+
+	if s.refreshToken == nil {
+		s.refreshToken = NewRefreshTokenRepo(s.db)
+	}
+
+	return s.refreshToken
+}
+
+func (s *Store) Revocation() storage.RevocationRepoI {
+
+	if s.revocation == nil {
+		s.revocation = NewRevocationRepo(s.db)
+	}
+
+	return s.revocation
+}
+
+func (s *Store) Wallet() storage.WalletRepoI {
+
+	if s.wallet == nil {
+		s.wallet = NewWalletRepo(s.db)
+	}
+
+	return s.wallet
+}
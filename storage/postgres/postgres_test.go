@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"crud/migrations"
+	"crud/storage"
+	"crud/storage/storagetest"
+)
+
+// TestStorage runs against database from TEST_POSTGRES_DSN, it is migrated to latest version
+// and its book, users and orders tables are truncated before every subtest
+func TestStorage(t *testing.T) {
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	files, err := fs.Sub(migrations.Postgres, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(pool, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CheckSchema(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storagetest.Run(t, func(t *testing.T) storage.StorageI {
+		_, err := pool.Exec(ctx, "TRUNCATE orders, book, users CASCADE")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return &Store{pool: pool, db: pool}
+	})
+}
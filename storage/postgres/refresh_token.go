@@ -0,0 +1,172 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+
+	"crud/models"
+)
+
+type refreshTokenRepo struct {
+	db querier
+}
+
+func NewRefreshTokenRepo(db querier) *refreshTokenRepo {
+	return &refreshTokenRepo{
+		db: db,
+	}
+}
+
+func (f *refreshTokenRepo) Create(ctx context.Context, token *models.CreateRefreshToken) (string, error) {
+
+	var (
+		id    = uuid.New().String()
+		query string
+	)
+
+	query = `
+		INSERT INTO refresh_tokens(
+			refresh_token_id,
+			family_id,
+			user_id,
+			token_hash,
+			role,
+			expires_at
+		) VALUES ( $1, $2, $3, $4, $5, $6 )
+	`
+
+	_, err := f.db.Exec(ctx, query,
+		id,
+		token.FamilyId,
+		token.UserId,
+		token.TokenHash,
+		token.Role,
+		token.ExpiresAt,
+	)
+
+	if err != nil {
+		return "", translateError(err)
+	}
+
+	return id, nil
+}
+
+func (f *refreshTokenRepo) GetByPKey(ctx context.Context, pkey *models.RefreshTokenPrimarKey) (*models.RefreshToken, error) {
+
+	var (
+		id        sql.NullString
+		familyId  sql.NullString
+		userId    sql.NullString
+		role      sql.NullString
+		expiresAt sql.NullTime
+		usedAt    sql.NullTime
+		revokedAt sql.NullTime
+		createdAt sql.NullString
+	)
+
+	query := `
+		SELECT
+			refresh_token_id,
+			family_id,
+			user_id,
+			role,
+			expires_at,
+			used_at,
+			revoked_at,
+			created_at
+		FROM
+			refresh_tokens
+		WHERE refresh_token_id::VARCHAR = $1 OR token_hash = $2
+	`
+
+	err := f.db.QueryRow(ctx, query, pkey.Id, pkey.TokenHash).
+		Scan(
+			&id,
+			&familyId,
+			&userId,
+			&role,
+			&expiresAt,
+			&usedAt,
+			&revokedAt,
+			&createdAt,
+		)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	token := &models.RefreshToken{
+		Id:        id.String,
+		FamilyId:  familyId.String,
+		UserId:    userId.String,
+		Role:      role.String,
+		ExpiresAt: expiresAt.Time,
+		CreatedAt: createdAt.String,
+	}
+
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return token, nil
+}
+
+// Use marks active token as used, zero rows affected means token was already used or revoked
+func (f *refreshTokenRepo) Use(ctx context.Context, pkey *models.RefreshTokenPrimarKey) (int64, error) {
+
+	query := `
+		UPDATE
+			refresh_tokens
+		SET
+			used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND revoked_at IS NULL
+	`
+
+	rowsAffected, err := f.db.Exec(ctx, query, pkey.TokenHash)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	return rowsAffected.RowsAffected(), nil
+}
+
+func (f *refreshTokenRepo) RevokeFamily(ctx context.Context, familyId string) error {
+
+	query := `
+		UPDATE
+			refresh_tokens
+		SET
+			revoked_at = now()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := f.db.Exec(ctx, query, familyId)
+	if err != nil {
+		return translateError(err)
+	}
+
+	return nil
+}
+
+func (f *refreshTokenRepo) RevokeUser(ctx context.Context, userId string) error {
+
+	query := `
+		UPDATE
+			refresh_tokens
+		SET
+			revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := f.db.Exec(ctx, query, userId)
+	if err != nil {
+		return translateError(err)
+	}
+
+	return nil
+}
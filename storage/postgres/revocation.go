@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+
+	"crud/models"
+)
+
+type revocationRepo struct {
+	db querier
+}
+
+func NewRevocationRepo(db querier) *revocationRepo {
+	return &revocationRepo{
+		db: db,
+	}
+}
+
+func (f *revocationRepo) Revoke(ctx context.Context, req *models.RevokeToken) error {
+
+	query := `
+		INSERT INTO revoked_tokens(
+			jti,
+			user_id,
+			expires_at
+		) VALUES ( $1, $2, $3 )
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	_, err := f.db.Exec(ctx, query, req.Jti, req.UserId, req.ExpiresAt.UTC())
+	if err != nil {
+		return translateError(err)
+	}
+
+	return nil
+}
+
+func (f *revocationRepo) RevokeUser(ctx context.Context, req *models.RevokeUserTokens) error {
+
+	query := `
+		INSERT INTO user_token_revocations(
+			user_id,
+			revoked_before
+		) VALUES ( $1, $2 )
+		ON CONFLICT (user_id) DO UPDATE SET revoked_before = EXCLUDED.revoked_before
+	`
+
+	_, err := f.db.Exec(ctx, query, req.UserId, req.RevokedBefore.UTC())
+	if err != nil {
+		return translateError(err)
+	}
+
+	return nil
+}
+
+// GetActive returns revoked tokens that are not expired yet and all user wide revocations
+func (f *revocationRepo) GetActive(ctx context.Context) (*models.Revocations, error) {
+
+	var resp = models.Revocations{}
+
+	rows, err := f.db.Query(ctx, `
+		SELECT
+			jti,
+			user_id,
+			expires_at
+		FROM
+			revoked_tokens
+		WHERE expires_at > (now() AT TIME ZONE 'UTC')
+	`)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token models.RevokeToken
+
+		err = rows.Scan(&token.Jti, &token.UserId, &token.ExpiresAt)
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		resp.Tokens = append(resp.Tokens, &token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+
+	rows, err = f.db.Query(ctx, "SELECT user_id, revoked_before FROM user_token_revocations")
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.RevokeUserTokens
+
+		err = rows.Scan(&user.UserId, &user.RevokedBefore)
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		resp.Users = append(resp.Users, &user)
+	}
+
+	return &resp, rows.Err()
+}
+
+func (f *revocationRepo) DeleteExpired(ctx context.Context) (int64, error) {
+
+	result, err := f.db.Exec(ctx, "DELETE FROM revoked_tokens WHERE expires_at <= (now() AT TIME ZONE 'UTC')")
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,395 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"crud/models"
+	"crud/storage"
+)
+
+type roleRepo struct {
+	db querier
+}
+
+func NewRoleRepo(db querier) *roleRepo {
+	return &roleRepo{
+		db: db,
+	}
+}
+
+func (f *roleRepo) Create(ctx context.Context, role *models.CreateRole) (string, error) {
+
+	var (
+		id    = uuid.New().String()
+		query string
+	)
+
+	err := atomic(ctx, f.db, func(tx querier) error {
+
+		query = `
+			INSERT INTO roles(
+				role_id,
+				name,
+				updated_at
+			) VALUES ( $1, $2, now() )
+		`
+
+		_, err := tx.Exec(ctx, query, id, role.Name)
+		if err != nil {
+			return translateError(err)
+		}
+
+		return setRolePermissions(ctx, tx, id, role.Permissions)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (f *roleRepo) GetByPKey(ctx context.Context, pkey *models.RolePrimarKey) (*models.Role, error) {
+
+	var (
+		id        sql.NullString
+		name      sql.NullString
+		createdAt sql.NullString
+		updatedAt sql.NullString
+	)
+
+	query := `
+		SELECT
+			role_id,
+			name,
+			created_at,
+			updated_at
+		FROM
+			roles
+		WHERE role_id::VARCHAR = $1 OR name = $2
+	`
+
+	err := f.db.QueryRow(ctx, query, pkey.Id, pkey.Name).
+		Scan(
+			&id,
+			&name,
+			&createdAt,
+			&updatedAt,
+		)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	permissions, err := f.getPermissions(ctx, id.String)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &models.Role{
+		Id:          id.String,
+		Name:        name.String,
+		Permissions: permissions,
+		CreatedAt:   createdAt.String,
+		UpdatedAt:   updatedAt.String,
+	}, nil
+}
+
+func (f *roleRepo) GetList(ctx context.Context, req *models.GetListRoleRequest) (*models.GetListRoleResponse, error) {
+
+	var (
+		resp   = models.GetListRoleResponse{}
+		offset = " OFFSET 0"
+		limit  = " LIMIT 10"
+	)
+
+	if req.Limit > 0 {
+		limit = fmt.Sprintf(" LIMIT %d", req.Limit)
+	}
+
+	if req.Offset > 0 {
+		offset = fmt.Sprintf(" OFFSET %d", req.Offset)
+	}
+
+	query := `
+		SELECT
+			COUNT(*) OVER(),
+			role_id,
+			name,
+			created_at,
+			updated_at
+		FROM
+			roles
+		ORDER BY name
+	`
+
+	query += offset + limit
+
+	rows, err := f.db.Query(ctx, query)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var (
+			id        sql.NullString
+			name      sql.NullString
+			createdAt sql.NullString
+			updatedAt sql.NullString
+		)
+
+		err := rows.Scan(
+			&resp.Count,
+			&id,
+			&name,
+			&createdAt,
+			&updatedAt,
+		)
+
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		resp.Roles = append(resp.Roles, &models.Role{
+			Id:        id.String,
+			Name:      name.String,
+			CreatedAt: createdAt.String,
+			UpdatedAt: updatedAt.String,
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+
+	for _, role := range resp.Roles {
+		role.Permissions, err = f.getPermissions(ctx, role.Id)
+		if err != nil {
+			return nil, translateError(err)
+		}
+	}
+
+	return &resp, nil
+}
+
+func (f *roleRepo) Update(ctx context.Context, req *models.UpdateRole) (int64, error) {
+
+	var rowsAffected int64
+
+	err := atomic(ctx, f.db, func(tx querier) error {
+
+		query := `
+			UPDATE
+				roles
+			SET
+				name = $2,
+				updated_at = now()
+			WHERE role_id = $1
+		`
+
+		result, err := tx.Exec(ctx, query, req.Id, req.Name)
+		if err != nil {
+			return translateError(err)
+		}
+
+		rowsAffected = result.RowsAffected()
+
+		if rowsAffected == 0 {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM role_permissions WHERE role_id = $1", req.Id)
+		if err != nil {
+			return translateError(err)
+		}
+
+		return setRolePermissions(ctx, tx, req.Id, req.Permissions)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected, nil
+}
+
+func (f *roleRepo) Delete(ctx context.Context, req *models.RolePrimarKey) error {
+
+	result, err := f.db.Exec(ctx, "DELETE FROM roles WHERE role_id = $1", req.Id)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func (f *roleRepo) AssignToUser(ctx context.Context, req *models.UserRole) error {
+
+	query := `
+		INSERT INTO user_roles(
+			user_id,
+			role_id
+		)
+		SELECT $1, role_id FROM roles WHERE name = $2
+		ON CONFLICT DO NOTHING
+	`
+
+	result, err := f.db.Exec(ctx, query, req.UserId, req.Role)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		var exists bool
+
+		err = f.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)", req.Role).Scan(&exists)
+		if err != nil {
+			return translateError(err)
+		}
+
+		if !exists {
+			return storage.ErrNotFound
+		}
+	}
+
+	return nil
+}
+
+func (f *roleRepo) RevokeFromUser(ctx context.Context, req *models.UserRole) error {
+
+	query := `
+		DELETE FROM user_roles
+		WHERE user_id = $1 AND role_id = (SELECT role_id FROM roles WHERE name = $2)
+	`
+
+	_, err := f.db.Exec(ctx, query, req.UserId, req.Role)
+	if err != nil {
+		return translateError(err)
+	}
+
+	return nil
+}
+
+func (f *roleRepo) GetUserRoles(ctx context.Context, userId string) ([]string, error) {
+
+	var roles []string
+
+	query := `
+		SELECT
+			r.name
+		FROM
+			user_roles AS ur
+		JOIN roles AS r ON r.role_id = ur.role_id
+		WHERE ur.user_id = $1
+		ORDER BY ur.created_at
+	`
+
+	rows, err := f.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		roles = append(roles, name)
+	}
+
+	return roles, rows.Err()
+}
+
+func (f *roleRepo) HasPermission(ctx context.Context, role string, permission string) (bool, error) {
+
+	var has bool
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM
+				role_permissions AS rp
+			JOIN roles AS r ON r.role_id = rp.role_id
+			JOIN permissions AS p ON p.permission_id = rp.permission_id
+			WHERE r.name = $1 AND p.name = $2
+		)
+	`
+
+	err := f.db.QueryRow(ctx, query, role, permission).Scan(&has)
+	if err != nil {
+		return false, translateError(err)
+	}
+
+	return has, nil
+}
+
+func (f *roleRepo) getPermissions(ctx context.Context, roleId string) ([]string, error) {
+
+	var permissions = []string{}
+
+	query := `
+		SELECT
+			p.name
+		FROM
+			role_permissions AS rp
+		JOIN permissions AS p ON p.permission_id = rp.permission_id
+		WHERE rp.role_id = $1
+		ORDER BY p.name
+	`
+
+	rows, err := f.db.Query(ctx, query, roleId)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		permissions = append(permissions, name)
+	}
+
+	return permissions, rows.Err()
+}
+
+// setRolePermissions links permissions to role, unknown permission names are created
+func setRolePermissions(ctx context.Context, tx querier, roleId string, permissions []string) error {
+
+	for _, permission := range permissions {
+
+		_, err := tx.Exec(ctx,
+			"INSERT INTO permissions(permission_id, name) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING",
+			uuid.New().String(), permission,
+		)
+		if err != nil {
+			return translateError(err)
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO role_permissions(role_id, permission_id)
+			SELECT $1, permission_id FROM permissions WHERE name = $2
+			ON CONFLICT DO NOTHING
+		`, roleId, permission)
+		if err != nil {
+			return translateError(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// expectedSchema lists every table and column the repos of this package query, with its udt_name.
+// Keep it in sync with migrations, CheckSchema compares it to the live database
+var expectedSchema = map[string]map[string]string{
+	"book": {
+		"book_id":             "uuid",
+		"name":                "varchar",
+		"author_name":         "varchar",
+		"price":               "int4",
+		"currency":            "varchar",
+		"date":                "varchar",
+		"stock":               "int4",
+		"low_stock_threshold": "int4",
+		"created_at":          "timestamp",
+		"updated_at":          "timestamp",
+		"version":             "int4",
+		"deleted_at":          "timestamp",
+	},
+	"users": {
+		"user_id":      "uuid",
+		"first_name":   "varchar",
+		"last_name":    "varchar",
+		"login":        "varchar",
+		"password":     "varchar",
+		"phone_number": "varchar",
+		"balance":      "int4",
+		"created_at":   "timestamp",
+		"updated_at":   "timestamp",
+		"version":      "int4",
+		"deleted_at":   "timestamp",
+
+		"password_reset_required": "bool",
+	},
+	"orders": {
+		"order_id":       "uuid",
+		"user_id":        "uuid",
+		"status":         "varchar",
+		"reserved_until": "timestamp",
+		"stock_reserved": "bool",
+		"created_at":     "timestamp",
+		"updated_at":     "timestamp",
+		"version":        "int4",
+		"deleted_at":     "timestamp",
+	},
+	"order_items": {
+		"order_id":   "uuid",
+		"line":       "int4",
+		"book_id":    "uuid",
+		"quantity":   "int4",
+		"unit_price": "int4",
+		"currency":   "varchar",
+	},
+	"order_status_history": {
+		"order_status_history_id": "uuid",
+		"order_id":                "uuid",
+		"from_status":             "varchar",
+		"to_status":               "varchar",
+		"changed_by":              "uuid",
+		"changed_at":              "timestamp",
+	},
+	"ledger_entries": {
+		"ledger_entry_id": "uuid",
+		"transaction_id":  "uuid",
+		"account":         "varchar",
+		"user_id":         "uuid",
+		"order_id":        "uuid",
+		"kind":            "varchar",
+		"amount":          "int4",
+		"currency":        "varchar",
+		"created_by":      "uuid",
+		"created_at":      "timestamp",
+	},
+	"roles": {
+		"role_id":    "uuid",
+		"name":       "varchar",
+		"created_at": "timestamp",
+		"updated_at": "timestamp",
+	},
+	"permissions": {
+		"permission_id": "uuid",
+		"name":          "varchar",
+	},
+	"role_permissions": {
+		"role_id":       "uuid",
+		"permission_id": "uuid",
+	},
+	"user_roles": {
+		"user_id": "uuid",
+		"role_id": "uuid",
+	},
+	"refresh_tokens": {
+		"refresh_token_id": "uuid",
+		"family_id":        "uuid",
+		"user_id":          "uuid",
+		"token_hash":       "varchar",
+		"role":             "varchar",
+		"expires_at":       "timestamp",
+		"used_at":          "timestamp",
+		"revoked_at":       "timestamp",
+		"created_at":       "timestamp",
+	},
+	"revoked_tokens": {
+		"jti":        "varchar",
+		"user_id":    "uuid",
+		"expires_at": "timestamp",
+	},
+	"user_token_revocations": {
+		"user_id":        "uuid",
+		"revoked_before": "timestamp",
+	},
+}
+
+// CheckSchema reports every table or column of expectedSchema that is missing or has another type in database.
+// Extra tables and columns are allowed
+func CheckSchema(ctx context.Context, db *pgxpool.Pool) error {
+
+	rows, err := db.Query(ctx, `
+		SELECT
+			table_name,
+			column_name,
+			udt_name
+		FROM
+			information_schema.columns
+		WHERE table_schema = current_schema()
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	live := map[string]map[string]string{}
+
+	for rows.Next() {
+		var table, column, udt string
+
+		err = rows.Scan(&table, &column, &udt)
+		if err != nil {
+			return err
+		}
+
+		if live[table] == nil {
+			live[table] = map[string]string{}
+		}
+		live[table][column] = udt
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	var problems []string
+
+	for table, columns := range expectedSchema {
+		if _, ok := live[table]; !ok {
+			problems = append(problems, fmt.Sprintf("table %s is missing", table))
+			continue
+		}
+
+		for column, udt := range columns {
+			got, ok := live[table][column]
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("column %s.%s is missing", table, column))
+			case got != udt:
+				problems = append(problems, fmt.Sprintf("column %s.%s is %s, expected %s", table, column, got, udt))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	// map iteration order is random, keep messages stable
+	sort.Strings(problems)
+
+	return fmt.Errorf("database schema does not match storage, run migrations:\n  %s", strings.Join(problems, "\n  "))
+}
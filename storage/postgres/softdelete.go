@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"crud/models"
+	"crud/storage"
+)
+
+// checkLive rejects reference to row that is deleted, foreign keys only catch rows that are gone for good
+func checkLive(ctx context.Context, db querier, table, idColumn, id string) error {
+
+	var live bool
+
+	err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM "+table+" WHERE "+idColumn+" = $1 AND deleted_at IS NULL)", id).
+		Scan(&live)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if !live {
+		return fmt.Errorf("%w: %s %s does not exist", storage.ErrForeignKey, idColumn, id)
+	}
+
+	return nil
+}
+
+// checkOrderReferences rejects restoring order whose user or book of any item is deleted
+func checkOrderReferences(ctx context.Context, db querier, order *models.Order) error {
+
+	err := checkLive(ctx, db, "users", "user_id", order.UserId)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range order.Items {
+		err = checkLive(ctx, db, "book", "book_id", item.BookId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+
+	"crud/storage"
+)
+
+// maxTxAttempts bounds how often WithTx reruns a transaction that hit serialization failure or deadlock
+const maxTxAttempts = 5
+
+// querier is implemented by both *pgxpool.Pool and pgx.Tx, so repos run the same way inside and outside transactions
+type querier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// WithTx runs fn in serializable transaction, repos of tx share it. Transaction commits when fn returns nil
+// and rolls back otherwise. Serialization failures and deadlocks rerun fn, so fn must not have other side effects.
+// WithTx called on tx joins the running transaction
+func (s *Store) WithTx(ctx context.Context, fn func(tx storage.StorageI) error) error {
+
+	if s.pool == nil {
+		return fn(s)
+	}
+
+	for attempt := 1; ; attempt++ {
+
+		err := s.runTx(ctx, fn)
+		if err == nil || !retryable(err) || attempt == maxTxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 10 * time.Millisecond):
+		}
+	}
+}
+
+func (s *Store) runTx(ctx context.Context, fn func(tx storage.StorageI) error) error {
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = fn(&Store{db: tx})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// atomic runs fn on transaction of db and commits it when fn returns nil. Repos write rows that belong together
+// through it. Begin of pgx.Tx starts a savepoint, so inside WithTx atomic only rolls back its own part
+func atomic(ctx context.Context, db querier, fn func(tx querier) error) error {
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return translateError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return translateError(tx.Commit(ctx))
+}
+
+// retryable reports serialization_failure and deadlock_detected
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
@@ -3,20 +3,22 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v4/pgxpool"
 
 	"crud/models"
 	"crud/pkg/helper"
+	"crud/storage"
 )
 
 type UserRepo struct {
-	db *pgxpool.Pool
+	db querier
 }
 
-func NewUserRepo(db *pgxpool.Pool) *UserRepo {
+func NewUserRepo(db querier) *UserRepo {
 	return &UserRepo{
 		db: db,
 	}
@@ -51,7 +53,7 @@ func (f *UserRepo) Create(ctx context.Context, user *models.CreateUser) (string,
 	)
 
 	if err != nil {
-		return "", err
+		return "", translateError(err)
 	}
 
 	return id, nil
@@ -68,15 +70,19 @@ func (f *UserRepo) GetByPKey(ctx context.Context, pkey *models.UserPrimarKey) (*
 		phone_number sql.NullString
 		createdAt    sql.NullString
 		updatedAt    sql.NullString
+		version      sql.NullInt32
+		deletedAt    sql.NullString
+
+		resetRequired sql.NullBool
 	)
 
 	if len(pkey.Login) > 0 {
 
-		err := f.db.QueryRow(ctx, "SELECT user_id FROM users WHERE login = $1", pkey.Login).
+		err := f.db.QueryRow(ctx, "SELECT user_id FROM users WHERE login = $1 AND deleted_at IS NULL", pkey.Login).
 			Scan(&pkey.Id)
 
 		if err != nil {
-			return nil, err
+			return nil, translateError(err)
 		}
 
 	}
@@ -90,12 +96,19 @@ func (f *UserRepo) GetByPKey(ctx context.Context, pkey *models.UserPrimarKey) (*
 			password,
 			phone_number,
 			created_at,
-			updated_at
+			updated_at,
+			version,
+			deleted_at,
+			password_reset_required
 		FROM
 			users
 		WHERE user_id = $1
 	`
 
+	if !pkey.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+
 	err := f.db.QueryRow(ctx, query, pkey.Id).
 		Scan(
 			&id,
@@ -106,10 +119,13 @@ func (f *UserRepo) GetByPKey(ctx context.Context, pkey *models.UserPrimarKey) (*
 			&phone_number,
 			&createdAt,
 			&updatedAt,
+			&version,
+			&deletedAt,
+			&resetRequired,
 		)
 
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return &models.User{
@@ -121,6 +137,10 @@ func (f *UserRepo) GetByPKey(ctx context.Context, pkey *models.UserPrimarKey) (*
 		PhoneNumber: phone_number.String,
 		CreatedAt:   createdAt.String,
 		UpdatedAt:   updatedAt.String,
+		Version:     version.Int32,
+		DeletedAt:   deletedAt.String,
+
+		PasswordResetRequired: resetRequired.Bool,
 	}, nil
 }
 
@@ -128,37 +148,85 @@ func (f *UserRepo) GetList(ctx context.Context, req *models.GetListUserRequest)
 
 	var (
 		resp   = models.GetListUserResponse{}
+		filter = &filter{}
 		offset = " OFFSET 0"
-		limit  = " LIMIT 5"
+		limit  = int32(5)
+		total  int32
 	)
 
+	if !req.IncludeDeleted {
+		filter.add("deleted_at IS NULL")
+	}
+
+	filter.search(req.Search, "first_name", "last_name", "login", "phone_number")
+
+	if req.Login != "" {
+		filter.add("login = ?", req.Login)
+	}
+
+	filter.createdBetween(req.CreatedFrom, req.CreatedTo)
+
+	order, err := orderBy(req.Sort, userSortColumns, "user_id")
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkCursor(req.After, req.Sort)
+	if err != nil {
+		return nil, err
+	}
+
 	if req.Limit > 0 {
-		limit = fmt.Sprintf(" LIMIT %d", req.Limit)
+		limit = req.Limit
 	}
 
 	if req.Offset > 0 {
 		offset = fmt.Sprintf(" OFFSET %d", req.Offset)
 	}
 
+	totalColumn := countOver
+
+	if req.After == nil {
+		resp.Count = &total
+	} else {
+		totalColumn = "0"
+
+		if req.WithCount {
+			count, err := filter.count(ctx, f.db, "users")
+			if err != nil {
+				return nil, err
+			}
+			resp.Count = &count
+		}
+
+		filter.after(req.After, "user_id")
+	}
+
 	query := `
 		SELECT
-			COUNT(*) OVER(),
+			` + totalColumn + `,
 			user_id,
 			first_name,
 			last_name,
 			login,
 			password,
 			phone_number,
-			balance,
 			created_at,
-			updated_at
+			updated_at,
+			version,
+			deleted_at,
+			password_reset_required
 		FROM
 			users
 	`
 
-	query += offset + limit
+	query += filter.where() + order + offset + pageLimit(limit)
 
-	rows, err := f.db.Query(ctx, query)
+	rows, err := f.db.Query(ctx, query, filter.args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
 
 	for rows.Next() {
 
@@ -171,10 +239,14 @@ func (f *UserRepo) GetList(ctx context.Context, req *models.GetListUserRequest)
 			phone_number sql.NullString
 			createdAt    sql.NullString
 			updatedAt    sql.NullString
+			version      sql.NullInt32
+			deletedAt    sql.NullString
+
+			resetRequired sql.NullBool
 		)
 
 		err := rows.Scan(
-			&resp.Count,
+			&total,
 			&id,
 			&first_name,
 			&last_name,
@@ -183,10 +255,13 @@ func (f *UserRepo) GetList(ctx context.Context, req *models.GetListUserRequest)
 			&phone_number,
 			&createdAt,
 			&updatedAt,
+			&version,
+			&deletedAt,
+			&resetRequired,
 		)
 
 		if err != nil {
-			return nil, err
+			return nil, translateError(err)
 		}
 
 		resp.Users = append(resp.Users, &models.User{
@@ -198,11 +273,24 @@ func (f *UserRepo) GetList(ctx context.Context, req *models.GetListUserRequest)
 			PhoneNumber: phone_number.String,
 			CreatedAt:   createdAt.String,
 			UpdatedAt:   updatedAt.String,
+			Version:     version.Int32,
+			DeletedAt:   deletedAt.String,
+
+			PasswordResetRequired: resetRequired.Bool,
 		})
 
 	}
 
-	return &resp, err
+	if len(resp.Users) > int(limit) {
+		resp.Users = resp.Users[:limit]
+
+		if models.KeysetSorted(req.Sort) {
+			last := resp.Users[limit-1]
+			resp.Next = &models.Cursor{CreatedAt: last.CreatedAt, Id: last.Id}
+		}
+	}
+
+	return &resp, rows.Err()
 }
 
 func (f *UserRepo) Update(ctx context.Context, req *models.UpdateUser) (int64, error) {
@@ -220,9 +308,11 @@ func (f *UserRepo) Update(ctx context.Context, req *models.UpdateUser) (int64, e
 			last_name = :last_name,
 			login = :login,
 			password = :password,
+			password_reset_required = false,
 			phone_number = :phone_number,
-			updated_at = now()
-		WHERE user_id = :user_id
+			updated_at = now(),
+			version = version + 1
+		WHERE user_id = :user_id AND deleted_at IS NULL
 	`
 
 	params = map[string]interface{}{
@@ -234,22 +324,268 @@ func (f *UserRepo) Update(ctx context.Context, req *models.UpdateUser) (int64, e
 		"phone_number": req.PhoneNumber,
 	}
 
-	query, args := helper.ReplaceQueryParams(query, params)
+	query += versionCheck(params, req.Version)
 
-	rowsAffected, err := f.db.Exec(ctx, query, args...)
+	query, args, err := helper.BindNamed(query, params)
 	if err != nil {
 		return 0, err
 	}
 
+	rowsAffected, err := f.db.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	if rowsAffected.RowsAffected() == 0 && req.Version != 0 {
+		err = missingOrStale(ctx, f.db, "users", "user_id", req.Id)
+		if !errors.Is(err, storage.ErrNotFound) {
+			return 0, err
+		}
+	}
+
+	return rowsAffected.RowsAffected(), nil
+}
+
+func (f *UserRepo) Patch(ctx context.Context, req *models.PatchUser) (*models.User, error) {
+
+	var (
+		params      = map[string]interface{}{"user_id": req.Id}
+		id          sql.NullString
+		firstName   sql.NullString
+		lastName    sql.NullString
+		login       sql.NullString
+		password    sql.NullString
+		phoneNumber sql.NullString
+		createdAt   sql.NullString
+		updatedAt   sql.NullString
+		version     sql.NullInt32
+		deletedAt   sql.NullString
+
+		resetRequired sql.NullBool
+	)
+
+	set := setColumns(params,
+		patchColumn{"first_name", req.FirstName},
+		patchColumn{"last_name", req.LastName},
+		patchColumn{"login", req.Login},
+		patchColumn{"password", req.Password},
+		patchColumn{"phone_number", req.PhoneNumber},
+	)
+
+	if req.Password != nil {
+		set += ", password_reset_required = false"
+	}
+
+	if set == "" {
+		user, err := f.GetByPKey(ctx, &models.UserPrimarKey{Id: req.Id})
+		if err == nil && req.Version != 0 && user.Version != req.Version {
+			return nil, storage.ErrVersionMismatch
+		}
+
+		return user, err
+	}
+
+	query := `
+		UPDATE
+			users
+		SET ` + set + `
+		WHERE user_id = :user_id AND deleted_at IS NULL` + versionCheck(params, req.Version) + `
+		RETURNING
+			user_id,
+			first_name,
+			last_name,
+			login,
+			password,
+			phone_number,
+			created_at,
+			updated_at,
+			version,
+			deleted_at,
+			password_reset_required
+	`
+
+	query, args, err := helper.BindNamed(query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err = translateError(f.db.QueryRow(ctx, query, args...).
+		Scan(
+			&id,
+			&firstName,
+			&lastName,
+			&login,
+			&password,
+			&phoneNumber,
+			&createdAt,
+			&updatedAt,
+			&version,
+			&deletedAt,
+			&resetRequired,
+		))
+	if errors.Is(err, storage.ErrNotFound) && req.Version != 0 {
+		return nil, missingOrStale(ctx, f.db, "users", "user_id", req.Id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.User{
+		Id:          id.String,
+		FirstName:   firstName.String,
+		LastName:    lastName.String,
+		Login:       login.String,
+		Password:    password.String,
+		PhoneNumber: phoneNumber.String,
+		CreatedAt:   createdAt.String,
+		UpdatedAt:   updatedAt.String,
+		Version:     version.Int32,
+		DeletedAt:   deletedAt.String,
+
+		PasswordResetRequired: resetRequired.Bool,
+	}, nil
+}
+
+func (f *UserRepo) UpdatePassword(ctx context.Context, req *models.UpdateUserPassword) (int64, error) {
+
+	query := `
+		UPDATE
+			users
+		SET
+			password = $2,
+			updated_at = now(),
+			version = version + 1
+		WHERE user_id = $1 AND deleted_at IS NULL
+	`
+
+	rowsAffected, err := f.db.Exec(ctx, query, req.Id, req.Password)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
 	return rowsAffected.RowsAffected(), nil
 }
 
 func (f *UserRepo) Delete(ctx context.Context, req *models.UserPrimarKey) error {
 
-	_, err := f.db.Exec(ctx, "DELETE FROM users WHERE user_id = $1", req.Id)
+	params := map[string]interface{}{"user_id": req.Id}
+
+	query := `
+		UPDATE
+			users
+		SET
+			deleted_at = now(),
+			version = version + 1
+		WHERE user_id = :user_id AND deleted_at IS NULL`
+
+	query, args, err := helper.BindNamed(query+versionCheck(params, req.Version), params)
 	if err != nil {
 		return err
 	}
 
-	return err
+	result, err := f.db.Exec(ctx, query, args...)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return missingOrStale(ctx, f.db, "users", "user_id", req.Id)
+	}
+
+	return nil
+}
+
+func (f *UserRepo) Restore(ctx context.Context, req *models.UserPrimarKey) (*models.User, error) {
+
+	var (
+		id           sql.NullString
+		first_name   sql.NullString
+		last_name    sql.NullString
+		login        sql.NullString
+		password     sql.NullString
+		phone_number sql.NullString
+		createdAt    sql.NullString
+		updatedAt    sql.NullString
+		version      sql.NullInt32
+
+		resetRequired sql.NullBool
+	)
+
+	query := `
+		UPDATE
+			users
+		SET
+			deleted_at = NULL,
+			updated_at = now(),
+			version = version + 1
+		WHERE user_id = $1 AND deleted_at IS NOT NULL
+		RETURNING
+			user_id,
+			first_name,
+			last_name,
+			login,
+			password,
+			phone_number,
+			created_at,
+			updated_at,
+			version,
+			password_reset_required
+	`
+
+	err := translateError(f.db.QueryRow(ctx, query, req.Id).
+		Scan(
+			&id,
+			&first_name,
+			&last_name,
+			&login,
+			&password,
+			&phone_number,
+			&createdAt,
+			&updatedAt,
+			&version,
+			&resetRequired,
+		))
+
+	if errors.Is(err, storage.ErrNotFound) {
+		return f.GetByPKey(ctx, &models.UserPrimarKey{Id: req.Id})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.User{
+		Id:          id.String,
+		FirstName:   first_name.String,
+		LastName:    last_name.String,
+		Login:       login.String,
+		Password:    password.String,
+		PhoneNumber: phone_number.String,
+		CreatedAt:   createdAt.String,
+		UpdatedAt:   updatedAt.String,
+		Version:     version.Int32,
+
+		PasswordResetRequired: resetRequired.Bool,
+	}, nil
+}
+
+// PurgeDeleted removes users deleted before deletedBefore that no order or ledger entry references,
+// their roles and tokens go with them by ON DELETE CASCADE
+func (f *UserRepo) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+
+	query := `
+		DELETE FROM
+			users
+		WHERE deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.user_id)
+			AND NOT EXISTS (SELECT 1 FROM ledger_entries WHERE ledger_entries.user_id = users.user_id)
+	`
+
+	result, err := f.db.Exec(ctx, query, deletedBefore.UTC())
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	return result.RowsAffected(), nil
 }
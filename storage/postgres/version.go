@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+
+	"crud/storage"
+)
+
+// versionCheck returns condition that row still has version expected by client, empty when version is zero
+func versionCheck(params map[string]interface{}, version int32) string {
+
+	if version == 0 {
+		return ""
+	}
+
+	params["version"] = version
+
+	return " AND version = :version"
+}
+
+// missingOrStale tells why change of live row touched nothing: it is gone or deleted, or its version moved on.
+// Update passes ErrNotFound on as zero rows, so missing row reports the same with version as without it
+func missingOrStale(ctx context.Context, db querier, table, idColumn, id string) error {
+
+	var exists bool
+
+	err := db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM "+table+" WHERE "+idColumn+" = $1 AND deleted_at IS NULL)", id).Scan(&exists)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if exists {
+		return storage.ErrVersionMismatch
+	}
+
+	return storage.ErrNotFound
+}
@@ -0,0 +1,434 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"crud/models"
+	"crud/storage"
+)
+
+type walletRepo struct {
+	db querier
+}
+
+func NewWalletRepo(db querier) *walletRepo {
+	return &walletRepo{
+		db: db,
+	}
+}
+
+// GetBalance sums wallet entries of user, cached users.balance only guards against overdraw
+func (f *walletRepo) GetBalance(ctx context.Context, pkey *models.UserPrimarKey) (*models.Wallet, error) {
+
+	var balance int64
+
+	query := `
+		SELECT
+			COALESCE((SELECT SUM(amount) FROM ledger_entries WHERE ledger_entries.user_id = users.user_id), 0)
+		FROM
+			users
+		WHERE user_id = $1
+	`
+
+	if !pkey.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+
+	err := f.db.QueryRow(ctx, query, pkey.Id).Scan(&balance)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &models.Wallet{
+		UserId:  pkey.Id,
+		Balance: models.Money{Amount: balance, Currency: models.WalletCurrency},
+	}, nil
+}
+
+func (f *walletRepo) TopUp(ctx context.Context, req *models.WalletOperation) (*models.Wallet, error) {
+	return f.move(ctx, req, models.LedgerTopUp, 1)
+}
+
+func (f *walletRepo) Withdraw(ctx context.Context, req *models.WalletOperation) (*models.Wallet, error) {
+	return f.move(ctx, req, models.LedgerWithdrawal, -1)
+}
+
+// move posts amount of req between wallet and cash account, sign tells direction
+func (f *walletRepo) move(ctx context.Context, req *models.WalletOperation, kind string, sign int64) (*models.Wallet, error) {
+
+	amount, err := storage.WalletAmount(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var wallet *models.Wallet
+
+	err = atomic(ctx, f.db, func(tx querier) error {
+
+		err := post(ctx, tx, transfer{
+			userId:    req.UserId,
+			account:   models.AccountCash,
+			kind:      kind,
+			amount:    sign * amount,
+			createdBy: req.CreatedBy,
+		})
+		if err != nil {
+			return err
+		}
+
+		wallet, err = NewWalletRepo(tx).GetBalance(ctx, &models.UserPrimarKey{Id: req.UserId})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+// GetLedger lists wallet entries of user, deleted user keeps its ledger
+func (f *walletRepo) GetLedger(ctx context.Context, req *models.GetLedgerRequest) (*models.GetLedgerResponse, error) {
+
+	var (
+		resp   = models.GetLedgerResponse{Entries: []*models.LedgerEntry{}}
+		limit  = int32(10)
+		exists bool
+	)
+
+	err := f.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1)", req.UserId).Scan(&exists)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	if !exists {
+		return nil, storage.ErrNotFound
+	}
+
+	if req.Limit > 0 {
+		limit = req.Limit
+	}
+
+	query := `
+		SELECT
+			COUNT(*) OVER(),
+			ledger_entry_id,
+			transaction_id,
+			account,
+			user_id,
+			order_id,
+			kind,
+			amount,
+			currency,
+			created_by,
+			created_at
+		FROM
+			ledger_entries
+		WHERE user_id = $1
+		ORDER BY created_at, ledger_entry_id
+		OFFSET $2 LIMIT $3
+	`
+
+	rows, err := f.db.Query(ctx, query, req.UserId, req.Offset, limit)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var (
+			id            sql.NullString
+			transactionId sql.NullString
+			account       sql.NullString
+			userId        sql.NullString
+			orderId       sql.NullString
+			kind          sql.NullString
+			amount        sql.NullInt64
+			currency      sql.NullString
+			createdBy     sql.NullString
+			createdAt     sql.NullString
+		)
+
+		err := rows.Scan(
+			&resp.Count,
+			&id,
+			&transactionId,
+			&account,
+			&userId,
+			&orderId,
+			&kind,
+			&amount,
+			&currency,
+			&createdBy,
+			&createdAt,
+		)
+
+		if err != nil {
+			return nil, translateError(err)
+		}
+
+		resp.Entries = append(resp.Entries, &models.LedgerEntry{
+			Id:            id.String,
+			TransactionId: transactionId.String,
+			Account:       account.String,
+			UserId:        userId.String,
+			OrderId:       orderId.String,
+			Kind:          kind.String,
+			Amount:        models.Money{Amount: amount.Int64, Currency: currency.String},
+			CreatedBy:     createdBy.String,
+			CreatedAt:     createdAt.String,
+		})
+	}
+
+	return &resp, translateError(rows.Err())
+}
+
+// Reconcile finds users whose cached balance drifted from their ledger, then fixes each of them with
+// its row locked so postings running meanwhile are counted
+func (f *walletRepo) Reconcile(ctx context.Context) ([]*models.BalanceMismatch, error) {
+
+	query := `
+		SELECT
+			users.user_id
+		FROM
+			users
+		LEFT JOIN (
+			SELECT user_id, SUM(amount) AS balance FROM ledger_entries WHERE user_id IS NOT NULL GROUP BY user_id
+		) ledger ON ledger.user_id = users.user_id
+		WHERE users.balance <> COALESCE(ledger.balance, 0)
+	`
+
+	rows, err := f.db.Query(ctx, query)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	var ids []string
+
+	for rows.Next() {
+		var id string
+
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return nil, translateError(err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+
+	fixed := []*models.BalanceMismatch{}
+
+	for _, id := range ids {
+		mismatch, err := f.reconcileUser(ctx, id)
+		if err != nil {
+			return fixed, err
+		}
+
+		if mismatch != nil {
+			fixed = append(fixed, mismatch)
+		}
+	}
+
+	return fixed, nil
+}
+
+// reconcileUser sets cached balance of user to sum of its ledger, nil when it matched already
+func (f *walletRepo) reconcileUser(ctx context.Context, userId string) (*models.BalanceMismatch, error) {
+
+	var cached, ledger int64
+
+	err := atomic(ctx, f.db, func(tx querier) error {
+
+		err := tx.QueryRow(ctx, "SELECT balance FROM users WHERE user_id = $1 FOR UPDATE", userId).Scan(&cached)
+		if err != nil {
+			return translateError(err)
+		}
+
+		err = tx.QueryRow(ctx, "SELECT COALESCE(SUM(amount), 0) FROM ledger_entries WHERE user_id = $1", userId).
+			Scan(&ledger)
+		if err != nil {
+			return translateError(err)
+		}
+
+		if cached == ledger {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE users SET balance = $2 WHERE user_id = $1", userId, ledger)
+		return translateError(err)
+	})
+	if err != nil || cached == ledger {
+		return nil, err
+	}
+
+	return &models.BalanceMismatch{
+		UserId:        userId,
+		Balance:       models.Money{Amount: cached, Currency: models.WalletCurrency},
+		LedgerBalance: models.Money{Amount: ledger, Currency: models.WalletCurrency},
+	}, nil
+}
+
+// transfer is ledger transaction between wallet of user and account, positive amount goes into wallet
+type transfer struct {
+	userId    string
+	account   string
+	kind      string
+	orderId   string
+	createdBy string
+	amount    int64
+}
+
+// post records transfer as two entries that sum to zero and moves cached balance of user with it.
+// User must be live, wallet that would go below zero is ErrConflict
+func post(ctx context.Context, db querier, t transfer) error {
+
+	query := `
+		UPDATE
+			users
+		SET
+			balance = balance + $2
+		WHERE user_id = $1 AND deleted_at IS NULL AND balance + $2 >= 0
+	`
+
+	result, err := db.Exec(ctx, query, t.userId, t.amount)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		var live bool
+
+		err = db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1 AND deleted_at IS NULL)", t.userId).
+			Scan(&live)
+		if err != nil {
+			return translateError(err)
+		}
+
+		if !live {
+			return storage.ErrNotFound
+		}
+
+		return fmt.Errorf("%w: balance of user %s is too low", storage.ErrConflict, t.userId)
+	}
+
+	query = `
+		INSERT INTO ledger_entries(
+			ledger_entry_id,
+			transaction_id,
+			account,
+			user_id,
+			order_id,
+			kind,
+			amount,
+			currency,
+			created_by,
+			created_at
+		) VALUES
+			($1, $3, 'wallet', $4, NULLIF($5, '')::uuid, $6, $7, $10, NULLIF($8, '')::uuid, clock_timestamp()),
+			($2, $3, $9, NULL, NULLIF($5, '')::uuid, $6, -$7, $10, NULLIF($8, '')::uuid, clock_timestamp())
+	`
+
+	_, err = db.Exec(ctx, query,
+		uuid.New().String(),
+		uuid.New().String(),
+		uuid.New().String(),
+		t.userId,
+		t.orderId,
+		t.kind,
+		t.amount,
+		t.createdBy,
+		t.account,
+		models.WalletCurrency,
+	)
+
+	return translateError(err)
+}
+
+// payOrder debits wallet of user with total of order, order priced in other currency than wallets hold
+// is ErrConflict
+func payOrder(ctx context.Context, db querier, orderId, userId, changedBy string) error {
+
+	order := &models.Order{Id: orderId}
+
+	rows, err := db.Query(ctx, "SELECT quantity, unit_price, currency FROM order_items WHERE order_id = $1 ORDER BY line", orderId)
+	if err != nil {
+		return translateError(err)
+	}
+
+	for rows.Next() {
+		item := &models.OrderItem{}
+
+		err = rows.Scan(&item.Quantity, &item.UnitPrice.Amount, &item.UnitPrice.Currency)
+		if err != nil {
+			rows.Close()
+			return translateError(err)
+		}
+
+		order.Items = append(order.Items, item)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return translateError(err)
+	}
+
+	err = storage.OrderTotals(order)
+	if err != nil {
+		return err
+	}
+
+	if order.Total.Amount == 0 {
+		return nil
+	}
+
+	if order.Total.Currency != models.WalletCurrency {
+		return fmt.Errorf("%w: order is priced in %s, wallets hold %s", storage.ErrConflict, order.Total.Currency, models.WalletCurrency)
+	}
+
+	return post(ctx, db, transfer{
+		userId:    userId,
+		account:   models.AccountRevenue,
+		kind:      models.LedgerOrderPayment,
+		orderId:   orderId,
+		createdBy: changedBy,
+		amount:    -order.Total.Amount,
+	})
+}
+
+// refundOrder credits wallet of user with what ledger says order took from it, orders paid before
+// the ledger existed took nothing
+func refundOrder(ctx context.Context, db querier, orderId, userId, changedBy string) error {
+
+	var paid int64
+
+	err := db.QueryRow(ctx, "SELECT COALESCE(-SUM(amount), 0) FROM ledger_entries WHERE order_id = $1 AND account = 'wallet'", orderId).
+		Scan(&paid)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if paid <= 0 {
+		return nil
+	}
+
+	return post(ctx, db, transfer{
+		userId:    userId,
+		account:   models.AccountRevenue,
+		kind:      models.LedgerOrderRefund,
+		orderId:   orderId,
+		createdBy: changedBy,
+		amount:    paid,
+	})
+}
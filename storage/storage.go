@@ -2,15 +2,26 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"crud/models"
 )
 
+// StorageI gives repos of every table. Delete of order, book and user repos marks row deleted, GetByPKey and
+// GetList skip it unless asked and PurgeDeleted removes it for good. Restore brings it back and returns row
+// that is not deleted as it is, like restored already
 type StorageI interface {
 	CloseDB()
 	Order() OrderRepoI
 	User() UserRepoI
 	Book() BookRepoI
+	Role() RoleRepoI
+	RefreshToken() RefreshTokenRepoI
+	Revocation() RevocationRepoI
+	Wallet() WalletRepoI
+
+	// WithTx runs fn so that everything it does through tx commits or rolls back together
+	WithTx(ctx context.Context, fn func(tx StorageI) error) error
 }
 
 type OrderRepoI interface {
@@ -18,7 +29,15 @@ type OrderRepoI interface {
 	GetByPKey(ctx context.Context, req *models.OrderPrimarKey) (*models.Order, error)
 	GetList(ctx context.Context, req *models.GetListOrderRequest) (*models.GetListOrderResponse, error)
 	Update(ctx context.Context, req *models.UpdateOrder) (int64, error)
+	Patch(ctx context.Context, req *models.PatchOrder) (*models.Order, error)
 	Delete(ctx context.Context, req *models.OrderPrimarKey) error
+	Restore(ctx context.Context, req *models.OrderPrimarKey) (*models.Order, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// Transition moves order along its status state machine, illegal move is ErrConflict
+	Transition(ctx context.Context, req *models.OrderTransition) (*models.Order, error)
+	GetStatusHistory(ctx context.Context, req *models.OrderPrimarKey) ([]*models.OrderStatusChange, error)
+	// ExpireReservations cancels pending orders whose stock reservation ended before expiredBefore
+	ExpireReservations(ctx context.Context, expiredBefore time.Time) (int64, error)
 }
 
 type BookRepoI interface {
@@ -26,7 +45,10 @@ type BookRepoI interface {
 	GetByPKey(ctx context.Context, req *models.BookPrimarKey) (*models.Book, error)
 	GetList(ctx context.Context, req *models.GetListBookRequest) (*models.GetListBookResponse, error)
 	Update(ctx context.Context, req *models.UpdateBook) (int64, error)
+	Patch(ctx context.Context, req *models.PatchBook) (*models.Book, error)
 	Delete(ctx context.Context, req *models.BookPrimarKey) error
+	Restore(ctx context.Context, req *models.BookPrimarKey) (*models.Book, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
 type UserRepoI interface {
@@ -34,5 +56,46 @@ type UserRepoI interface {
 	GetByPKey(ctx context.Context, req *models.UserPrimarKey) (*models.User, error)
 	GetList(ctx context.Context, req *models.GetListUserRequest) (*models.GetListUserResponse, error)
 	Update(ctx context.Context, req *models.UpdateUser) (int64, error)
+	Patch(ctx context.Context, req *models.PatchUser) (*models.User, error)
+	UpdatePassword(ctx context.Context, req *models.UpdateUserPassword) (int64, error)
 	Delete(ctx context.Context, req *models.UserPrimarKey) error
+	Restore(ctx context.Context, req *models.UserPrimarKey) (*models.User, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
+}
+
+type RoleRepoI interface {
+	Create(ctx context.Context, req *models.CreateRole) (string, error)
+	GetByPKey(ctx context.Context, req *models.RolePrimarKey) (*models.Role, error)
+	GetList(ctx context.Context, req *models.GetListRoleRequest) (*models.GetListRoleResponse, error)
+	Update(ctx context.Context, req *models.UpdateRole) (int64, error)
+	Delete(ctx context.Context, req *models.RolePrimarKey) error
+	AssignToUser(ctx context.Context, req *models.UserRole) error
+	RevokeFromUser(ctx context.Context, req *models.UserRole) error
+	GetUserRoles(ctx context.Context, userId string) ([]string, error)
+	HasPermission(ctx context.Context, role string, permission string) (bool, error)
+}
+
+type RefreshTokenRepoI interface {
+	Create(ctx context.Context, req *models.CreateRefreshToken) (string, error)
+	GetByPKey(ctx context.Context, req *models.RefreshTokenPrimarKey) (*models.RefreshToken, error)
+	Use(ctx context.Context, req *models.RefreshTokenPrimarKey) (int64, error)
+	RevokeFamily(ctx context.Context, familyId string) error
+	RevokeUser(ctx context.Context, userId string) error
+}
+
+type RevocationRepoI interface {
+	Revoke(ctx context.Context, req *models.RevokeToken) error
+	RevokeUser(ctx context.Context, req *models.RevokeUserTokens) error
+	GetActive(ctx context.Context) (*models.Revocations, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// WalletRepoI keeps balances of users in double-entry ledger. Wallet that would go below zero is ErrConflict
+type WalletRepoI interface {
+	GetBalance(ctx context.Context, req *models.UserPrimarKey) (*models.Wallet, error)
+	TopUp(ctx context.Context, req *models.WalletOperation) (*models.Wallet, error)
+	Withdraw(ctx context.Context, req *models.WalletOperation) (*models.Wallet, error)
+	GetLedger(ctx context.Context, req *models.GetLedgerRequest) (*models.GetLedgerResponse, error)
+	// Reconcile sets cached balance of every user to sum of their ledger entries and returns users it fixed
+	Reconcile(ctx context.Context) ([]*models.BalanceMismatch, error)
 }
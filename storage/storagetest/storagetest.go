@@ -0,0 +1,2108 @@
+// Package storagetest is the contract every storage.StorageI backend must satisfy.
+// Backends call Run from their own tests with a factory returning an empty store
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"crud/models"
+	"crud/storage"
+)
+
+// Factory returns empty store, it is called once per subtest
+type Factory func(t *testing.T) storage.StorageI
+
+func Run(t *testing.T, newStorage Factory) {
+	t.Run("Book", func(t *testing.T) { testBook(t, newStorage(t)) })
+	t.Run("BookNotFound", func(t *testing.T) { testBookNotFound(t, newStorage(t)) })
+	t.Run("BookInvalidInput", func(t *testing.T) { testBookInvalidInput(t, newStorage(t)) })
+	t.Run("BookPagination", func(t *testing.T) { testBookPagination(t, newStorage(t)) })
+	t.Run("BookPatch", func(t *testing.T) { testBookPatch(t, newStorage(t)) })
+	t.Run("BookVersion", func(t *testing.T) { testBookVersion(t, newStorage(t)) })
+	t.Run("BookCursor", func(t *testing.T) { testBookCursor(t, newStorage(t)) })
+	t.Run("BookFilter", func(t *testing.T) { testBookFilter(t, newStorage(t)) })
+	t.Run("User", func(t *testing.T) { testUser(t, newStorage(t)) })
+	t.Run("UserNotFound", func(t *testing.T) { testUserNotFound(t, newStorage(t)) })
+	t.Run("UserPagination", func(t *testing.T) { testUserPagination(t, newStorage(t)) })
+	t.Run("UserDuplicateLogin", func(t *testing.T) { testUserDuplicateLogin(t, newStorage(t)) })
+	t.Run("UserPatch", func(t *testing.T) { testUserPatch(t, newStorage(t)) })
+	t.Run("UserFilter", func(t *testing.T) { testUserFilter(t, newStorage(t)) })
+	t.Run("Order", func(t *testing.T) { testOrder(t, newStorage(t)) })
+	t.Run("OrderNotFound", func(t *testing.T) { testOrderNotFound(t, newStorage(t)) })
+	t.Run("OrderPagination", func(t *testing.T) { testOrderPagination(t, newStorage(t)) })
+	t.Run("OrderForeignKeys", func(t *testing.T) { testOrderForeignKeys(t, newStorage(t)) })
+	t.Run("OrderItems", func(t *testing.T) { testOrderItems(t, newStorage(t)) })
+	t.Run("OrderStatus", func(t *testing.T) { testOrderStatus(t, newStorage(t)) })
+	t.Run("Stock", func(t *testing.T) { testStock(t, newStorage(t)) })
+	t.Run("Wallet", func(t *testing.T) { testWallet(t, newStorage(t)) })
+	t.Run("Money", func(t *testing.T) { testMoney(t, newStorage(t)) })
+	t.Run("OrderPatch", func(t *testing.T) { testOrderPatch(t, newStorage(t)) })
+	t.Run("OrderFilter", func(t *testing.T) { testOrderFilter(t, newStorage(t)) })
+	t.Run("SoftDelete", func(t *testing.T) { testSoftDelete(t, newStorage(t)) })
+	t.Run("UserSoftDelete", func(t *testing.T) { testUserSoftDelete(t, newStorage(t)) })
+	t.Run("PurgeDeleted", func(t *testing.T) { testPurgeDeleted(t, newStorage(t)) })
+	t.Run("TxCommit", func(t *testing.T) { testTxCommit(t, newStorage(t)) })
+	t.Run("TxRollback", func(t *testing.T) { testTxRollback(t, newStorage(t)) })
+	t.Run("TxConcurrent", func(t *testing.T) { testTxConcurrent(t, newStorage(t)) })
+	t.Run("RefreshToken", func(t *testing.T) { testRefreshToken(t, newStorage(t)) })
+	t.Run("Revocation", func(t *testing.T) { testRevocation(t, newStorage(t)) })
+	t.Run("Role", func(t *testing.T) { testRole(t, newStorage(t)) })
+}
+
+func testBook(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	id, err := strg.Book().Create(ctx, &models.CreateBook{Name: "Dune", AuthorName: "Frank Herbert", Price: usd(120), Date: "1965"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if _, err = uuid.Parse(id); err != nil {
+		t.Fatalf("Create returned id %q, want UUID", id)
+	}
+
+	book, err := strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	if book.Id != id || book.Name != "Dune" || book.AuthorName != "Frank Herbert" || book.Price != usd(120) || book.Date != "1965" {
+		t.Fatalf("GetByPKey returned %+v", book)
+	}
+
+	if book.CreatedAt == "" || book.UpdatedAt == "" {
+		t.Fatalf("GetByPKey returned empty timestamps %+v", book)
+	}
+
+	rows, err := strg.Book().Update(ctx, &models.UpdateBook{Id: id, Name: "Dune Messiah", AuthorName: "Frank Herbert", Price: usd(150), Date: "1969"})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if rows != 1 {
+		t.Fatalf("Update affected %d rows, want 1", rows)
+	}
+
+	book, err = strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey after Update: %v", err)
+	}
+
+	if book.Name != "Dune Messiah" || book.Price != usd(150) || book.Date != "1969" {
+		t.Fatalf("GetByPKey after Update returned %+v", book)
+	}
+
+	err = strg.Book().Delete(ctx, &models.BookPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	_, err = strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey after Delete returned %v, want not found", err)
+	}
+}
+
+func testBookNotFound(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+	id := uuid.New().String()
+
+	_, err := strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey returned %v, want not found", err)
+	}
+
+	rows, err := strg.Book().Update(ctx, &models.UpdateBook{Id: id, Name: "x", Price: usd(1), Date: "2000"})
+	if err != nil || rows != 0 {
+		t.Fatalf("Update returned %d, %v, want 0 rows", rows, err)
+	}
+
+	err = strg.Book().Delete(ctx, &models.BookPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Delete returned %v, want not found", err)
+	}
+}
+
+func testBookInvalidInput(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	_, err := strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: "not-a-uuid"})
+	if !errors.Is(err, storage.ErrInvalidInput) {
+		t.Fatalf("GetByPKey with malformed id returned %v, want invalid input", err)
+	}
+
+	for _, price := range []models.Money{{Amount: 10}, {Amount: 10, Currency: "usd"}, {Amount: 10, Currency: "DOLLAR"}, usd(-1), usd(1 << 31)} {
+		_, err = strg.Book().Create(ctx, &models.CreateBook{Name: "x", Price: price, Date: "2000"})
+		if !errors.Is(err, storage.ErrInvalidInput) {
+			t.Fatalf("Create with price %+v returned %v, want invalid input", price, err)
+		}
+	}
+}
+
+func testBookPagination(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	created := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		id := createBook(t, strg)
+		created[id] = true
+	}
+
+	seen := map[string]bool{}
+	for _, p := range []struct {
+		offset, limit int32
+		count, books  int
+	}{
+		{offset: 0, limit: 2, count: 3, books: 2},
+		{offset: 2, limit: 2, count: 3, books: 1},
+		{offset: 3, limit: 2, count: 0, books: 0},
+	} {
+		resp, err := strg.Book().GetList(ctx, &models.GetListBookRequest{Offset: p.offset, Limit: p.limit})
+		if err != nil {
+			t.Fatalf("GetList offset %d: %v", p.offset, err)
+		}
+
+		if countOf(resp.Count) != p.count || len(resp.Books) != p.books {
+			t.Fatalf("GetList offset %d limit %d returned count %d and %d books, want %d and %d",
+				p.offset, p.limit, countOf(resp.Count), len(resp.Books), p.count, p.books)
+		}
+
+		for _, book := range resp.Books {
+			if seen[book.Id] || !created[book.Id] {
+				t.Fatalf("GetList offset %d returned unexpected or repeated book %s", p.offset, book.Id)
+			}
+			seen[book.Id] = true
+		}
+	}
+}
+
+func testBookPatch(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	id := createBook(t, strg)
+
+	before, err := strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	price := models.Money{Amount: 25, Currency: "EUR"}
+
+	book, err := strg.Book().Patch(ctx, &models.PatchBook{Id: id, Price: &price})
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+
+	if book.Price != price || book.Name != before.Name || book.AuthorName != before.AuthorName || book.Date != before.Date {
+		t.Fatalf("Patch of price returned %+v, want only price of %+v changed", book, before)
+	}
+
+	got, err := strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, book) {
+		t.Fatalf("GetByPKey returned %+v, want patched %+v", got, book)
+	}
+
+	unchanged, err := strg.Book().Patch(ctx, &models.PatchBook{Id: id})
+	if err != nil || !reflect.DeepEqual(unchanged, book) {
+		t.Fatalf("empty Patch returned %+v, %v, want %+v", unchanged, err, book)
+	}
+
+	_, err = strg.Book().Patch(ctx, &models.PatchBook{Id: uuid.New().String(), Price: &price})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Patch of missing book returned %v, want not found", err)
+	}
+
+	price = models.Money{Amount: 25}
+
+	_, err = strg.Book().Patch(ctx, &models.PatchBook{Id: id, Price: &price})
+	if !errors.Is(err, storage.ErrInvalidInput) {
+		t.Fatalf("Patch with invalid price returned %v, want invalid input", err)
+	}
+}
+
+func testBookVersion(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	id := createBook(t, strg)
+
+	book, err := strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	if book.Version != 1 {
+		t.Fatalf("new book has version %d, want 1", book.Version)
+	}
+
+	rows, err := strg.Book().Update(ctx, &models.UpdateBook{Id: id, Name: "a", Price: usd(1), Date: "2000", Version: 1})
+	if err != nil || rows != 1 {
+		t.Fatalf("Update of version 1 returned %d, %v, want 1 row", rows, err)
+	}
+
+	_, err = strg.Book().Update(ctx, &models.UpdateBook{Id: id, Name: "b", Price: usd(1), Date: "2000", Version: 1})
+	if !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Fatalf("Update of stale version returned %v, want version mismatch", err)
+	}
+
+	price := usd(2)
+
+	_, err = strg.Book().Patch(ctx, &models.PatchBook{Id: id, Price: &price, Version: 1})
+	if !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Fatalf("Patch of stale version returned %v, want version mismatch", err)
+	}
+
+	_, err = strg.Book().Patch(ctx, &models.PatchBook{Id: id, Version: 1})
+	if !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Fatalf("empty Patch of stale version returned %v, want version mismatch", err)
+	}
+
+	book, err = strg.Book().Patch(ctx, &models.PatchBook{Id: id, Price: &price, Version: 2})
+	if err != nil || book.Version != 3 || book.Name != "a" {
+		t.Fatalf("Patch of version 2 returned %+v, %v, want version 3 named a", book, err)
+	}
+
+	err = strg.Book().Delete(ctx, &models.BookPrimarKey{Id: id, Version: 2})
+	if !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Fatalf("Delete of stale version returned %v, want version mismatch", err)
+	}
+
+	err = strg.Book().Delete(ctx, &models.BookPrimarKey{Id: id, Version: 3})
+	if err != nil {
+		t.Fatalf("Delete of version 3: %v", err)
+	}
+
+	rows, err = strg.Book().Update(ctx, &models.UpdateBook{Id: id, Name: "a", Price: usd(1), Date: "2000", Version: 3})
+	if err != nil || rows != 0 {
+		t.Fatalf("Update of deleted book returned %d, %v, want 0 rows", rows, err)
+	}
+
+	err = strg.Book().Delete(ctx, &models.BookPrimarKey{Id: id, Version: 3})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Delete of deleted book returned %v, want not found", err)
+	}
+}
+
+func testBookCursor(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	created := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		created[createBook(t, strg)] = true
+	}
+
+	// first page comes from offset mode, which hands out cursor as well
+	resp, err := strg.Book().GetList(ctx, &models.GetListBookRequest{Limit: 2})
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+
+	if countOf(resp.Count) != 5 || len(resp.Books) != 2 || resp.Next == nil {
+		t.Fatalf("GetList returned count %d, %d books and next %v, want 5, 2 and cursor", countOf(resp.Count), len(resp.Books), resp.Next)
+	}
+
+	var (
+		seen  = map[string]bool{}
+		pages = 1
+		added = false
+	)
+
+	for {
+		for _, book := range resp.Books {
+			if seen[book.Id] {
+				t.Fatalf("GetList returned book %s twice", book.Id)
+			}
+			seen[book.Id] = true
+		}
+
+		if resp.Next == nil {
+			break
+		}
+
+		// rows inserted while paging come last and are neither skipped nor repeated
+		if !added {
+			created[createBook(t, strg)] = true
+			added = true
+		}
+
+		resp, err = strg.Book().GetList(ctx, &models.GetListBookRequest{Limit: 2, After: resp.Next, WithCount: pages == 1})
+		if err != nil {
+			t.Fatalf("GetList after cursor: %v", err)
+		}
+
+		if pages == 1 && countOf(resp.Count) != 6 {
+			t.Fatalf("GetList after cursor with count returned count %d, want 6", countOf(resp.Count))
+		}
+
+		if pages > 1 && resp.Count != nil {
+			t.Fatalf("GetList after cursor returned count %d without asking", countOf(resp.Count))
+		}
+
+		pages++
+	}
+
+	if !reflect.DeepEqual(seen, created) || pages != 3 {
+		t.Fatalf("cursor pages returned %d books in %d pages, want %d in 3", len(seen), pages, len(created))
+	}
+
+	_, err = strg.Book().GetList(ctx, &models.GetListBookRequest{
+		After: &models.Cursor{CreatedAt: time.Now().UTC().Format(time.RFC3339Nano), Id: uuid.New().String()},
+		Sort:  []models.SortField{{Field: "name"}},
+	})
+	if !errors.Is(err, storage.ErrInvalidInput) {
+		t.Fatalf("GetList with cursor and sort returned %v, want invalid input", err)
+	}
+}
+
+func testBookFilter(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	for _, book := range []models.CreateBook{
+		{Name: "Dune", AuthorName: "Frank Herbert", Price: usd(120), Date: "1965"},
+		{Name: "Children of Dune", AuthorName: "Frank Herbert", Price: usd(90), Date: "1976"},
+		{Name: "Solaris", AuthorName: "Stanislaw Lem", Price: usd(90), Date: "1961"},
+		{Name: "100% Coverage", AuthorName: "Nobody", Price: usd(10), Date: "2020"},
+	} {
+		_, err := strg.Book().Create(ctx, &book)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	var (
+		min = int32(50)
+		max = int32(100)
+	)
+
+	for _, c := range []struct {
+		name string
+		req  models.GetListBookRequest
+		want []string
+	}{
+		{"search", models.GetListBookRequest{Search: "dune", Sort: []models.SortField{{Field: "name"}}}, []string{"Children of Dune", "Dune"}},
+		{"search matches % literally", models.GetListBookRequest{Search: "0%"}, []string{"100% Coverage"}},
+		{"author", models.GetListBookRequest{AuthorName: "frank herbert", Sort: []models.SortField{{Field: "price"}}}, []string{"Children of Dune", "Dune"}},
+		{"price range", models.GetListBookRequest{PriceMin: &min, PriceMax: &max, Sort: []models.SortField{{Field: "name"}}}, []string{"Children of Dune", "Solaris"}},
+		{"sort", models.GetListBookRequest{Sort: []models.SortField{{Field: "price", Desc: true}, {Field: "name"}}}, []string{"Dune", "Children of Dune", "Solaris", "100% Coverage"}},
+		{"created in future", models.GetListBookRequest{CreatedFrom: time.Now().Add(time.Hour)}, nil},
+	} {
+		resp, err := strg.Book().GetList(ctx, &c.req)
+		if err != nil {
+			t.Fatalf("%s: GetList: %v", c.name, err)
+		}
+
+		var got []string
+		for _, book := range resp.Books {
+			got = append(got, book.Name)
+		}
+
+		if !reflect.DeepEqual(got, c.want) || countOf(resp.Count) != len(c.want) {
+			t.Fatalf("%s: GetList returned %q with count %d, want %q", c.name, got, countOf(resp.Count), c.want)
+		}
+	}
+
+	_, err := strg.Book().GetList(ctx, &models.GetListBookRequest{Sort: []models.SortField{{Field: "name; DROP TABLE book"}}})
+	if !errors.Is(err, storage.ErrInvalidInput) {
+		t.Fatalf("GetList with unknown sort field returned %v, want invalid input", err)
+	}
+}
+
+func testUser(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	id, err := strg.User().Create(ctx, &models.CreateUser{
+		FirstName: "Ada", LastName: "Lovelace", Login: "ada", Password: "hash", PhoneNumber: "+100",
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if _, err = uuid.Parse(id); err != nil {
+		t.Fatalf("Create returned id %q, want UUID", id)
+	}
+
+	user, err := strg.User().GetByPKey(ctx, &models.UserPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	if user.Id != id || user.FirstName != "Ada" || user.Login != "ada" || user.Password != "hash" || user.PhoneNumber != "+100" {
+		t.Fatalf("GetByPKey returned %+v", user)
+	}
+
+	user, err = strg.User().GetByPKey(ctx, &models.UserPrimarKey{Login: "ada"})
+	if err != nil {
+		t.Fatalf("GetByPKey by login: %v", err)
+	}
+
+	if user.Id != id {
+		t.Fatalf("GetByPKey by login returned %s, want %s", user.Id, id)
+	}
+
+	rows, err := strg.User().Update(ctx, &models.UpdateUser{
+		Id: id, FirstName: "Augusta", LastName: "King", Login: "augusta", Password: "hash2", PhoneNumber: "+200",
+	})
+	if err != nil || rows != 1 {
+		t.Fatalf("Update returned %d, %v, want 1 row", rows, err)
+	}
+
+	rows, err = strg.User().UpdatePassword(ctx, &models.UpdateUserPassword{Id: id, Password: "hash3"})
+	if err != nil || rows != 1 {
+		t.Fatalf("UpdatePassword returned %d, %v, want 1 row", rows, err)
+	}
+
+	user, err = strg.User().GetByPKey(ctx, &models.UserPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey after Update: %v", err)
+	}
+
+	if user.FirstName != "Augusta" || user.Login != "augusta" || user.Password != "hash3" || user.PhoneNumber != "+200" {
+		t.Fatalf("GetByPKey after Update returned %+v", user)
+	}
+
+	err = strg.User().Delete(ctx, &models.UserPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	_, err = strg.User().GetByPKey(ctx, &models.UserPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey after Delete returned %v, want not found", err)
+	}
+}
+
+func testUserNotFound(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+	id := uuid.New().String()
+
+	_, err := strg.User().GetByPKey(ctx, &models.UserPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey returned %v, want not found", err)
+	}
+
+	_, err = strg.User().GetByPKey(ctx, &models.UserPrimarKey{Login: "nobody"})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey by login returned %v, want not found", err)
+	}
+
+	rows, err := strg.User().Update(ctx, &models.UpdateUser{Id: id, Login: "nobody"})
+	if err != nil || rows != 0 {
+		t.Fatalf("Update returned %d, %v, want 0 rows", rows, err)
+	}
+
+	rows, err = strg.User().UpdatePassword(ctx, &models.UpdateUserPassword{Id: id, Password: "x"})
+	if err != nil || rows != 0 {
+		t.Fatalf("UpdatePassword returned %d, %v, want 0 rows", rows, err)
+	}
+
+	err = strg.User().Delete(ctx, &models.UserPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Delete returned %v, want not found", err)
+	}
+}
+
+func testUserPagination(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	for i := 0; i < 6; i++ {
+		createUser(t, strg)
+	}
+
+	// users default to LIMIT 5
+	resp, err := strg.User().GetList(ctx, &models.GetListUserRequest{})
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+
+	if countOf(resp.Count) != 6 || len(resp.Users) != 5 {
+		t.Fatalf("GetList returned count %d and %d users, want 6 and 5", countOf(resp.Count), len(resp.Users))
+	}
+
+	resp, err = strg.User().GetList(ctx, &models.GetListUserRequest{Offset: 5, Limit: 5})
+	if err != nil {
+		t.Fatalf("GetList offset 5: %v", err)
+	}
+
+	if countOf(resp.Count) != 6 || len(resp.Users) != 1 {
+		t.Fatalf("GetList offset 5 returned count %d and %d users, want 6 and 1", countOf(resp.Count), len(resp.Users))
+	}
+}
+
+func testUserDuplicateLogin(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	_, err := strg.User().Create(ctx, &models.CreateUser{FirstName: "A", LastName: "B", Login: "same", Password: "x", PhoneNumber: "1"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	_, err = strg.User().Create(ctx, &models.CreateUser{FirstName: "C", LastName: "D", Login: "same", Password: "y", PhoneNumber: "2"})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Create with duplicate login returned %v, want conflict", err)
+	}
+
+	id, err := strg.User().Create(ctx, &models.CreateUser{FirstName: "E", LastName: "F", Login: "other", Password: "z", PhoneNumber: "3"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	_, err = strg.User().Update(ctx, &models.UpdateUser{Id: id, FirstName: "E", LastName: "F", Login: "same", Password: "z", PhoneNumber: "3"})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Update to duplicate login returned %v, want conflict", err)
+	}
+}
+
+func testUserPatch(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var (
+		id    = createUser(t, strg)
+		other = createUser(t, strg)
+		name  = "Changed"
+	)
+
+	user, err := strg.User().Patch(ctx, &models.PatchUser{Id: id, FirstName: &name})
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+
+	if user.FirstName != name || user.LastName != "Last" || user.Password != "x" {
+		t.Fatalf("Patch of first name returned %+v, want only first name changed", user)
+	}
+
+	taken, err := strg.User().GetByPKey(ctx, &models.UserPrimarKey{Id: other})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	_, err = strg.User().Patch(ctx, &models.PatchUser{Id: id, Login: &taken.Login})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Patch to taken login returned %v, want conflict", err)
+	}
+}
+
+func testUserFilter(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	for _, user := range []models.CreateUser{
+		{FirstName: "Ada", LastName: "Lovelace", Login: "ada", Password: "x", PhoneNumber: "+100"},
+		{FirstName: "Alan", LastName: "Turing", Login: "alan", Password: "x", PhoneNumber: "+200"},
+		{FirstName: "Grace", LastName: "Hopper", Login: "grace", Password: "x", PhoneNumber: "+300"},
+	} {
+		_, err := strg.User().Create(ctx, &user)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	for _, c := range []struct {
+		name string
+		req  models.GetListUserRequest
+		want []string
+	}{
+		{"search", models.GetListUserRequest{Search: "A", Sort: []models.SortField{{Field: "login", Desc: true}}}, []string{"grace", "alan", "ada"}},
+		{"search phone", models.GetListUserRequest{Search: "+2"}, []string{"alan"}},
+		{"login", models.GetListUserRequest{Login: "grace"}, []string{"grace"}},
+	} {
+		resp, err := strg.User().GetList(ctx, &c.req)
+		if err != nil {
+			t.Fatalf("%s: GetList: %v", c.name, err)
+		}
+
+		var got []string
+		for _, user := range resp.Users {
+			got = append(got, user.Login)
+		}
+
+		if !reflect.DeepEqual(got, c.want) || countOf(resp.Count) != len(c.want) {
+			t.Fatalf("%s: GetList returned %q with count %d, want %q", c.name, got, countOf(resp.Count), c.want)
+		}
+	}
+}
+
+func testOrder(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var (
+		bookId  = createBook(t, strg)
+		userId  = createUser(t, strg)
+		otherId = createUser(t, strg)
+	)
+
+	id, err := strg.Order().Create(ctx, &models.CreateOrder{BookId: bookId, UserId: userId})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	order, err := strg.Order().GetByPKey(ctx, &models.OrderPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	if order.Id != id || order.UserId != userId || order.CreatedAt == "" || len(order.Items) != 1 || order.Items[0].BookId != bookId {
+		t.Fatalf("GetByPKey returned %+v", order)
+	}
+
+	rows, err := strg.Order().Update(ctx, &models.UpdateOrder{Id: id, UserId: otherId})
+	if err != nil || rows != 1 {
+		t.Fatalf("Update returned %d, %v, want 1 row", rows, err)
+	}
+
+	order, err = strg.Order().GetByPKey(ctx, &models.OrderPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey after Update: %v", err)
+	}
+
+	if order.UserId != otherId || len(order.Items) != 1 {
+		t.Fatalf("GetByPKey after Update returned %+v, want user %s and its item", order, otherId)
+	}
+
+	err = strg.Order().Delete(ctx, &models.OrderPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	_, err = strg.Order().GetByPKey(ctx, &models.OrderPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey after Delete returned %v, want not found", err)
+	}
+}
+
+func testOrderNotFound(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+	id := uuid.New().String()
+
+	_, err := strg.Order().GetByPKey(ctx, &models.OrderPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey returned %v, want not found", err)
+	}
+
+	rows, err := strg.Order().Update(ctx, &models.UpdateOrder{Id: id, UserId: createUser(t, strg)})
+	if err != nil || rows != 0 {
+		t.Fatalf("Update returned %d, %v, want 0 rows", rows, err)
+	}
+
+	err = strg.Order().Delete(ctx, &models.OrderPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Delete returned %v, want not found", err)
+	}
+}
+
+func testOrderPagination(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var (
+		bookId = createBook(t, strg)
+		userId = createUser(t, strg)
+	)
+
+	for i := 0; i < 4; i++ {
+		_, err := strg.Order().Create(ctx, &models.CreateOrder{BookId: bookId, UserId: userId})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	for _, p := range []struct {
+		offset, limit int32
+		count, orders int
+	}{
+		{offset: 0, limit: 4, count: 4, orders: 4},
+		{offset: 3, limit: 4, count: 4, orders: 1},
+		{offset: 4, limit: 4, count: 0, orders: 0},
+	} {
+		resp, err := strg.Order().GetList(ctx, &models.GetListOrderRequest{Offset: p.offset, Limit: p.limit})
+		if err != nil {
+			t.Fatalf("GetList offset %d: %v", p.offset, err)
+		}
+
+		if countOf(resp.Count) != p.count || len(resp.Orders) != p.orders {
+			t.Fatalf("GetList offset %d limit %d returned count %d and %d orders, want %d and %d",
+				p.offset, p.limit, countOf(resp.Count), len(resp.Orders), p.count, p.orders)
+		}
+	}
+}
+
+func testOrderPatch(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var (
+		bookId = createBook(t, strg)
+		userId = createUser(t, strg)
+	)
+
+	id, err := strg.Order().Create(ctx, &models.CreateOrder{BookId: bookId, UserId: userId})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	other := createUser(t, strg)
+
+	order, err := strg.Order().Patch(ctx, &models.PatchOrder{Id: id, UserId: &other})
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+
+	if order.UserId != other || len(order.Items) != 1 || order.Items[0].BookId != bookId {
+		t.Fatalf("Patch of user returned %+v, want user %s and book %s", order, other, bookId)
+	}
+
+	missing := uuid.New().String()
+
+	_, err = strg.Order().Patch(ctx, &models.PatchOrder{Id: id, UserId: &missing})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("Patch to missing user returned %v, want foreign key violation", err)
+	}
+}
+
+func testOrderFilter(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var (
+		bookId = createBook(t, strg)
+		userId = createUser(t, strg)
+		other  = createUser(t, strg)
+		want   = map[string]bool{}
+	)
+
+	for _, user := range []string{userId, other, userId} {
+		id, err := strg.Order().Create(ctx, &models.CreateOrder{BookId: bookId, UserId: user})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		if user == userId {
+			want[id] = true
+		}
+	}
+
+	resp, err := strg.Order().GetList(ctx, &models.GetListOrderRequest{UserId: userId, Sort: []models.SortField{{Field: "created_at", Desc: true}}})
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+
+	if countOf(resp.Count) != 2 || len(resp.Orders) != 2 {
+		t.Fatalf("GetList returned count %d and %d orders, want 2", countOf(resp.Count), len(resp.Orders))
+	}
+
+	for _, order := range resp.Orders {
+		if !want[order.Id] {
+			t.Fatalf("GetList returned order %s of other user", order.Id)
+		}
+	}
+}
+
+func testOrderForeignKeys(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var (
+		bookId = createBook(t, strg)
+		userId = createUser(t, strg)
+	)
+
+	_, err := strg.Order().Create(ctx, &models.CreateOrder{BookId: uuid.New().String(), UserId: userId})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("Create with missing book returned %v, want foreign key violation", err)
+	}
+
+	_, err = strg.Order().Create(ctx, &models.CreateOrder{BookId: bookId, UserId: uuid.New().String()})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("Create with missing user returned %v, want foreign key violation", err)
+	}
+
+	id, err := strg.Order().Create(ctx, &models.CreateOrder{BookId: bookId, UserId: userId})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	_, err = strg.Order().Update(ctx, &models.UpdateOrder{Id: id, UserId: uuid.New().String()})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("Update to missing user returned %v, want foreign key violation", err)
+	}
+
+	// deleted book and user keep their orders but take no new ones
+	err = strg.Book().Delete(ctx, &models.BookPrimarKey{Id: bookId})
+	if err != nil {
+		t.Fatalf("Delete of ordered book: %v", err)
+	}
+
+	_, err = strg.Order().Create(ctx, &models.CreateOrder{BookId: bookId, UserId: userId})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("Create with deleted book returned %v, want foreign key violation", err)
+	}
+
+	err = strg.User().Delete(ctx, &models.UserPrimarKey{Id: userId})
+	if err != nil {
+		t.Fatalf("Delete of user with orders: %v", err)
+	}
+
+	_, err = strg.Order().Patch(ctx, &models.PatchOrder{Id: id, UserId: &userId})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("Patch to deleted user returned %v, want foreign key violation", err)
+	}
+
+	_, err = strg.Order().GetByPKey(ctx, &models.OrderPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey of order with deleted book and user: %v", err)
+	}
+}
+
+func testOrderItems(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	userId := createUser(t, strg)
+
+	dune, err := strg.Book().Create(ctx, &models.CreateBook{Name: "Dune", AuthorName: "Frank Herbert", Price: usd(120), Date: "1965", Stock: 10})
+	if err != nil {
+		t.Fatalf("create book: %v", err)
+	}
+
+	emma, err := strg.Book().Create(ctx, &models.CreateBook{Name: "Emma", AuthorName: "Jane Austen", Price: usd(15), Date: "1815", Stock: 10})
+	if err != nil {
+		t.Fatalf("create book: %v", err)
+	}
+
+	id, err := strg.Order().Create(ctx, &models.CreateOrder{
+		UserId: userId,
+		Items: []*models.CreateOrderItem{
+			{BookId: dune, Quantity: 2},
+			{BookId: emma, Quantity: 3},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// later price changes leave order alone
+	_, err = strg.Book().Update(ctx, &models.UpdateBook{Id: dune, Name: "Dune", AuthorName: "Frank Herbert", Price: usd(999), Date: "1965", Stock: 8})
+	if err != nil {
+		t.Fatalf("Update book: %v", err)
+	}
+
+	order, err := strg.Order().GetByPKey(ctx, &models.OrderPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	want := []models.OrderItem{
+		{BookId: dune, Quantity: 2, UnitPrice: usd(120), Total: usd(240)},
+		{BookId: emma, Quantity: 3, UnitPrice: usd(15), Total: usd(45)},
+	}
+
+	if len(order.Items) != len(want) || order.Total != usd(285) {
+		t.Fatalf("GetByPKey returned %d items and total %+v, want %d and 285", len(order.Items), order.Total, len(want))
+	}
+
+	for i, item := range order.Items {
+		if *item != want[i] {
+			t.Fatalf("GetByPKey returned item %d %+v, want %+v", i, *item, want[i])
+		}
+	}
+
+	for _, c := range []struct {
+		name  string
+		order *models.CreateOrder
+	}{
+		{"no items", &models.CreateOrder{UserId: userId}},
+		{"zero quantity", &models.CreateOrder{UserId: userId, Items: []*models.CreateOrderItem{{BookId: dune}}}},
+		{"book twice", &models.CreateOrder{UserId: userId, Items: []*models.CreateOrderItem{{BookId: dune, Quantity: 1}, {BookId: dune, Quantity: 1}}}},
+		{"book_id and items", &models.CreateOrder{UserId: userId, BookId: emma, Items: []*models.CreateOrderItem{{BookId: dune, Quantity: 1}}}},
+	} {
+		_, err = strg.Order().Create(ctx, c.order)
+		if !errors.Is(err, storage.ErrInvalidInput) {
+			t.Fatalf("Create with %s returned %v, want invalid input", c.name, err)
+		}
+	}
+
+	// missing book of second item leaves nothing behind
+	_, err = strg.Order().Create(ctx, &models.CreateOrder{
+		UserId: userId,
+		Items: []*models.CreateOrderItem{
+			{BookId: dune, Quantity: 1},
+			{BookId: uuid.New().String(), Quantity: 1},
+		},
+	})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("Create with missing book returned %v, want foreign key violation", err)
+	}
+
+	resp, err := strg.Order().GetList(ctx, &models.GetListOrderRequest{BookId: emma})
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+
+	if countOf(resp.Count) != 1 || len(resp.Orders) != 1 || resp.Orders[0].Total != usd(285) || len(resp.Orders[0].Items) != 2 {
+		t.Fatalf("GetList by book of second item returned count %d, %+v", countOf(resp.Count), resp.Orders)
+	}
+
+	resp, err = strg.Order().GetList(ctx, &models.GetListOrderRequest{})
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+
+	if countOf(resp.Count) != 1 {
+		t.Fatalf("GetList returned count %d after failed Create, want 1", countOf(resp.Count))
+	}
+}
+
+func testSoftDelete(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var (
+		id    = createBook(t, strg)
+		other = createBook(t, strg)
+	)
+
+	err := strg.Book().Delete(ctx, &models.BookPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	err = strg.Book().Delete(ctx, &models.BookPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("second Delete returned %v, want not found", err)
+	}
+
+	_, err = strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey of deleted book returned %v, want not found", err)
+	}
+
+	book, err := strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: id, IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("GetByPKey with deleted: %v", err)
+	}
+
+	if book.DeletedAt == "" || book.Version != 2 {
+		t.Fatalf("GetByPKey with deleted returned %+v, want deleted_at and version 2", book)
+	}
+
+	rows, err := strg.Book().Update(ctx, &models.UpdateBook{Id: id, Name: "Book", AuthorName: "Author", Price: usd(10), Date: "2000"})
+	if err != nil || rows != 0 {
+		t.Fatalf("Update of deleted book returned %d rows, %v, want 0 rows", rows, err)
+	}
+
+	name := "Patched"
+
+	_, err = strg.Book().Patch(ctx, &models.PatchBook{Id: id, Name: &name})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Patch of deleted book returned %v, want not found", err)
+	}
+
+	resp, err := strg.Book().GetList(ctx, &models.GetListBookRequest{})
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+
+	if countOf(resp.Count) != 1 || len(resp.Books) != 1 || resp.Books[0].Id != other {
+		t.Fatalf("GetList returned %d books, count %d, want only live one", len(resp.Books), countOf(resp.Count))
+	}
+
+	resp, err = strg.Book().GetList(ctx, &models.GetListBookRequest{IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("GetList with deleted: %v", err)
+	}
+
+	if countOf(resp.Count) != 2 || len(resp.Books) != 2 {
+		t.Fatalf("GetList with deleted returned %d books, count %d, want 2", len(resp.Books), countOf(resp.Count))
+	}
+
+	book, err = strg.Book().Restore(ctx, &models.BookPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	if book.DeletedAt != "" || book.Version != 3 {
+		t.Fatalf("Restore returned %+v, want no deleted_at and version 3", book)
+	}
+
+	book, err = strg.Book().Restore(ctx, &models.BookPrimarKey{Id: id})
+	if err != nil || book.Version != 3 {
+		t.Fatalf("Restore of live book returned %+v, %v, want it unchanged", book, err)
+	}
+
+	_, err = strg.Book().Restore(ctx, &models.BookPrimarKey{Id: uuid.New().String()})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Restore of missing book returned %v, want not found", err)
+	}
+}
+
+func testUserSoftDelete(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	user := &models.CreateUser{FirstName: "First", LastName: "Last", Login: "reused", Password: "x", PhoneNumber: "1"}
+
+	id, err := strg.User().Create(ctx, user)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	err = strg.User().Delete(ctx, &models.UserPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	_, err = strg.User().GetByPKey(ctx, &models.UserPrimarKey{Login: "reused"})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey by login of deleted user returned %v, want not found", err)
+	}
+
+	// login of deleted user can be taken, then the deleted one cannot come back
+	_, err = strg.User().Create(ctx, user)
+	if err != nil {
+		t.Fatalf("Create with login of deleted user: %v", err)
+	}
+
+	_, err = strg.User().Restore(ctx, &models.UserPrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Restore with taken login returned %v, want conflict", err)
+	}
+}
+
+func testPurgeDeleted(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var (
+		bookId  = createBook(t, strg)
+		userId  = createUser(t, strg)
+		spareId = createBook(t, strg)
+	)
+
+	orderId, err := strg.Order().Create(ctx, &models.CreateOrder{BookId: bookId, UserId: userId})
+	if err != nil {
+		t.Fatalf("Create order: %v", err)
+	}
+
+	for _, id := range []string{bookId, spareId} {
+		err = strg.Book().Delete(ctx, &models.BookPrimarKey{Id: id})
+		if err != nil {
+			t.Fatalf("Delete book: %v", err)
+		}
+	}
+
+	err = strg.User().Delete(ctx, &models.UserPrimarKey{Id: userId})
+	if err != nil {
+		t.Fatalf("Delete user: %v", err)
+	}
+
+	n, err := strg.Book().PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+	if err != nil || n != 0 {
+		t.Fatalf("PurgeDeleted before retention purged %d, %v, want 0", n, err)
+	}
+
+	// ordered book and user stay while their order is kept
+	future := time.Now().Add(time.Hour)
+
+	n, err = strg.Book().PurgeDeleted(ctx, future)
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeDeleted purged %d books, %v, want 1", n, err)
+	}
+
+	n, err = strg.User().PurgeDeleted(ctx, future)
+	if err != nil || n != 0 {
+		t.Fatalf("PurgeDeleted purged %d ordered users, %v, want 0", n, err)
+	}
+
+	_, err = strg.Book().Restore(ctx, &models.BookPrimarKey{Id: spareId})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Restore of purged book returned %v, want not found", err)
+	}
+
+	err = strg.Order().Delete(ctx, &models.OrderPrimarKey{Id: orderId})
+	if err != nil {
+		t.Fatalf("Delete order: %v", err)
+	}
+
+	n, err = strg.Order().PurgeDeleted(ctx, future)
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeDeleted purged %d orders, %v, want 1", n, err)
+	}
+
+	n, err = strg.Book().PurgeDeleted(ctx, future)
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeDeleted purged %d books after order, %v, want 1", n, err)
+	}
+
+	n, err = strg.User().PurgeDeleted(ctx, future)
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeDeleted purged %d users after order, %v, want 1", n, err)
+	}
+}
+
+func testTxCommit(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var orderId string
+
+	err := strg.WithTx(ctx, func(tx storage.StorageI) error {
+		bookId := createBook(t, tx)
+		userId := createUser(t, tx)
+
+		// nested WithTx joins the running transaction
+		return tx.WithTx(ctx, func(tx storage.StorageI) error {
+			var err error
+			orderId, err = tx.Order().Create(ctx, &models.CreateOrder{BookId: bookId, UserId: userId})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	_, err = strg.Order().GetByPKey(ctx, &models.OrderPrimarKey{Id: orderId})
+	if err != nil {
+		t.Fatalf("GetByPKey of order created in committed tx: %v", err)
+	}
+}
+
+func testTxRollback(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var (
+		bookId string
+		failed = errors.New("failed")
+	)
+
+	err := strg.WithTx(ctx, func(tx storage.StorageI) error {
+		bookId = createBook(t, tx)
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("WithTx returned %v, want error of fn", err)
+	}
+
+	_, err = strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: bookId})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey of book created in rolled back tx returned %v, want not found", err)
+	}
+
+	var userId string
+
+	err = strg.WithTx(ctx, func(tx storage.StorageI) error {
+		userId = createUser(t, tx)
+		_, err := tx.Order().Create(ctx, &models.CreateOrder{BookId: uuid.New().String(), UserId: userId})
+		return err
+	})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("WithTx returned %v, want foreign key violation", err)
+	}
+
+	_, err = strg.User().GetByPKey(ctx, &models.UserPrimarKey{Id: userId})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey of user created in rolled back tx returned %v, want not found", err)
+	}
+}
+
+func testTxConcurrent(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	const workers = 8
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, workers)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- strg.WithTx(ctx, func(tx storage.StorageI) error {
+				_, err := tx.Book().Create(ctx, &models.CreateBook{Name: "Book", Price: usd(10), Date: "2000"})
+				return err
+			})
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("WithTx: %v", err)
+		}
+	}
+
+	resp, err := strg.Book().GetList(ctx, &models.GetListBookRequest{Limit: workers * 2})
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+
+	if countOf(resp.Count) != workers {
+		t.Fatalf("GetList returned count %d, want %d", countOf(resp.Count), workers)
+	}
+}
+
+func testOrderStatus(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	userId := createUser(t, strg)
+
+	// paying debits wallet
+	_, err := strg.Wallet().TopUp(ctx, &models.WalletOperation{UserId: userId, Amount: usd(100)})
+	if err != nil {
+		t.Fatalf("TopUp: %v", err)
+	}
+
+	id, err := strg.Order().Create(ctx, &models.CreateOrder{UserId: userId, BookId: createBook(t, strg), CreatedBy: userId})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	order, err := strg.Order().GetByPKey(ctx, &models.OrderPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	if order.Status != models.OrderPending {
+		t.Fatalf("new order is %s, want pending", order.Status)
+	}
+
+	_, err = strg.Order().Transition(ctx, &models.OrderTransition{Id: id, Status: models.OrderShipped})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Transition from pending to shipped returned %v, want conflict", err)
+	}
+
+	_, err = strg.Order().Transition(ctx, &models.OrderTransition{Id: id, Status: models.OrderPaid, Version: order.Version + 1})
+	if !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Fatalf("Transition with stale version returned %v, want version mismatch", err)
+	}
+
+	_, err = strg.Order().Transition(ctx, &models.OrderTransition{Id: id, Status: "lost"})
+	if !errors.Is(err, storage.ErrInvalidInput) {
+		t.Fatalf("Transition to unknown status returned %v, want invalid input", err)
+	}
+
+	paid, err := strg.Order().Transition(ctx, &models.OrderTransition{Id: id, Status: models.OrderPaid, ChangedBy: userId, Version: order.Version})
+	if err != nil {
+		t.Fatalf("Transition to paid: %v", err)
+	}
+
+	if paid.Status != models.OrderPaid || paid.Version != order.Version+1 {
+		t.Fatalf("Transition returned %s version %d, want paid version %d", paid.Status, paid.Version, order.Version+1)
+	}
+
+	// only pending order changes its user
+	_, err = strg.Order().Update(ctx, &models.UpdateOrder{Id: id, UserId: userId})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Update of paid order returned %v, want conflict", err)
+	}
+
+	_, err = strg.Order().Patch(ctx, &models.PatchOrder{Id: id, UserId: &userId})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Patch of paid order returned %v, want conflict", err)
+	}
+
+	for _, status := range []string{models.OrderShipped, models.OrderDelivered, models.OrderRefunded} {
+		_, err = strg.Order().Transition(ctx, &models.OrderTransition{Id: id, Status: status})
+		if err != nil {
+			t.Fatalf("Transition to %s: %v", status, err)
+		}
+	}
+
+	_, err = strg.Order().Transition(ctx, &models.OrderTransition{Id: id, Status: models.OrderCancelled})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Transition of refunded order returned %v, want conflict", err)
+	}
+
+	other, err := strg.Order().Create(ctx, &models.CreateOrder{UserId: userId, BookId: createBook(t, strg)})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	_, err = strg.Order().Transition(ctx, &models.OrderTransition{Id: other, Status: models.OrderCancelled, ChangedBy: uuid.New().String()})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("Transition by missing user returned %v, want foreign key", err)
+	}
+
+	history, err := strg.Order().GetStatusHistory(ctx, &models.OrderPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetStatusHistory: %v", err)
+	}
+
+	want := []models.OrderStatusChange{
+		{ToStatus: models.OrderPending, ChangedBy: userId},
+		{FromStatus: models.OrderPending, ToStatus: models.OrderPaid, ChangedBy: userId},
+		{FromStatus: models.OrderPaid, ToStatus: models.OrderShipped},
+		{FromStatus: models.OrderShipped, ToStatus: models.OrderDelivered},
+		{FromStatus: models.OrderDelivered, ToStatus: models.OrderRefunded},
+	}
+
+	if len(history) != len(want) {
+		t.Fatalf("GetStatusHistory returned %d changes, want %d", len(history), len(want))
+	}
+
+	for i, change := range history {
+		if change.ChangedAt == "" {
+			t.Fatalf("change %d has no changed_at", i)
+		}
+
+		change.ChangedAt = ""
+		if *change != want[i] {
+			t.Fatalf("GetStatusHistory returned change %d %+v, want %+v", i, *change, want[i])
+		}
+	}
+
+	list, err := strg.Order().GetList(ctx, &models.GetListOrderRequest{Status: models.OrderRefunded})
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+
+	if len(list.Orders) != 1 || list.Orders[0].Id != id {
+		t.Fatalf("GetList by refunded status returned %d orders, want the order", len(list.Orders))
+	}
+
+	list, err = strg.Order().GetList(ctx, &models.GetListOrderRequest{Status: models.OrderPending})
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+
+	if len(list.Orders) != 1 || list.Orders[0].Id != other {
+		t.Fatalf("GetList by pending status returned %d orders, want the other order", len(list.Orders))
+	}
+
+	_, err = strg.Order().GetStatusHistory(ctx, &models.OrderPrimarKey{Id: uuid.New().String()})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetStatusHistory of missing order returned %v, want not found", err)
+	}
+}
+
+func testStock(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	userId := createUser(t, strg)
+
+	// paying debits wallet
+	_, err := strg.Wallet().TopUp(ctx, &models.WalletOperation{UserId: userId, Amount: usd(100)})
+	if err != nil {
+		t.Fatalf("TopUp: %v", err)
+	}
+
+	_, err = strg.Book().Create(ctx, &models.CreateBook{Name: "Book", Price: usd(10), Date: "2000", Stock: -1})
+	if !errors.Is(err, storage.ErrInvalidInput) {
+		t.Fatalf("Create with negative stock returned %v, want invalid input", err)
+	}
+
+	dune, err := strg.Book().Create(ctx, &models.CreateBook{Name: "Dune", Price: usd(120), Date: "1965", Stock: 3, LowStockThreshold: 1})
+	if err != nil {
+		t.Fatalf("create book: %v", err)
+	}
+
+	emma, err := strg.Book().Create(ctx, &models.CreateBook{Name: "Emma", Price: usd(15), Date: "1815", Stock: 1})
+	if err != nil {
+		t.Fatalf("create book: %v", err)
+	}
+
+	stockOf := func(id string) int32 {
+		t.Helper()
+
+		book, err := strg.Book().GetByPKey(ctx, &models.BookPrimarKey{Id: id})
+		if err != nil {
+			t.Fatalf("GetByPKey: %v", err)
+		}
+
+		return book.Stock
+	}
+
+	order, err := strg.Order().Create(ctx, &models.CreateOrder{UserId: userId, Items: []*models.CreateOrderItem{{BookId: dune, Quantity: 2}}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if stock := stockOf(dune); stock != 1 {
+		t.Fatalf("order of 2 left stock %d, want 1", stock)
+	}
+
+	// stock written with version read before the order would bring reserved copies back
+	_, err = strg.Book().Update(ctx, &models.UpdateBook{Id: dune, Name: "Dune", Price: usd(120), Date: "1965", Stock: 3, Version: 1})
+	if !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Fatalf("Update with version from before order returned %v, want version mismatch", err)
+	}
+
+	stale := int32(3)
+
+	_, err = strg.Book().Patch(ctx, &models.PatchBook{Id: dune, Stock: &stale, Version: 1})
+	if !errors.Is(err, storage.ErrVersionMismatch) {
+		t.Fatalf("Patch with version from before order returned %v, want version mismatch", err)
+	}
+
+	list, err := strg.Book().GetList(ctx, &models.GetListBookRequest{LowStock: true})
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+
+	if len(list.Books) != 1 || list.Books[0].Id != dune {
+		t.Fatalf("GetList of low stock returned %d books, want the ordered one", len(list.Books))
+	}
+
+	// short second item leaves stock of the first alone
+	_, err = strg.Order().Create(ctx, &models.CreateOrder{
+		UserId: userId,
+		Items: []*models.CreateOrderItem{
+			{BookId: dune, Quantity: 1},
+			{BookId: emma, Quantity: 2},
+		},
+	})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Create beyond stock returned %v, want conflict", err)
+	}
+
+	if stock := stockOf(dune); stock != 1 {
+		t.Fatalf("failed order left stock %d, want 1", stock)
+	}
+
+	_, err = strg.Order().Transition(ctx, &models.OrderTransition{Id: order, Status: models.OrderCancelled})
+	if err != nil {
+		t.Fatalf("Transition to cancelled: %v", err)
+	}
+
+	if stock := stockOf(dune); stock != 3 {
+		t.Fatalf("cancelled order left stock %d, want 3", stock)
+	}
+
+	past := time.Now().Add(-time.Minute)
+
+	expiring, err := strg.Order().Create(ctx, &models.CreateOrder{UserId: userId, BookId: dune, ReservedUntil: past})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	paid, err := strg.Order().Create(ctx, &models.CreateOrder{UserId: userId, BookId: emma, ReservedUntil: past})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	resp, err := strg.Order().Transition(ctx, &models.OrderTransition{Id: paid, Status: models.OrderPaid})
+	if err != nil {
+		t.Fatalf("Transition to paid: %v", err)
+	}
+
+	if resp.ReservedUntil != "" {
+		t.Fatalf("paid order is still reserved until %s", resp.ReservedUntil)
+	}
+
+	expired, err := strg.Order().ExpireReservations(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("ExpireReservations: %v", err)
+	}
+
+	if expired != 1 {
+		t.Fatalf("ExpireReservations cancelled %d orders, want 1", expired)
+	}
+
+	resp, err = strg.Order().GetByPKey(ctx, &models.OrderPrimarKey{Id: expiring})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	if resp.Status != models.OrderCancelled || stockOf(dune) != 3 || stockOf(emma) != 0 {
+		t.Fatalf("expired order is %s with stock %d and %d, want cancelled with 3 and 0", resp.Status, stockOf(dune), stockOf(emma))
+	}
+
+	history, err := strg.Order().GetStatusHistory(ctx, &models.OrderPrimarKey{Id: expiring})
+	if err != nil {
+		t.Fatalf("GetStatusHistory: %v", err)
+	}
+
+	if last := history[len(history)-1]; last.FromStatus != models.OrderPending || last.ToStatus != models.OrderCancelled || last.ChangedBy != "" {
+		t.Fatalf("last change of expired order is %+v, want pending to cancelled by nobody", *last)
+	}
+
+	restock := int32(5)
+
+	book, err := strg.Book().Patch(ctx, &models.PatchBook{Id: emma, Stock: &restock})
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+
+	if book.Stock != 5 {
+		t.Fatalf("Patch left stock %d, want 5", book.Stock)
+	}
+}
+
+func testWallet(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	userId := createUser(t, strg)
+
+	balanceOf := func() models.Money {
+		t.Helper()
+
+		wallet, err := strg.Wallet().GetBalance(ctx, &models.UserPrimarKey{Id: userId})
+		if err != nil {
+			t.Fatalf("GetBalance: %v", err)
+		}
+
+		return wallet.Balance
+	}
+
+	if balance := balanceOf(); balance != usd(0) {
+		t.Fatalf("new wallet has balance %+v, want 0", balance)
+	}
+
+	for _, amount := range []models.Money{{Amount: 5}, usd(0), usd(-5), usd(1 << 31), {Amount: 5, Currency: "EUR"}} {
+		_, err := strg.Wallet().TopUp(ctx, &models.WalletOperation{UserId: userId, Amount: amount})
+		if !errors.Is(err, storage.ErrInvalidInput) {
+			t.Fatalf("TopUp of %+v returned %v, want invalid input", amount, err)
+		}
+	}
+
+	_, err := strg.Wallet().TopUp(ctx, &models.WalletOperation{UserId: uuid.New().String(), Amount: usd(10)})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("TopUp of missing user returned %v, want not found", err)
+	}
+
+	wallet, err := strg.Wallet().TopUp(ctx, &models.WalletOperation{UserId: userId, Amount: usd(50), CreatedBy: userId})
+	if err != nil {
+		t.Fatalf("TopUp: %v", err)
+	}
+
+	if wallet.Balance != usd(50) {
+		t.Fatalf("TopUp left balance %+v, want 50", wallet.Balance)
+	}
+
+	_, err = strg.Wallet().Withdraw(ctx, &models.WalletOperation{UserId: userId, Amount: usd(80)})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Withdraw beyond balance returned %v, want conflict", err)
+	}
+
+	_, err = strg.Wallet().Withdraw(ctx, &models.WalletOperation{UserId: userId, Amount: usd(20)})
+	if err != nil {
+		t.Fatalf("Withdraw: %v", err)
+	}
+
+	bookId := createBook(t, strg)
+
+	order, err := strg.Order().Create(ctx, &models.CreateOrder{UserId: userId, Items: []*models.CreateOrderItem{{BookId: bookId, Quantity: 2}}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	_, err = strg.Order().Transition(ctx, &models.OrderTransition{Id: order, Status: models.OrderPaid})
+	if err != nil {
+		t.Fatalf("Transition to paid: %v", err)
+	}
+
+	if balance := balanceOf(); balance != usd(10) {
+		t.Fatalf("paid order of 20 left balance %+v, want 10", balance)
+	}
+
+	overdraw, err := strg.Order().Create(ctx, &models.CreateOrder{UserId: userId, Items: []*models.CreateOrderItem{{BookId: bookId, Quantity: 2}}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	_, err = strg.Order().Transition(ctx, &models.OrderTransition{Id: overdraw, Status: models.OrderPaid})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Transition to paid beyond balance returned %v, want conflict", err)
+	}
+
+	resp, err := strg.Order().GetByPKey(ctx, &models.OrderPrimarKey{Id: overdraw})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	if resp.Status != models.OrderPending || balanceOf() != usd(10) {
+		t.Fatalf("rejected payment left order %s and balance %+v, want pending and 10", resp.Status, balanceOf())
+	}
+
+	_, err = strg.Order().Transition(ctx, &models.OrderTransition{Id: order, Status: models.OrderRefunded})
+	if err != nil {
+		t.Fatalf("Transition to refunded: %v", err)
+	}
+
+	if balance := balanceOf(); balance != usd(30) {
+		t.Fatalf("refunded order left balance %+v, want 30", balance)
+	}
+
+	ledger, err := strg.Wallet().GetLedger(ctx, &models.GetLedgerRequest{UserId: userId})
+	if err != nil {
+		t.Fatalf("GetLedger: %v", err)
+	}
+
+	want := []struct {
+		kind    string
+		amount  models.Money
+		orderId string
+	}{
+		{models.LedgerTopUp, usd(50), ""},
+		{models.LedgerWithdrawal, usd(-20), ""},
+		{models.LedgerOrderPayment, usd(-20), order},
+		{models.LedgerOrderRefund, usd(20), order},
+	}
+
+	if ledger.Count != int32(len(want)) || len(ledger.Entries) != len(want) {
+		t.Fatalf("GetLedger returned count %d and %d entries, want %d", ledger.Count, len(ledger.Entries), len(want))
+	}
+
+	for i, entry := range ledger.Entries {
+		if entry.Kind != want[i].kind || entry.Amount != want[i].amount || entry.OrderId != want[i].orderId ||
+			entry.Account != models.AccountWallet || entry.UserId != userId || entry.TransactionId == "" {
+			t.Fatalf("GetLedger returned entry %d %+v, want %s of %+v", i, *entry, want[i].kind, want[i].amount)
+		}
+	}
+
+	if ledger.Entries[0].CreatedBy != userId {
+		t.Fatalf("top up was created by %q, want %s", ledger.Entries[0].CreatedBy, userId)
+	}
+
+	fixed, err := strg.Wallet().Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if len(fixed) != 0 {
+		t.Fatalf("Reconcile fixed %d balances that match their ledger", len(fixed))
+	}
+}
+
+func testMoney(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	userId := createUser(t, strg)
+
+	_, err := strg.Wallet().TopUp(ctx, &models.WalletOperation{UserId: userId, Amount: usd(100)})
+	if err != nil {
+		t.Fatalf("TopUp: %v", err)
+	}
+
+	eur := models.Money{Amount: 1250, Currency: "EUR"}
+
+	euroBook, err := strg.Book().Create(ctx, &models.CreateBook{Name: "Emma", Price: eur, Date: "1815", Stock: 10})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	dollarBook := createBook(t, strg)
+
+	books, err := strg.Book().GetList(ctx, &models.GetListBookRequest{Currency: "EUR"})
+	if err != nil {
+		t.Fatalf("GetList: %v", err)
+	}
+
+	if len(books.Books) != 1 || books.Books[0].Id != euroBook || books.Books[0].Price != eur {
+		t.Fatalf("GetList of EUR returned %+v, want only %s priced %+v", books.Books, euroBook, eur)
+	}
+
+	_, err = strg.Order().Create(ctx, &models.CreateOrder{
+		UserId: userId,
+		Items:  []*models.CreateOrderItem{{BookId: euroBook, Quantity: 1}, {BookId: dollarBook, Quantity: 1}},
+	})
+	if !errors.Is(err, storage.ErrInvalidInput) {
+		t.Fatalf("Create with books of two currencies returned %v, want invalid input", err)
+	}
+
+	id, err := strg.Order().Create(ctx, &models.CreateOrder{UserId: userId, Items: []*models.CreateOrderItem{{BookId: euroBook, Quantity: 3}}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	order, err := strg.Order().GetByPKey(ctx, &models.OrderPrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("GetByPKey: %v", err)
+	}
+
+	want := models.Money{Amount: 3750, Currency: "EUR"}
+
+	if order.Total != want || len(order.Items) != 1 || order.Items[0].UnitPrice != eur || order.Items[0].Total != want {
+		t.Fatalf("GetByPKey returned total %+v and items %+v, want %+v", order.Total, order.Items, want)
+	}
+
+	// wallets hold USD only
+	_, err = strg.Order().Transition(ctx, &models.OrderTransition{Id: id, Status: models.OrderPaid})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Transition to paid of EUR order returned %v, want conflict", err)
+	}
+
+	wallet, err := strg.Wallet().GetBalance(ctx, &models.UserPrimarKey{Id: userId})
+	if err != nil || wallet.Balance != usd(100) {
+		t.Fatalf("rejected payment left wallet %+v, %v, want balance of 100", wallet, err)
+	}
+}
+
+func testRefreshToken(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var (
+		userId   = createUser(t, strg)
+		familyId = uuid.New().String()
+		expires  = time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	)
+
+	create := func(userId, familyId, hash string, expiresAt time.Time) string {
+		t.Helper()
+
+		id, err := strg.RefreshToken().Create(ctx, &models.CreateRefreshToken{
+			FamilyId: familyId, UserId: userId, TokenHash: hash, Role: "CLIENT", ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		return id
+	}
+
+	get := func(hash string) *models.RefreshToken {
+		t.Helper()
+
+		token, err := strg.RefreshToken().GetByPKey(ctx, &models.RefreshTokenPrimarKey{TokenHash: hash})
+		if err != nil {
+			t.Fatalf("GetByPKey of %s: %v", hash, err)
+		}
+
+		return token
+	}
+
+	use := func(hash string) int64 {
+		t.Helper()
+
+		rowsAffected, err := strg.RefreshToken().Use(ctx, &models.RefreshTokenPrimarKey{TokenHash: hash})
+		if err != nil {
+			t.Fatalf("Use of %s: %v", hash, err)
+		}
+
+		return rowsAffected
+	}
+
+	id := create(userId, familyId, "first", expires)
+
+	token := get("first")
+	if token.Id != id || token.FamilyId != familyId || token.UserId != userId || token.Role != "CLIENT" ||
+		!token.ExpiresAt.Equal(expires) || token.UsedAt != nil || token.RevokedAt != nil {
+		t.Fatalf("GetByPKey returned %+v", token)
+	}
+
+	_, err := strg.RefreshToken().GetByPKey(ctx, &models.RefreshTokenPrimarKey{TokenHash: "missing"})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey of missing hash returned %v, want not found", err)
+	}
+
+	_, err = strg.RefreshToken().Create(ctx, &models.CreateRefreshToken{
+		FamilyId: familyId, UserId: userId, TokenHash: "first", ExpiresAt: expires,
+	})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Create of duplicate hash returned %v, want conflict", err)
+	}
+
+	_, err = strg.RefreshToken().Create(ctx, &models.CreateRefreshToken{
+		FamilyId: familyId, UserId: uuid.New().String(), TokenHash: "orphan", ExpiresAt: expires,
+	})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("Create for missing user returned %v, want foreign key", err)
+	}
+
+	// rotation uses the presented token once and issues the next one in the same family
+	if n := use("first"); n != 1 {
+		t.Fatalf("first Use affected %d rows, want 1", n)
+	}
+	create(userId, familyId, "second", expires)
+
+	if token = get("first"); token.UsedAt == nil || token.RevokedAt != nil {
+		t.Fatalf("used token is %+v, want used and not revoked", token)
+	}
+
+	// second use of a rotated token affects nothing, callers then revoke the family
+	if n := use("first"); n != 0 {
+		t.Fatalf("second Use affected %d rows, want 0", n)
+	}
+
+	otherFamily := uuid.New().String()
+	create(userId, otherFamily, "other", expires)
+
+	err = strg.RefreshToken().RevokeFamily(ctx, familyId)
+	if err != nil {
+		t.Fatalf("RevokeFamily: %v", err)
+	}
+
+	for _, hash := range []string{"first", "second"} {
+		if token = get(hash); token.RevokedAt == nil {
+			t.Fatalf("token %s of revoked family is %+v, want revoked", hash, token)
+		}
+	}
+
+	if n := use("second"); n != 0 {
+		t.Fatalf("Use of revoked token affected %d rows, want 0", n)
+	}
+
+	if token = get("other"); token.RevokedAt != nil {
+		t.Fatalf("token of other family is %+v, want active", token)
+	}
+
+	// expiry is checked by callers against ExpiresAt, the store keeps expired tokens readable
+	expired := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	create(userId, uuid.New().String(), "expired", expired)
+
+	if token = get("expired"); !token.ExpiresAt.Equal(expired) || token.ExpiresAt.After(time.Now()) {
+		t.Fatalf("expired token is %+v, want expires at %v", token, expired)
+	}
+
+	otherUser := createUser(t, strg)
+	create(otherUser, uuid.New().String(), "stranger", expires)
+
+	err = strg.RefreshToken().RevokeUser(ctx, userId)
+	if err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+
+	for _, hash := range []string{"other", "expired"} {
+		if token = get(hash); token.RevokedAt == nil {
+			t.Fatalf("token %s of revoked user is %+v, want revoked", hash, token)
+		}
+	}
+
+	if token = get("stranger"); token.RevokedAt != nil {
+		t.Fatalf("token of other user is %+v, want active", token)
+	}
+}
+
+func testRevocation(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	var (
+		userId  = createUser(t, strg)
+		active  = uuid.New().String()
+		expired = uuid.New().String()
+	)
+
+	for _, token := range []*models.RevokeToken{
+		{Jti: active, UserId: userId, ExpiresAt: time.Now().Add(time.Hour)},
+		{Jti: expired, UserId: userId, ExpiresAt: time.Now().Add(-time.Hour)},
+	} {
+		err := strg.Revocation().Revoke(ctx, token)
+		if err != nil {
+			t.Fatalf("Revoke of %s: %v", token.Jti, err)
+		}
+	}
+
+	// revoking same jti twice, as on repeated logout, is not an error
+	err := strg.Revocation().Revoke(ctx, &models.RevokeToken{Jti: active, UserId: userId, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("second Revoke: %v", err)
+	}
+
+	err = strg.Revocation().Revoke(ctx, &models.RevokeToken{Jti: uuid.New().String(), UserId: uuid.New().String(), ExpiresAt: time.Now().Add(time.Hour)})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("Revoke for missing user returned %v, want foreign key", err)
+	}
+
+	revokedBefore := time.Now().UTC().Truncate(time.Second)
+
+	err = strg.Revocation().RevokeUser(ctx, &models.RevokeUserTokens{UserId: userId, RevokedBefore: revokedBefore})
+	if err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+
+	// later revocation of same user moves the cut off instead of adding a row
+	revokedBefore = revokedBefore.Add(time.Minute)
+
+	err = strg.Revocation().RevokeUser(ctx, &models.RevokeUserTokens{UserId: userId, RevokedBefore: revokedBefore})
+	if err != nil {
+		t.Fatalf("second RevokeUser: %v", err)
+	}
+
+	err = strg.Revocation().RevokeUser(ctx, &models.RevokeUserTokens{UserId: uuid.New().String(), RevokedBefore: revokedBefore})
+	if !errors.Is(err, storage.ErrForeignKey) {
+		t.Fatalf("RevokeUser of missing user returned %v, want foreign key", err)
+	}
+
+	revocations, err := strg.Revocation().GetActive(ctx)
+	if err != nil {
+		t.Fatalf("GetActive: %v", err)
+	}
+
+	if len(revocations.Tokens) != 1 || revocations.Tokens[0].Jti != active || revocations.Tokens[0].UserId != userId {
+		t.Fatalf("GetActive returned tokens %+v, want only %s", revocations.Tokens, active)
+	}
+
+	if len(revocations.Users) != 1 || revocations.Users[0].UserId != userId || !revocations.Users[0].RevokedBefore.Equal(revokedBefore) {
+		t.Fatalf("GetActive returned users %+v, want %s revoked before %v", revocations.Users, userId, revokedBefore)
+	}
+
+	deleted, err := strg.Revocation().DeleteExpired(ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpired: %v", err)
+	}
+
+	if deleted != 1 {
+		t.Fatalf("DeleteExpired deleted %d rows, want 1", deleted)
+	}
+
+	if deleted, err = strg.Revocation().DeleteExpired(ctx); err != nil || deleted != 0 {
+		t.Fatalf("second DeleteExpired = %d, %v, want 0", deleted, err)
+	}
+
+	if revocations, err = strg.Revocation().GetActive(ctx); err != nil || len(revocations.Tokens) != 1 {
+		t.Fatalf("GetActive after DeleteExpired = %+v, %v, want active token kept", revocations, err)
+	}
+}
+
+func testRole(t *testing.T, strg storage.StorageI) {
+	ctx := context.Background()
+
+	// roles outlive users between subtests of some backends, so names are unique
+	var (
+		name    = "EDITOR_" + uuid.New().String()
+		renamed = "REVIEWER_" + uuid.New().String()
+		userId  = createUser(t, strg)
+	)
+
+	id, err := strg.Role().Create(ctx, &models.CreateRole{Name: name, Permissions: []string{"book:write", "book:read", "book:write"}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	_, err = strg.Role().Create(ctx, &models.CreateRole{Name: name})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Create of duplicate name returned %v, want conflict", err)
+	}
+
+	for _, pkey := range []*models.RolePrimarKey{{Id: id}, {Name: name}} {
+		role, err := strg.Role().GetByPKey(ctx, pkey)
+		if err != nil {
+			t.Fatalf("GetByPKey of %+v: %v", pkey, err)
+		}
+
+		if role.Id != id || role.Name != name || !reflect.DeepEqual(role.Permissions, []string{"book:read", "book:write"}) {
+			t.Fatalf("GetByPKey of %+v returned %+v", pkey, role)
+		}
+	}
+
+	_, err = strg.Role().GetByPKey(ctx, &models.RolePrimarKey{Name: "missing"})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("GetByPKey of missing role returned %v, want not found", err)
+	}
+
+	if ok, err := strg.Role().HasPermission(ctx, name, "book:write"); err != nil || !ok {
+		t.Fatalf("HasPermission(book:write) = %v, %v, want true", ok, err)
+	}
+
+	if ok, err := strg.Role().HasPermission(ctx, name, "user:write"); err != nil || ok {
+		t.Fatalf("HasPermission(user:write) = %v, %v, want false", ok, err)
+	}
+
+	if ok, err := strg.Role().HasPermission(ctx, "missing", "book:write"); err != nil || ok {
+		t.Fatalf("HasPermission of missing role = %v, %v, want false", ok, err)
+	}
+
+	// assigning twice keeps one assignment, roles come back in assignment order
+	for _, role := range []string{name, "CLIENT", name} {
+		err = strg.Role().AssignToUser(ctx, &models.UserRole{UserId: userId, Role: role})
+		if err != nil {
+			t.Fatalf("AssignToUser of %s: %v", role, err)
+		}
+	}
+
+	err = strg.Role().AssignToUser(ctx, &models.UserRole{UserId: userId, Role: "missing"})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("AssignToUser of missing role returned %v, want not found", err)
+	}
+
+	roles, err := strg.Role().GetUserRoles(ctx, userId)
+	if err != nil {
+		t.Fatalf("GetUserRoles: %v", err)
+	}
+
+	if !reflect.DeepEqual(roles, []string{name, "CLIENT"}) {
+		t.Fatalf("GetUserRoles returned %v, want %v", roles, []string{name, "CLIENT"})
+	}
+
+	// update replaces permissions instead of adding to them
+	rowsAffected, err := strg.Role().Update(ctx, &models.UpdateRole{Id: id, Name: renamed, Permissions: []string{"order:read"}})
+	if err != nil || rowsAffected != 1 {
+		t.Fatalf("Update = %d, %v, want 1 row", rowsAffected, err)
+	}
+
+	if ok, err := strg.Role().HasPermission(ctx, renamed, "book:write"); err != nil || ok {
+		t.Fatalf("HasPermission of dropped permission = %v, %v, want false", ok, err)
+	}
+
+	if ok, err := strg.Role().HasPermission(ctx, renamed, "order:read"); err != nil || !ok {
+		t.Fatalf("HasPermission of new permission = %v, %v, want true", ok, err)
+	}
+
+	_, err = strg.Role().Update(ctx, &models.UpdateRole{Id: id, Name: "CLIENT"})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("Update to taken name returned %v, want conflict", err)
+	}
+
+	rowsAffected, err = strg.Role().Update(ctx, &models.UpdateRole{Id: uuid.New().String(), Name: "missing"})
+	if err != nil || rowsAffected != 0 {
+		t.Fatalf("Update of missing role = %d, %v, want 0 rows", rowsAffected, err)
+	}
+
+	if roles, err = strg.Role().GetUserRoles(ctx, userId); err != nil || !reflect.DeepEqual(roles, []string{renamed, "CLIENT"}) {
+		t.Fatalf("GetUserRoles after rename = %v, %v, want %v", roles, err, []string{renamed, "CLIENT"})
+	}
+
+	err = strg.Role().RevokeFromUser(ctx, &models.UserRole{UserId: userId, Role: "CLIENT"})
+	if err != nil {
+		t.Fatalf("RevokeFromUser: %v", err)
+	}
+
+	if roles, err = strg.Role().GetUserRoles(ctx, userId); err != nil || !reflect.DeepEqual(roles, []string{renamed}) {
+		t.Fatalf("GetUserRoles after RevokeFromUser = %v, %v, want %v", roles, err, []string{renamed})
+	}
+
+	// deleting role takes it away from its users
+	err = strg.Role().Delete(ctx, &models.RolePrimarKey{Id: id})
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if roles, err = strg.Role().GetUserRoles(ctx, userId); err != nil || len(roles) != 0 {
+		t.Fatalf("GetUserRoles after Delete = %v, %v, want none", roles, err)
+	}
+
+	err = strg.Role().Delete(ctx, &models.RolePrimarKey{Id: id})
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("second Delete returned %v, want not found", err)
+	}
+}
+
+func createBook(t *testing.T, strg storage.StorageI) string {
+	t.Helper()
+
+	id, err := strg.Book().Create(context.Background(), &models.CreateBook{Name: "Book", AuthorName: "Author", Price: usd(10), Date: "2000", Stock: 100})
+	if err != nil {
+		t.Fatalf("create book: %v", err)
+	}
+
+	return id
+}
+
+func createUser(t *testing.T, strg storage.StorageI) string {
+	t.Helper()
+
+	id, err := strg.User().Create(context.Background(), &models.CreateUser{
+		FirstName: "First", LastName: "Last", Login: uuid.New().String(), Password: "x", PhoneNumber: "1",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	return id
+}
+
+// countOf is total count of list response, -1 when it was left out
+func countOf(count *int32) int {
+
+	if count == nil {
+		return -1
+	}
+
+	return int(*count)
+}
+
+func usd(amount int64) models.Money {
+	return models.Money{Amount: amount, Currency: "USD"}
+}
@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+
+	"crud/models"
+)
+
+// WalletAmount returns amount of wallet operation, it must be positive amount of WalletCurrency that
+// fits ledger_entries.amount INTEGER column. Anything else is ErrInvalidInput
+func WalletAmount(op *models.WalletOperation) (int64, error) {
+
+	if op.Amount.Currency != models.WalletCurrency {
+		return 0, fmt.Errorf("%w: wallets hold %s, got %q", ErrInvalidInput, models.WalletCurrency, op.Amount.Currency)
+	}
+
+	if op.Amount.Amount <= 0 || op.Amount.Amount > math.MaxInt32 {
+		return 0, fmt.Errorf("%w: amount must be from 1 to %d minor units, got %d", ErrInvalidInput, math.MaxInt32, op.Amount.Amount)
+	}
+
+	return op.Amount.Amount, nil
+}